@@ -1,8 +1,19 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm"
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm/rcds"
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/genSync"
 )
 
 func main() {
@@ -40,16 +51,47 @@ func printUsage() {
 	fmt.Println("Server Options:")
 	fmt.Println("  --host <host>          - Server host address (default: 127.0.0.1)")
 	fmt.Println("  --port <port>          - Server port (default: 8080)")
-	fmt.Println("  --algorithm <algo>     - Sync algorithm: rcds, iblt, full (default: iblt)")
+	fmt.Println("  --algorithm <algo>     - Sync algorithm: rcds, iblt, cpi, intercpi, full (default: iblt)")
+	fmt.Println("  --input <path>         - File or directory to serve (default: empty set)")
+	fmt.Println("  --diff <n>             - Expected symmetric set difference for iblt and cpi, 0 estimates it for iblt (default: 100)")
+	fmt.Println("  --retries <n>          - Maximum iblt resync retries (default: 3)")
+	fmt.Println("  --levels <n>           - Number of rcds partition levels, 0 derives them from --chunk-distance (default: 0)")
+	fmt.Println("  --chunk-distance <h>   - Inter-partition distance of the first rcds level, divided by 4 per level (default: 1024)")
+	fmt.Println("  --partition-levels <l> - Comma separated h:r:hs chunk distance, rolling window and hash space of each rcds level")
+	fmt.Println("  --sessions <n>         - Number of sync sessions to serve, 0 for unlimited (default: 0)")
+	fmt.Println("  --hash <name>          - Hash function: fnv64, xxhash64, siphash24, sha256-64, must match the client (default: fnv64)")
+	fmt.Println("  --hash-key <hex>       - 16 byte hex key for siphash24")
+	fmt.Println("  --tls-cert <path>      - PEM certificate of the server, enables TLS")
+	fmt.Println("  --tls-key <path>       - PEM private key of the server certificate")
+	fmt.Println("  --tls-ca <path>        - PEM CA certificates that client certificates must be issued by, requires --tls-cert")
+	fmt.Println("  --compression <list>   - Comma separated compressions to accept from clients: flate, gzip (default: none)")
 	fmt.Println()
 	fmt.Println("Client Options:")
 	fmt.Println("  --host <host>          - Server host address (default: 127.0.0.1)")
 	fmt.Println("  --port <port>          - Server port (default: 8080)")
-	fmt.Println("  --algorithm <algo>     - Sync algorithm: rcds, iblt, full (default: iblt)")
+	fmt.Println("  --algorithm <algo>     - Sync algorithm: rcds, iblt, cpi, intercpi, full (default: iblt)")
+	fmt.Println("  --input <path>         - Local file or directory to reconcile (default: empty set)")
+	fmt.Println("  --output <path>        - File to write the reconciled content to")
+	fmt.Println("  --diff <n>             - Expected symmetric set difference for iblt and cpi, 0 estimates it for iblt (default: 100)")
+	fmt.Println("  --retries <n>          - Maximum iblt resync retries (default: 3)")
+	fmt.Println("  --levels <n>           - Number of rcds partition levels, 0 derives them from --chunk-distance (default: 0)")
+	fmt.Println("  --chunk-distance <h>   - Inter-partition distance of the first rcds level, divided by 4 per level (default: 1024)")
+	fmt.Println("  --partition-levels <l> - Comma separated h:r:hs chunk distance, rolling window and hash space of each rcds level")
+	fmt.Println("  --hash <name>          - Hash function: fnv64, xxhash64, siphash24, sha256-64, must match the server (default: fnv64)")
+	fmt.Println("  --hash-key <hex>       - 16 byte hex key for siphash24")
+	fmt.Println("  --mode <mode>          - rcds sync mode: pull, push, merge (default: pull)")
+	fmt.Println("  --base <path>          - Common base version of the file for --mode merge")
+	fmt.Println("  --tls                  - Connect over TLS, verifying the server against the system roots")
+	fmt.Println("  --tls-ca <path>        - PEM CA certificates pinned to verify the server, enables TLS")
+	fmt.Println("  --tls-cert <path>      - PEM client certificate for servers verifying clients, enables TLS")
+	fmt.Println("  --tls-key <path>       - PEM private key of the client certificate")
+	fmt.Println("  --compression <list>   - Comma separated compressions to offer in order of preference: flate, gzip (default: none)")
+	fmt.Println("  --timeout <duration>   - Give up connecting and syncing after the duration, e.g. 30s, 0 never gives up (default: 0)")
+	fmt.Println("  --dry-run              - Report the changes of a full sync without applying them or writing --output")
 	fmt.Println()
 	fmt.Println("Examples:")
-	fmt.Println("  rcds server --port 8080")
-	fmt.Println("  rcds client --host 127.0.0.1 --port 8080")
+	fmt.Println("  rcds server --port 8080 --input ./data")
+	fmt.Println("  rcds client --host 127.0.0.1 --port 8080 --input local.txt --output synced.txt")
 }
 
 func printVersion() {
@@ -57,19 +99,44 @@ func printVersion() {
 	fmt.Println("Go implementation of Recursive Content-Dependent Shingling")
 }
 
-// networkConfig holds network configuration parsed from command-line arguments
+// networkConfig holds network and sync configuration parsed from command-line arguments
 type networkConfig struct {
-	host      string
-	port      int
-	algorithm string
+	host            string
+	port            int
+	algorithm       string
+	input           string
+	output          string
+	symmetricDiff   int
+	retries         int
+	sessions        int
+	hash            string
+	hashKey         []byte
+	mode            rcds.SyncMode
+	base            string
+	timeout         time.Duration
+	tls             bool
+	tlsCert         string
+	tlsKey          string
+	tlsCA           string
+	compression     []genSync.Compression
+	dryRun          bool
+	levelNum        int
+	chunkDistance   int
+	partitionLevels []rcds.PartitionLevel
 }
 
-// parseNetworkFlags parses common network flags (--host, --port, --algorithm) from command-line arguments
+// parseNetworkFlags parses common network flags (--host, --port, --algorithm) and sync flags (--input, --output,
+// --diff, --retries, --sessions, --hash, --hash-key, --mode, --base, --timeout, --dry-run), rcds partition flags
+// (--levels, --chunk-distance, --partition-levels), TLS flags (--tls, --tls-cert, --tls-key, --tls-ca) and
+// --compression from command-line arguments
 func parseNetworkFlags() (*networkConfig, error) {
 	config := &networkConfig{
-		host:      "127.0.0.1",
-		port:      8080,
-		algorithm: "iblt",
+		host:          "127.0.0.1",
+		port:          8080,
+		algorithm:     "iblt",
+		symmetricDiff: 100,
+		retries:       3,
+		hash:          algorithm.FNVHasherName,
 	}
 
 	args := os.Args[2:]
@@ -94,17 +161,211 @@ func parseNetworkFlags() (*networkConfig, error) {
 		case "--algorithm":
 			if i+1 < len(args) {
 				config.algorithm = args[i+1]
-				if config.algorithm != "rcds" && config.algorithm != "iblt" && config.algorithm != "full" {
-					return nil, fmt.Errorf("invalid algorithm '%s'. Valid options: rcds, iblt, full", config.algorithm)
+				if config.algorithm != "rcds" && config.algorithm != "iblt" && config.algorithm != "cpi" && config.algorithm != "intercpi" && config.algorithm != "full" {
+					return nil, fmt.Errorf("invalid algorithm '%s'. Valid options: rcds, iblt, cpi, intercpi, full", config.algorithm)
+				}
+				i++
+			}
+		case "--input":
+			if i+1 < len(args) {
+				config.input = args[i+1]
+				i++
+			}
+		case "--output":
+			if i+1 < len(args) {
+				config.output = args[i+1]
+				i++
+			}
+		case "--diff":
+			if i+1 < len(args) {
+				if err := parseNonNegativeInt(args[i+1], "symmetric difference", &config.symmetricDiff); err != nil {
+					return nil, err
+				}
+				i++
+			}
+		case "--retries":
+			if i+1 < len(args) {
+				if err := parseNonNegativeInt(args[i+1], "retries", &config.retries); err != nil {
+					return nil, err
+				}
+				i++
+			}
+		case "--sessions":
+			if i+1 < len(args) {
+				if err := parseNonNegativeInt(args[i+1], "sessions", &config.sessions); err != nil {
+					return nil, err
 				}
 				i++
 			}
+		case "--levels":
+			if i+1 < len(args) {
+				if err := parseNonNegativeInt(args[i+1], "number of levels", &config.levelNum); err != nil {
+					return nil, err
+				}
+				i++
+			}
+		case "--chunk-distance":
+			if i+1 < len(args) {
+				if err := parseNonNegativeInt(args[i+1], "chunk distance", &config.chunkDistance); err != nil {
+					return nil, err
+				}
+				i++
+			}
+		case "--partition-levels":
+			if i+1 < len(args) {
+				levels, err := parsePartitionLevels(args[i+1])
+				if err != nil {
+					return nil, err
+				}
+				config.partitionLevels = levels
+				i++
+			}
+		case "--hash":
+			if i+1 < len(args) {
+				config.hash = args[i+1]
+				i++
+			}
+		case "--hash-key":
+			if i+1 < len(args) {
+				key, err := hex.DecodeString(args[i+1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid hash key '%s': %v", args[i+1], err)
+				}
+				config.hashKey = key
+				i++
+			}
+		case "--mode":
+			if i+1 < len(args) {
+				mode, err := parseSyncMode(args[i+1])
+				if err != nil {
+					return nil, err
+				}
+				config.mode = mode
+				i++
+			}
+		case "--base":
+			if i+1 < len(args) {
+				config.base = args[i+1]
+				i++
+			}
+		case "--tls":
+			config.tls = true
+		case "--tls-cert":
+			if i+1 < len(args) {
+				config.tlsCert = args[i+1]
+				i++
+			}
+		case "--tls-key":
+			if i+1 < len(args) {
+				config.tlsKey = args[i+1]
+				i++
+			}
+		case "--tls-ca":
+			if i+1 < len(args) {
+				config.tlsCA = args[i+1]
+				i++
+			}
+		case "--compression":
+			if i+1 < len(args) {
+				for _, name := range strings.Split(args[i+1], ",") {
+					config.compression = append(config.compression, genSync.Compression(strings.TrimSpace(name)))
+				}
+				i++
+			}
+		case "--timeout":
+			if i+1 < len(args) {
+				timeout, err := time.ParseDuration(args[i+1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid timeout '%s': %v", args[i+1], err)
+				}
+				if timeout < 0 {
+					return nil, fmt.Errorf("timeout must be non-negative, got %v", timeout)
+				}
+				config.timeout = timeout
+				i++
+			}
+		case "--dry-run":
+			config.dryRun = true
 		}
 	}
 
+	// Only IBLT estimates the difference, CPI needs a bound.
+	if config.algorithm == "cpi" && config.symmetricDiff == 0 {
+		return nil, fmt.Errorf("cpi requires a positive difference bound given by --diff")
+	}
+
+	if config.mode == rcds.MergeMode && config.base == "" {
+		return nil, fmt.Errorf("merge mode requires the common base version given by --base")
+	}
+
+	// Fail on an unknown hash function or a bad key before loading any input.
+	if _, err := algorithm.NewHasher(config.hash, config.hashKey); err != nil {
+		return nil, err
+	}
 	return config, nil
 }
 
+// connectionOptions returns the options of the connections of a server or a client, which offer the compressions
+// given by --compression and enable TLS if the TLS flags ask for it.
+func (c *networkConfig) connectionOptions(isServer bool) ([]genSync.ConnectionOption, error) {
+	var options []genSync.ConnectionOption
+	if len(c.compression) > 0 {
+		options = append(options, genSync.WithCompression(c.compression...))
+	}
+	var config *tls.Config
+	var err error
+	if isServer {
+		if c.tlsCert == "" {
+			if c.tlsCA != "" || c.tlsKey != "" {
+				return nil, fmt.Errorf("server TLS requires the certificate given by --tls-cert")
+			}
+			return options, nil
+		}
+		config, err = genSync.NewServerTLSConfig(c.tlsCert, c.tlsKey, c.tlsCA)
+	} else {
+		if !c.tls && c.tlsCA == "" && c.tlsCert == "" {
+			return options, nil
+		}
+		config, err = genSync.NewClientTLSConfig(c.tlsCA, c.tlsCert, c.tlsKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(options, genSync.WithTLS(config)), nil
+}
+
+func parseSyncMode(arg string) (rcds.SyncMode, error) {
+	for _, mode := range []rcds.SyncMode{rcds.PullMode, rcds.PushMode, rcds.MergeMode} {
+		if arg == mode.String() {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid sync mode '%s'. Valid options: pull, push, merge", arg)
+}
+
+// parsePartitionLevels parses comma separated h:r:hs parameters of rcds partition levels from the top of the tree.
+func parsePartitionLevels(arg string) ([]rcds.PartitionLevel, error) {
+	var levels []rcds.PartitionLevel
+	for _, l := range strings.Split(arg, ",") {
+		var level rcds.PartitionLevel
+		if _, err := fmt.Sscanf(strings.TrimSpace(l), "%d:%d:%d", &level.ChunkDistance, &level.RollingWindow, &level.HashSpace); err != nil {
+			return nil, fmt.Errorf("invalid partition level '%s', expected h:r:hs: %v", l, err)
+		}
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+func parseNonNegativeInt(arg, name string, val *int) error {
+	if _, err := fmt.Sscanf(arg, "%d", val); err != nil {
+		return fmt.Errorf("invalid %s '%s': %v", name, arg, err)
+	}
+	if *val < 0 {
+		return fmt.Errorf("%s must be non-negative, got %d", name, *val)
+	}
+	return nil
+}
+
 func runServer() {
 	config, err := parseNetworkFlags()
 	if err != nil {
@@ -112,13 +373,54 @@ func runServer() {
 		os.Exit(1)
 	}
 
+	connOptions, err := config.connectionOptions(true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	sync, err := newGenSync(config, connOptions...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	elemNum, err := populate(sync, config.input, config.algorithm)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
 	fmt.Printf("Starting RCDS server...\n")
 	fmt.Printf("  Host: %s\n", config.host)
 	fmt.Printf("  Port: %d\n", config.port)
 	fmt.Printf("  Algorithm: %s\n", config.algorithm)
-	fmt.Println("\nNote: Full server implementation coming soon.")
-	fmt.Println("For now, please use the library directly in your Go code.")
-	fmt.Println("See README.md for usage examples.")
+	fmt.Printf("  Elements: %d\n", elemNum)
+
+	server, err := genSync.NewServer(sync, config.host, config.port,
+		genSync.WithMaxSessions(config.sessions), genSync.WithSessionHandler(newSessionReporter()),
+		genSync.WithConnectionOptions(connOptions...))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err = server.Serve(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// newSessionReporter returns a session handler printing the outcome of each session, which may run concurrently with
+// others.
+func newSessionReporter() func(session genSync.GenSync, err error) {
+	var sessionNum int64
+	return func(session genSync.GenSync, err error) {
+		n := atomic.AddInt64(&sessionNum, 1)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Session %d failed: %v\n", n, err)
+			return
+		}
+		fmt.Printf("Session %d: sent %d bytes, received %d bytes, %d additions\n",
+			n, session.GetSentBytes(), session.GetReceivedBytes(), session.GetSetAdditions().Len())
+	}
 }
 
 func runClient() {
@@ -128,11 +430,86 @@ func runClient() {
 		os.Exit(1)
 	}
 
+	connOptions, err := config.connectionOptions(false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	sync, err := newGenSync(config, connOptions...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	// A sync of a file spools the received string to a temporary file, which closing the sync removes.
+	if closer, ok := sync.(io.Closer); ok {
+		defer closer.Close()
+	}
+	transactional, ok := sync.(genSync.Transactional)
+	if config.dryRun {
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: --dry-run is not supported by algorithm '%s'\n", config.algorithm)
+			os.Exit(1)
+		}
+		transactional.SetDryRun(true)
+	}
+	elemNum, err := populate(sync, config.input, config.algorithm)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
 	fmt.Printf("Starting RCDS client...\n")
 	fmt.Printf("  Host: %s\n", config.host)
 	fmt.Printf("  Port: %d\n", config.port)
 	fmt.Printf("  Algorithm: %s\n", config.algorithm)
-	fmt.Println("\nNote: Full client implementation coming soon.")
-	fmt.Println("For now, please use the library directly in your Go code.")
-	fmt.Println("See README.md for usage examples.")
+	fmt.Printf("  Elements: %d\n", elemNum)
+
+	ctx := context.Background()
+	if config.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.timeout)
+		defer cancel()
+	}
+	if err = sync.SyncClientContext(ctx, config.host, config.port); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: sync failed: %v\n", err)
+		if reporter, ok := sync.(rcds.ConflictReporter); ok {
+			for _, c := range reporter.Conflicts() {
+				fmt.Fprintf(os.Stderr, "  Conflict at base offset %d: %d base bytes, %d local bytes, %d remote bytes\n",
+					c.BaseOffset, len(c.Base), len(c.Local), len(c.Remote))
+			}
+		}
+		os.Exit(1)
+	}
+
+	if config.dryRun {
+		changes := transactional.GetStagedChanges()
+		fmt.Printf("Dry run complete: sent %d bytes, received %d bytes, %d would-be additions, %d would-be deletions\n",
+			sync.GetSentBytes(), sync.GetReceivedBytes(), changes.Additions.Len(), changes.Deletions.Len())
+		printStats(sync.Stats())
+		return
+	}
+	if config.output != "" {
+		if err = writeOutput(sync, config.output); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("  Output: %s\n", config.output)
+	}
+	fmt.Printf("Sync complete: sent %d bytes, received %d bytes, %d additions\n",
+		sync.GetSentBytes(), sync.GetReceivedBytes(), sync.GetSetAdditions().Len())
+	printStats(sync.Stats())
+}
+
+// printStats prints the bytes of each phase and round of a sync, and the bytes before compression if the sync was
+// compressed.
+func printStats(stats genSync.Stats) {
+	for _, p := range stats.Phases {
+		fmt.Printf("  %s: sent %d bytes, received %d bytes\n", p.Phase, p.Sent, p.Received)
+	}
+	for i, r := range stats.Rounds {
+		fmt.Printf("  round %d: sent %d bytes, received %d bytes\n", i+1, r.Sent, r.Received)
+	}
+	if stats.LogicalSentBytes != stats.SentBytes || stats.LogicalReceivedBytes != stats.ReceivedBytes {
+		fmt.Printf("  uncompressed: sent %d bytes, received %d bytes\n", stats.LogicalSentBytes, stats.LogicalReceivedBytes)
+	}
 }
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm"
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm/cpi"
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm/full_sync"
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm/iblt"
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm/rcds"
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/genSync"
+)
+
+// newGenSync builds the GenSync instance selected by the --algorithm flag, whose connections use the options.
+func newGenSync(config *networkConfig, connOptions ...genSync.ConnectionOption) (genSync.GenSync, error) {
+	hasher, err := algorithm.NewHasher(config.hash, config.hashKey)
+	if err != nil {
+		return nil, err
+	}
+	switch config.algorithm {
+	case "rcds":
+		options := []rcds.RCDSOption{rcds.WithHasher(hasher), rcds.WithSyncMode(config.mode), rcds.WithConnectionOptions(connOptions...)}
+		if config.base != "" {
+			base, err := os.ReadFile(config.base)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read the merge base, %v", err)
+			}
+			options = append(options, rcds.WithMergeBase(base))
+		}
+		if config.chunkDistance > 0 {
+			options = append(options, rcds.WithChunkDistance(config.chunkDistance))
+		}
+		if config.levelNum > 0 {
+			options = append(options, rcds.WithLevelNum(config.levelNum))
+		}
+		if len(config.partitionLevels) > 0 {
+			options = append(options, rcds.WithPartitionLevels(config.partitionLevels...))
+		}
+		// A single file is partitioned while streaming it instead of being loaded into memory.
+		if isRegularFile(config.input) {
+			return rcds.NewRCDSSetSyncFromFile(config.input, options...)
+		}
+		return rcds.NewRCDSSetSync(options...)
+	case "iblt":
+		return iblt.NewIBLTSetSync(iblt.WithSymmetricSetDiff(config.symmetricDiff), iblt.WithMaxSyncRetries(config.retries), iblt.WithHasher(hasher),
+			iblt.WithConnectionOptions(connOptions...))
+	case "cpi":
+		return cpi.NewCPISetSync(cpi.WithMaxDifference(config.symmetricDiff), cpi.WithHasher(hasher), cpi.WithConnectionOptions(connOptions...))
+	case "intercpi":
+		return cpi.NewInterCPISetSync(cpi.WithHasher(hasher), cpi.WithConnectionOptions(connOptions...))
+	case "full":
+		return full_sync.NewFullSetSync(full_sync.WithHasher(hasher), full_sync.WithConnectionOptions(connOptions...))
+	default:
+		return nil, fmt.Errorf("unsupported algorithm '%s'", config.algorithm)
+	}
+}
+
+// loadInput reads the file or every regular file under the directory at path and returns the elements to add to a
+// GenSync instance. Set reconciliation algorithms get one element per line while rcds gets the content of each file
+// as a single element, so files are concatenated in lexical path order.
+func loadInput(path, algorithm string) ([][]byte, error) {
+	var elems [][]byte
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if algorithm == "rcds" {
+			if len(content) > 0 {
+				elems = append(elems, content)
+			}
+			return nil
+		}
+		for _, line := range bytes.Split(content, []byte("\n")) {
+			if len(line) > 0 {
+				elems = append(elems, line)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load input from '%s', %v", path, err)
+	}
+	return elems, nil
+}
+
+// populate adds elements loaded from path to the GenSync instance.
+func populate(sync genSync.GenSync, path, algorithm string) (int, error) {
+	if path == "" {
+		return 0, nil
+	}
+	// newGenSync already reads a single file for rcds.
+	if algorithm == "rcds" && isRegularFile(path) {
+		return 1, nil
+	}
+	elems, err := loadInput(path, algorithm)
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range elems {
+		if err = sync.AddElement(e); err != nil {
+			return 0, fmt.Errorf("failed to add element, %v", err)
+		}
+	}
+	return len(elems), nil
+}
+
+func isRegularFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// writeOutput writes the reconciled local set to path. Set reconciliation algorithms write one element per line in
+// sorted order and rcds writes the reconciled string as it is.
+func writeOutput(sync genSync.GenSync, path string) error {
+	if doc, ok := sync.(rcds.Document); ok {
+		return writeDocument(doc, path)
+	}
+
+	var elems []string
+	for key, val := range *sync.GetLocalSet() {
+		// Hash based syncs key the set by digest and keep the literal element as the value.
+		if b, ok := val.([]byte); ok {
+			elems = append(elems, string(b))
+		} else {
+			elems = append(elems, fmt.Sprint(key))
+		}
+	}
+	sort.Strings(elems)
+
+	var buf bytes.Buffer
+	for _, e := range elems {
+		buf.WriteString(e)
+		buf.WriteByte('\n')
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write output to '%s', %v", path, err)
+	}
+	return nil
+}
+
+// writeDocument streams a reconciled string to a temporary file next to path and renames it over path. The string may
+// still be read from path, which is the case when the output is also the input of the sync.
+func writeDocument(doc rcds.Document, path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write output to '%s', %v", path, err)
+	}
+	fail := func(err error) error {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("failed to write output to '%s', %v", path, err)
+	}
+	if _, err = doc.WriteTo(f); err != nil {
+		return fail(err)
+	}
+	if err = f.Chmod(0644); err != nil {
+		return fail(err)
+	}
+	if err = f.Close(); err != nil {
+		return fail(err)
+	}
+	if err = os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("failed to write output to '%s', %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm"
+)
+
+func TestWriteOutput_OverInput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.txt")
+	content := strings.Repeat("a line of the document that is read back from the input file\n", 1000)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	// The rcds sync reads its string from the input file, which is still open while the output is written over it.
+	config := &networkConfig{algorithm: "rcds", input: path, hash: algorithm.FNVHasherName}
+	sync, err := newGenSync(config)
+	require.NoError(t, err)
+	require.NoError(t, writeOutput(sync, path))
+
+	written, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(written))
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
@@ -6,7 +6,8 @@ toolchain go1.24.10
 
 require (
 	github.com/SheldonZhong/go-IBLT v0.0.0-20190403023046-6d1c7939ba91
-	github.com/emirpasic/gods v1.18.1
+	github.com/cespare/xxhash/v2 v2.3.0
+	github.com/dchest/siphash v1.2.1
 	github.com/go-logr/zapr v1.3.0
 	github.com/sirupsen/logrus v1.9.3
 	github.com/stretchr/testify v1.11.1
@@ -18,7 +19,6 @@ require (
 
 require (
 	github.com/davecgh/go-spew v1.1.2-0.20180830191138-d8f796af33cc // indirect
-	github.com/dchest/siphash v1.2.1 // indirect
 	github.com/dgryski/go-metro v0.0.0-20200812162917-85c65e2d0165 // indirect
 	github.com/fxamacker/cbor/v2 v2.9.0 // indirect
 	github.com/go-logr/logr v1.4.3 // indirect
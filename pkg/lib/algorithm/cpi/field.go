@@ -0,0 +1,54 @@
+package cpi
+
+import "math/bits"
+
+// prime is the Mersenne prime 2^61-1 that defines the finite field of the characteristic polynomials.
+const prime uint64 = 1<<61 - 1
+
+// MaxDifferenceBound is the largest supported difference bound. Elements are hashed below the sample points, which are
+// taken from the top of the field, so that a sample point is never a root of a characteristic polynomial.
+const MaxDifferenceBound = 1 << 20
+
+// elementSpace is the size of the range of field values elements are hashed into.
+const elementSpace = prime - MaxDifferenceBound - 1
+
+func add(a, b uint64) uint64 {
+	s := a + b
+	if s >= prime {
+		s -= prime
+	}
+	return s
+}
+
+func sub(a, b uint64) uint64 {
+	if a >= b {
+		return a - b
+	}
+	return a + prime - b
+}
+
+func mul(a, b uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	return bits.Rem64(hi, lo, prime)
+}
+
+func pow(a, e uint64) uint64 {
+	res := uint64(1)
+	for ; e > 0; e >>= 1 {
+		if e&1 == 1 {
+			res = mul(res, a)
+		}
+		a = mul(a, a)
+	}
+	return res
+}
+
+// inv returns the multiplicative inverse of a non-zero element by Fermat's little theorem.
+func inv(a uint64) uint64 {
+	return pow(a, prime-2)
+}
+
+// samplePoint returns the i-th point at which characteristic polynomials are evaluated.
+func samplePoint(i int) uint64 {
+	return prime - 1 - uint64(i)
+}
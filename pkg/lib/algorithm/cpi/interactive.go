@@ -0,0 +1,214 @@
+package cpi
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/genSync"
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/set"
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/util"
+)
+
+const (
+	defaultInterBound      = 8
+	defaultInterPartitions = 2
+)
+
+// NewInterCPISetSync creates an interactive CPI sync, which does not need to know the difference bound in advance. Each
+// round runs CPI with a small bound on every open partition of the hash space, and the partitions whose difference
+// exceeds the bound are split into equal parts for the next round. The bound defaults to 8 and the number of
+// partitions to 2.
+func NewInterCPISetSync(option ...CPIOption) (genSync.GenSync, error) {
+	opt := cpiOptions{MaxDifference: defaultInterBound, Partitions: defaultInterPartitions}
+	opt.apply(option)
+	if err := opt.complete(); err != nil {
+		return nil, err
+	}
+	if opt.Partitions == 0 {
+		return nil, fmt.Errorf("interactive CPI needs at least 2 partitions")
+	}
+
+	return &cpiSync{
+		Set:         set.New(),
+		values:      make(map[uint64][]byte),
+		additionals: set.New(),
+		options:     opt,
+	}, nil
+}
+
+// valueRange is the partition [lo, hi) of the hash space.
+type valueRange struct {
+	lo uint64
+	hi uint64
+}
+
+// split divides the range into p parts of equal width, where the last part might be smaller.
+func (r valueRange) split(p int) []valueRange {
+	width := r.hi - r.lo
+	step := width / uint64(p)
+	if width%uint64(p) != 0 {
+		step++
+	}
+	var res []valueRange
+	for lo := r.lo; lo < r.hi; lo += step {
+		hi := lo + step
+		if hi > r.hi {
+			hi = r.hi
+		}
+		res = append(res, valueRange{lo: lo, hi: hi})
+	}
+	return res
+}
+
+func (r valueRange) contains(v uint64) bool {
+	return v >= r.lo && v < r.hi
+}
+
+// sortedValues returns the hashes of the local elements in ascending order.
+func (c *cpiSync) sortedValues() []uint64 {
+	res := make([]uint64, 0, len(c.values))
+	for v := range c.values {
+		res = append(res, v)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return res
+}
+
+// valuesIn returns the sorted values within the range.
+func valuesIn(sorted []uint64, r valueRange) []uint64 {
+	lo := sort.Search(len(sorted), func(i int) bool { return sorted[i] >= r.lo })
+	hi := sort.Search(len(sorted), func(i int) bool { return sorted[i] >= r.hi })
+	return sorted[lo:hi]
+}
+
+// splitFailed returns the parts of the failed partitions, or an error if a failed partition can not be split further.
+func (c *cpiSync) splitFailed(open []valueRange, failed []bool) ([]valueRange, error) {
+	var next []valueRange
+	for j, r := range open {
+		if !failed[j] {
+			continue
+		}
+		if r.hi-r.lo < 2 {
+			return nil, fmt.Errorf("partition [%d, %d) can not be split, %w", r.lo, r.hi, ErrBoundExceeded)
+		}
+		next = append(next, r.split(c.options.Partitions)...)
+	}
+	return next, nil
+}
+
+// interactiveClient sends the set size and the evaluations of every open partition each round, and splits the
+// partitions the server failed to reconcile until every partition succeeds.
+func (c *cpiSync) interactiveClient(conn genSync.Connection) error {
+	sorted := c.sortedValues()
+	open := []valueRange{{lo: 0, hi: elementSpace}}
+	for len(open) > 0 {
+		partitions := make([][]byte, len(open))
+		for j, r := range open {
+			values := valuesIn(sorted, r)
+			partitions[j] = append(util.IntToBytes(len(values)), valuesToBytes(evaluate(values, c.options.MaxDifference))...)
+		}
+		if _, err := conn.SendBytesSlice(partitions); err != nil {
+			return err
+		}
+		status, err := conn.Receive()
+		if err != nil {
+			return err
+		}
+		c.meter.EndRound()
+		if len(status) != len(open) {
+			return fmt.Errorf("sent %d partitions but received %d results", len(open), len(status))
+		}
+		failed := make([]bool, len(open))
+		for j := range status {
+			failed[j] = status[j] == genSync.SYNC_FAIL
+		}
+		if open, err = c.splitFailed(open, failed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// interactiveServer reconciles the partitions sent by the client each round and reports the partitions that failed,
+// which both sides split for the next round.
+func (c *cpiSync) interactiveServer(conn genSync.Connection) ([]uint64, []uint64, error) {
+	var clientOnly, serverOnly []uint64
+	sorted := c.sortedValues()
+	open := []valueRange{{lo: 0, hi: elementSpace}}
+	for len(open) > 0 {
+		partitions, err := conn.ReceiveBytesSlice()
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(partitions) != len(open) {
+			return nil, nil, fmt.Errorf("expecting %d partitions but received %d", len(open), len(partitions))
+		}
+
+		status := make([]byte, len(open))
+		failed := make([]bool, len(open))
+		for j, r := range open {
+			a, b, err := c.reconcilePartition(partitions[j], valuesIn(sorted, r), r)
+			if err != nil {
+				status[j], failed[j] = genSync.SYNC_FAIL, true
+				continue
+			}
+			status[j] = genSync.SYNC_SUCCESS
+			clientOnly = append(clientOnly, a...)
+			serverOnly = append(serverOnly, b...)
+		}
+		if _, err = conn.Send(status); err != nil {
+			return nil, nil, err
+		}
+		c.meter.EndRound()
+		if open, err = c.splitFailed(open, failed); err != nil {
+			return nil, nil, err
+		}
+	}
+	return clientOnly, serverOnly, nil
+}
+
+// reconcilePartition finds the differences of a partition from the client's encoded set size and evaluations. Any
+// difference outside the partition or not in the local set means the bound is exceeded.
+func (c *cpiSync) reconcilePartition(encoded []byte, values []uint64, r valueRange) ([]uint64, []uint64, error) {
+	if len(encoded) < 8 {
+		return nil, nil, fmt.Errorf("encoded partition should have at least 8 bytes but got %d", len(encoded))
+	}
+	clientEvals, err := bytesToValues(encoded[8:])
+	if err != nil {
+		return nil, nil, err
+	}
+	clientOnly, serverOnly, err := reconcile(clientEvals, evaluate(values, c.options.MaxDifference), util.BytesToInt(encoded[:8])-len(values))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, v := range clientOnly {
+		if !r.contains(v) {
+			return nil, nil, fmt.Errorf("interpolated element %d is outside of the partition, %w", v, ErrBoundExceeded)
+		}
+	}
+	for _, v := range serverOnly {
+		if _, isExist := c.values[v]; !isExist || !r.contains(v) {
+			return nil, nil, fmt.Errorf("interpolated element %d is not in the local partition, %w", v, ErrBoundExceeded)
+		}
+	}
+	return clientOnly, serverOnly, nil
+}
+
+func valuesToBytes(values []uint64) []byte {
+	b := make([]byte, 0, 8*len(values))
+	for _, v := range values {
+		b = append(b, util.Uint64ToBytes(v)...)
+	}
+	return b
+}
+
+func bytesToValues(b []byte) ([]uint64, error) {
+	if len(b)%8 != 0 {
+		return nil, fmt.Errorf("encoded values should be a multiple of 8 bytes but got %d", len(b))
+	}
+	values := make([]uint64, len(b)/8)
+	for i := range values {
+		values[i] = util.BytesToUint64(b[8*i : 8*i+8])
+	}
+	return values, nil
+}
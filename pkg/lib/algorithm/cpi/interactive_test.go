@@ -0,0 +1,91 @@
+package cpi
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/rand"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/set"
+)
+
+func TestValueRange_Split(t *testing.T) {
+	assert.Equal(t, []valueRange{{0, 4}, {4, 8}, {8, 10}}, valueRange{0, 10}.split(3))
+	assert.Equal(t, []valueRange{{5, 6}, {6, 7}}, valueRange{5, 7}.split(4))
+	assert.Equal(t, []uint64{3, 5}, valuesIn([]uint64{1, 3, 5, 9}, valueRange{2, 9}))
+}
+
+func TestInterCPISync(t *testing.T) {
+	rand.Seed(7)
+	tests := []struct {
+		serverSetSize    int
+		clientSetSize    int
+		intersectionSize int
+		options          []CPIOption
+	}{
+		{serverSetSize: 10, clientSetSize: 10, intersectionSize: 9},
+		{serverSetSize: 500, clientSetSize: 450, intersectionSize: 400, options: []CPIOption{WithPartitions(4)}},
+		{serverSetSize: 100, clientSetSize: 0, intersectionSize: 0, options: []CPIOption{WithMaxDifference(4), WithPartitions(3)}},
+	}
+	for _, tt := range tests {
+		t.Logf("New Pair test with %+v", tt)
+		server, err := NewInterCPISetSync(tt.options...)
+		require.NoError(t, err)
+		client, err := NewInterCPISetSync(tt.options...)
+		require.NoError(t, err)
+
+		expectedClientExtra := set.New()
+		expectedServerExtra := set.New()
+		for i := 0; i < tt.intersectionSize; i++ {
+			td := []byte(rand.String(20))
+			require.NoError(t, server.AddElement(td))
+			require.NoError(t, client.AddElement(td))
+		}
+		for i := 0; i < tt.clientSetSize-tt.intersectionSize; i++ {
+			td := []byte(rand.String(20))
+			require.NoError(t, client.AddElement(td))
+			expectedClientExtra.InsertKey(td)
+		}
+		for i := 0; i < tt.serverSetSize-tt.intersectionSize; i++ {
+			td := []byte(rand.String(20))
+			require.NoError(t, server.AddElement(td))
+			expectedServerExtra.InsertKey(td)
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, server.SyncServer("", 8102))
+		}()
+		assert.NoError(t, client.SyncClient("", 8102))
+		wg.Wait()
+
+		assert.EqualValues(t, *expectedClientExtra, *server.GetSetAdditions())
+		assert.EqualValues(t, *expectedServerExtra, *client.GetSetAdditions())
+		assert.EqualValues(t, *server.GetLocalSet(), *client.GetLocalSet())
+		assert.Equal(t, server.GetTotalBytes(), client.GetTotalBytes())
+
+		// The rounds add up to the total bytes and mirror each other on both sides.
+		clientRounds := client.Stats().Rounds
+		serverRounds := server.Stats().Rounds
+		require.Equal(t, len(clientRounds), len(serverRounds))
+		var total int
+		for i, r := range clientRounds {
+			assert.Equal(t, r.Sent, serverRounds[i].Received)
+			assert.Equal(t, r.Received, serverRounds[i].Sent)
+			total += r.Sent + r.Received
+		}
+		assert.Equal(t, client.GetTotalBytes(), total)
+		t.Logf("synced in %d rounds with %d bytes", len(clientRounds), total)
+	}
+}
+
+func TestNewInterCPISetSync(t *testing.T) {
+	_, err := NewInterCPISetSync(WithPartitions(1))
+	assert.Error(t, err)
+	_, err = NewCPISetSync(WithMaxDifference(4), WithPartitions(2))
+	assert.Error(t, err)
+}
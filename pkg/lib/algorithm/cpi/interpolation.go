@@ -0,0 +1,164 @@
+package cpi
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+)
+
+// ErrBoundExceeded signals that the set difference is larger than the difference bound, in which case the rational
+// function can not be interpolated from the sample points.
+var ErrBoundExceeded = errors.New("set difference exceeds the difference bound")
+
+// evaluate returns the characteristic polynomial of the values at the first bound+1 sample points.
+func evaluate(values []uint64, bound int) []uint64 {
+	evals := make([]uint64, bound+1)
+	for i := range evals {
+		z := samplePoint(i)
+		evals[i] = 1
+		for _, v := range values {
+			evals[i] = mul(evals[i], sub(z, v))
+		}
+	}
+	return evals
+}
+
+// reconcile recovers the set differences from the evaluations of the characteristic polynomials of the client set A
+// and the server set B at the same sample points and the size difference |A| - |B|. The ratio of the evaluations is a
+// rational function whose numerator and denominator are the characteristic polynomials of A-B and B-A. It returns
+// the field values of A-B and B-A, or an error wrapping ErrBoundExceeded if the difference is larger than the bound.
+func reconcile(clientEvals, serverEvals []uint64, sizeDiff int) (clientOnly, serverOnly []uint64, err error) {
+	if len(clientEvals) != len(serverEvals) || len(clientEvals) < 1 {
+		return nil, nil, fmt.Errorf("expecting the same number of evaluations but got %d and %d", len(clientEvals), len(serverEvals))
+	}
+	ratios := make([]uint64, len(serverEvals))
+	for i := range ratios {
+		ratios[i] = mul(clientEvals[i], inv(serverEvals[i]))
+	}
+
+	numerator, denominator, err := interpolate(ratios, sizeDiff)
+	if err != nil {
+		return nil, nil, err
+	}
+	g := gcd(numerator, denominator)
+	numerator, _ = numerator.divMod(g)
+	denominator, _ = denominator.divMod(g)
+
+	// Every difference is a distinct element hashed below the sample points, any other root means the interpolation
+	// found a wrong rational function.
+	rnd := rand.New(rand.NewSource(int64(sizeDiff)))
+	if clientOnly, err = numerator.roots(rnd); err != nil {
+		return nil, nil, fmt.Errorf("%v, %w", err, ErrBoundExceeded)
+	}
+	if serverOnly, err = denominator.roots(rnd); err != nil {
+		return nil, nil, fmt.Errorf("%v, %w", err, ErrBoundExceeded)
+	}
+	for _, v := range append(append([]uint64{}, clientOnly...), serverOnly...) {
+		if v >= elementSpace {
+			return nil, nil, fmt.Errorf("root %d is outside of the element space, %w", v, ErrBoundExceeded)
+		}
+	}
+	return clientOnly, serverOnly, nil
+}
+
+// interpolate finds monic polynomials P and Q with P(z) = f(z)Q(z) at the sample points, where the degree difference
+// of P and Q is the size difference. With a bound m, the degrees add up to m or m-1 depending on the parity of the
+// size difference, and the remaining sample points verify the result. Any solution of the linear system equals the
+// reduced rational function times a common factor as long as the difference does not exceed the bound.
+func interpolate(ratios []uint64, sizeDiff int) (polynomial, polynomial, error) {
+	bound := len(ratios) - 1
+	if sizeDiff > bound || -sizeDiff > bound {
+		return nil, nil, fmt.Errorf("size difference %d is larger than the bound %d, %w", sizeDiff, bound, ErrBoundExceeded)
+	}
+	m := bound
+	if (m-sizeDiff)%2 != 0 {
+		m--
+	}
+	degP, degQ := (m+sizeDiff)/2, (m-sizeDiff)/2
+
+	// Unknowns are the non-leading coefficients of P followed by those of Q:
+	// sum p_j z^j - f sum q_j z^j = f z^degQ - z^degP.
+	rows := make([][]uint64, m)
+	for i := range rows {
+		z, f := samplePoint(i), ratios[i]
+		row := make([]uint64, m+1)
+		zj := uint64(1)
+		for j := 0; j < degP; j++ {
+			row[j] = zj
+			zj = mul(zj, z)
+		}
+		zDegP := zj
+		zj = 1
+		for j := 0; j < degQ; j++ {
+			row[degP+j] = sub(0, mul(f, zj))
+			zj = mul(zj, z)
+		}
+		row[m] = sub(mul(f, zj), zDegP)
+		rows[i] = row
+	}
+	solution, err := solveLinearSystem(rows, m)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p := make(polynomial, degP+1)
+	copy(p, solution[:degP])
+	p[degP] = 1
+	q := make(polynomial, degQ+1)
+	copy(q, solution[degP:])
+	q[degQ] = 1
+
+	for i := m; i <= bound; i++ {
+		z := samplePoint(i)
+		if p.eval(z) != mul(ratios[i], q.eval(z)) {
+			return nil, nil, fmt.Errorf("interpolated rational function does not match sample point %d, %w", i, ErrBoundExceeded)
+		}
+	}
+	return p, q, nil
+}
+
+// solveLinearSystem solves the augmented n x (n+1) matrix by Gaussian elimination. Free variables are set to zero and
+// inconsistent systems fail with ErrBoundExceeded.
+func solveLinearSystem(rows [][]uint64, n int) ([]uint64, error) {
+	pivotCols := make([]int, 0, n)
+	r := 0
+	for c := 0; c < n && r < len(rows); c++ {
+		pivot := -1
+		for i := r; i < len(rows); i++ {
+			if rows[i][c] != 0 {
+				pivot = i
+				break
+			}
+		}
+		if pivot < 0 {
+			continue
+		}
+		rows[r], rows[pivot] = rows[pivot], rows[r]
+		scale := inv(rows[r][c])
+		for j := c; j <= n; j++ {
+			rows[r][j] = mul(rows[r][j], scale)
+		}
+		for i := range rows {
+			if i == r || rows[i][c] == 0 {
+				continue
+			}
+			factor := rows[i][c]
+			for j := c; j <= n; j++ {
+				rows[i][j] = sub(rows[i][j], mul(factor, rows[r][j]))
+			}
+		}
+		pivotCols = append(pivotCols, c)
+		r++
+	}
+	for i := r; i < len(rows); i++ {
+		if rows[i][n] != 0 {
+			return nil, fmt.Errorf("sample points are inconsistent, %w", ErrBoundExceeded)
+		}
+	}
+
+	solution := make([]uint64, n)
+	for i, c := range pivotCols {
+		solution[c] = rows[i][n]
+	}
+	return solution, nil
+}
@@ -0,0 +1,55 @@
+package cpi
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		name       string
+		shared     []uint64
+		clientOnly []uint64
+		serverOnly []uint64
+		bound      int
+	}{
+		{name: "same sets", shared: []uint64{1, 2, 3}, bound: 4},
+		{name: "client only", shared: []uint64{1, 2}, clientOnly: []uint64{10, 11, 12}, bound: 3},
+		{name: "server only", shared: []uint64{1, 2}, serverOnly: []uint64{10}, bound: 5},
+		{name: "both sides", shared: []uint64{5, 6, 7, 8}, clientOnly: []uint64{100, 200}, serverOnly: []uint64{300, 400, 500}, bound: 5},
+		{name: "empty client", serverOnly: []uint64{1, 2, 3}, bound: 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientEvals := evaluate(append(append([]uint64{}, tt.shared...), tt.clientOnly...), tt.bound)
+			serverEvals := evaluate(append(append([]uint64{}, tt.shared...), tt.serverOnly...), tt.bound)
+			clientOnly, serverOnly, err := reconcile(clientEvals, serverEvals, len(tt.clientOnly)-len(tt.serverOnly))
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.clientOnly, clientOnly)
+			assert.ElementsMatch(t, tt.serverOnly, serverOnly)
+		})
+	}
+}
+
+func TestReconcile_BoundExceeded(t *testing.T) {
+	client := []uint64{1, 2, 3, 4, 5, 6}
+	server := []uint64{7, 8, 9}
+	_, _, err := reconcile(evaluate(client, 4), evaluate(server, 4), len(client)-len(server))
+	assert.True(t, errors.Is(err, ErrBoundExceeded))
+
+	// The size difference is within the bound but the symmetric difference is not.
+	_, _, err = reconcile(evaluate(client[:3], 4), evaluate(server, 4), 0)
+	assert.True(t, errors.Is(err, ErrBoundExceeded))
+}
+
+func TestEvaluate(t *testing.T) {
+	values := []uint64{3, 1, 4, 1 << 50}
+	f := fromRoots(values)
+	evals := evaluate(values, 3)
+	for i, e := range evals {
+		assert.Equal(t, f.eval(samplePoint(i)), e)
+	}
+}
@@ -0,0 +1,79 @@
+package cpi
+
+import (
+	"fmt"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm"
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/genSync"
+)
+
+type cpiOptions struct {
+	MaxDifference int // upper bound of the symmetric set difference |A-B| + |B-A|, which is the number of sample points used. (required)
+	Partitions    int // number of partitions a failed interactive CPI round splits into. (interactive CPI only)
+
+	hasher      algorithm.Hasher           // hashes the set digest and the elements into field values, negotiated before the parameters are compared. (default at FNV)
+	connOptions []genSync.ConnectionOption // options of the connections SyncClient and SyncServer open, such as TLS.
+}
+
+func (c *cpiOptions) apply(options []CPIOption) {
+	for _, option := range options {
+		option(c)
+	}
+}
+
+func (c *cpiOptions) complete() error {
+	if c.MaxDifference <= 0 {
+		return fmt.Errorf("difference bound should be positive")
+	}
+	if c.MaxDifference > MaxDifferenceBound {
+		return fmt.Errorf("difference bound %d exceeds the maximum of %d", c.MaxDifference, MaxDifferenceBound)
+	}
+	if c.Partitions != 0 && c.Partitions < 2 {
+		return fmt.Errorf("number of partitions should be at least 2")
+	}
+	if c.hasher == nil {
+		c.hasher = algorithm.DefaultHasher
+	}
+	return nil
+}
+
+// syncType is interactive CPI if a failed round splits into partitions.
+func (c *cpiOptions) syncType() algorithm.SyncType {
+	if c.Partitions > 0 {
+		return algorithm.InterCPI
+	}
+	return algorithm.CPI
+}
+
+type CPIOption func(option *cpiOptions)
+
+// WithMaxDifference sets the bound of the symmetric set difference. A sync fails with ErrBoundExceeded if the
+// difference is larger than the bound.
+func WithMaxDifference(bound int) CPIOption {
+	return func(option *cpiOptions) {
+		option.MaxDifference = bound
+	}
+}
+
+// WithPartitions sets the number of partitions interactive CPI splits the hash space into when the difference of a
+// partition exceeds the bound.
+func WithPartitions(p int) CPIOption {
+	return func(option *cpiOptions) {
+		option.Partitions = p
+	}
+}
+
+// WithHasher sets the hash function of the set digest and the field values of the elements. Both peers must use the
+// same hasher.
+func WithHasher(hasher algorithm.Hasher) CPIOption {
+	return func(option *cpiOptions) {
+		option.hasher = hasher
+	}
+}
+
+// WithConnectionOptions sets the options of the connections SyncClient and SyncServer open, such as WithTLS.
+func WithConnectionOptions(option ...genSync.ConnectionOption) CPIOption {
+	return func(options *cpiOptions) {
+		options.connOptions = option
+	}
+}
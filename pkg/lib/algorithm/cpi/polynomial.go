@@ -0,0 +1,160 @@
+package cpi
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// polynomial over the prime field with the coefficient of x^i at index i. A normalized polynomial has no leading zero
+// coefficients, so the zero polynomial is empty.
+type polynomial []uint64
+
+func (f polynomial) trim() polynomial {
+	for len(f) > 0 && f[len(f)-1] == 0 {
+		f = f[:len(f)-1]
+	}
+	return f
+}
+
+// degree returns the degree of the polynomial, which is -1 for the zero polynomial.
+func (f polynomial) degree() int {
+	return len(f.trim()) - 1
+}
+
+func (f polynomial) eval(x uint64) uint64 {
+	res := uint64(0)
+	for i := len(f) - 1; i >= 0; i-- {
+		res = add(mul(res, x), f[i])
+	}
+	return res
+}
+
+func (f polynomial) sub(g polynomial) polynomial {
+	n := len(f)
+	if len(g) > n {
+		n = len(g)
+	}
+	res := make(polynomial, n)
+	copy(res, f)
+	for i, c := range g {
+		res[i] = sub(res[i], c)
+	}
+	return res.trim()
+}
+
+func (f polynomial) mul(g polynomial) polynomial {
+	if len(f) == 0 || len(g) == 0 {
+		return nil
+	}
+	res := make(polynomial, len(f)+len(g)-1)
+	for i, a := range f {
+		for j, b := range g {
+			res[i+j] = add(res[i+j], mul(a, b))
+		}
+	}
+	return res.trim()
+}
+
+// divMod returns the quotient and remainder of f divided by a non-zero polynomial g.
+func (f polynomial) divMod(g polynomial) (polynomial, polynomial) {
+	f, g = f.trim(), g.trim()
+	if len(g) == 0 {
+		panic("polynomial division by zero")
+	}
+	if len(f) < len(g) {
+		return nil, append(polynomial(nil), f...)
+	}
+	rem := append(polynomial(nil), f...)
+	quo := make(polynomial, len(f)-len(g)+1)
+	leadInv := inv(g[len(g)-1])
+	for i := len(rem) - len(g); i >= 0; i-- {
+		c := mul(rem[i+len(g)-1], leadInv)
+		quo[i] = c
+		if c == 0 {
+			continue
+		}
+		for j, b := range g {
+			rem[i+j] = sub(rem[i+j], mul(c, b))
+		}
+	}
+	return quo.trim(), rem[:len(g)-1].trim()
+}
+
+// monic scales the polynomial so that its leading coefficient is one.
+func (f polynomial) monic() polynomial {
+	f = f.trim()
+	if len(f) == 0 {
+		return nil
+	}
+	leadInv := inv(f[len(f)-1])
+	res := make(polynomial, len(f))
+	for i, c := range f {
+		res[i] = mul(c, leadInv)
+	}
+	return res
+}
+
+// gcd returns the monic greatest common divisor of f and g.
+func gcd(f, g polynomial) polynomial {
+	f, g = f.trim(), g.trim()
+	for len(g) > 0 {
+		_, r := f.divMod(g)
+		f, g = g, r
+	}
+	return f.monic()
+}
+
+// powMod returns f^e mod m.
+func powMod(f polynomial, e uint64, m polynomial) polynomial {
+	res := polynomial{1}
+	_, base := f.divMod(m)
+	for ; e > 0; e >>= 1 {
+		if e&1 == 1 {
+			_, res = res.mul(base).divMod(m)
+		}
+		_, base = base.mul(base).divMod(m)
+	}
+	_, res = res.divMod(m)
+	return res
+}
+
+// fromRoots returns the monic polynomial whose roots are the values, which is the characteristic polynomial of the
+// set of values.
+func fromRoots(values []uint64) polynomial {
+	res := polynomial{1}
+	for _, v := range values {
+		res = res.mul(polynomial{sub(0, v), 1})
+	}
+	return res
+}
+
+// roots returns the roots of a polynomial that is a product of distinct linear factors, and fails otherwise.
+func (f polynomial) roots(rnd *rand.Rand) ([]uint64, error) {
+	f = f.monic()
+	if f.degree() < 1 {
+		return nil, nil
+	}
+	// f divides x^p - x if and only if it splits into distinct linear factors.
+	x := polynomial{0, 1}
+	if _, r := powMod(x, prime, f).sub(x).divMod(f); r.degree() >= 0 {
+		return nil, fmt.Errorf("polynomial of degree %d does not split into distinct linear factors", f.degree())
+	}
+	return splitRoots(f, rnd), nil
+}
+
+// splitRoots finds the roots of a monic polynomial with distinct roots by equal-degree factorization, where
+// gcd(f, (x+a)^((p-1)/2) - 1) separates the roots r with r+a being a quadratic residue from the others.
+func splitRoots(f polynomial, rnd *rand.Rand) []uint64 {
+	if f.degree() == 1 {
+		return []uint64{sub(0, f[0])}
+	}
+	for {
+		a := rnd.Uint64() % prime
+		h := powMod(polynomial{a, 1}, (prime-1)/2, f).sub(polynomial{1})
+		g := gcd(f, h)
+		if d := g.degree(); d > 0 && d < f.degree() {
+			q, _ := f.divMod(g)
+			return append(splitRoots(g, rnd), splitRoots(q.monic(), rnd)...)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package cpi
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestField(t *testing.T) {
+	assert.Equal(t, uint64(0), add(prime-1, 1))
+	assert.Equal(t, prime-1, sub(0, 1))
+	assert.Equal(t, uint64(1), mul(prime-1, prime-1))
+	for _, a := range []uint64{1, 2, 12345, prime - 2} {
+		assert.Equal(t, uint64(1), mul(a, inv(a)))
+	}
+}
+
+func TestPolynomial_DivMod(t *testing.T) {
+	f := fromRoots([]uint64{1, 2, 3})
+	g := fromRoots([]uint64{2, 5})
+	q, r := f.mul(g).add1().divMod(g)
+	assert.Equal(t, f, q)
+	assert.Equal(t, polynomial{1}, r)
+
+	assert.Equal(t, fromRoots([]uint64{2}), gcd(f, g))
+	assert.Equal(t, polynomial{1}, gcd(f, fromRoots([]uint64{7})))
+}
+
+func TestPolynomial_Roots(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	values := []uint64{0, 1, 42, prime - 2, 1 << 40, 987654321}
+	roots, err := fromRoots(values).roots(rnd)
+	require.NoError(t, err)
+	sort.Slice(roots, func(i, j int) bool { return roots[i] < roots[j] })
+	expected := append([]uint64{}, values...)
+	sort.Slice(expected, func(i, j int) bool { return expected[i] < expected[j] })
+	assert.Equal(t, expected, roots)
+
+	// Repeated roots and irreducible factors are rejected.
+	_, err = fromRoots([]uint64{3, 3}).roots(rnd)
+	assert.Error(t, err)
+	_, err = polynomial{1, 0, 1}.mul(polynomial{1, 0, 1}).roots(rnd)
+	assert.Error(t, err)
+}
+
+// add1 adds one to the constant coefficient.
+func (f polynomial) add1() polynomial {
+	res := append(polynomial{}, f...)
+	res[0] = add(res[0], 1)
+	return res
+}
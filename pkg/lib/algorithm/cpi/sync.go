@@ -0,0 +1,451 @@
+package cpi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm"
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/genSync"
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/set"
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/util"
+)
+
+// cpiSync reconciles sets by characteristic polynomial interpolation. Each element is hashed into the prime field and
+// the characteristic polynomial of the set is kept evaluated at the sample points, which is all the client sends to
+// the server. The server interpolates the ratio of the two characteristic polynomials and factors it into the hashes
+// of the differences, after which the literal elements are exchanged.
+type cpiSync struct {
+	*set.Set
+	values        map[uint64][]byte
+	evals         []uint64
+	additionals   *set.Set
+	FreezeLocal   bool
+	SentBytes     int
+	ReceivedBytes int
+	options       cpiOptions
+	meter         *genSync.Meter // accounts the phases and the rounds of the running sync.
+	stats         genSync.Stats
+}
+
+func NewCPISetSync(option ...CPIOption) (genSync.GenSync, error) {
+	opt := cpiOptions{}
+	opt.apply(option)
+	if err := opt.complete(); err != nil {
+		return nil, err
+	}
+	if opt.Partitions != 0 {
+		return nil, fmt.Errorf("partitions are only used by interactive CPI")
+	}
+
+	return &cpiSync{
+		Set:           set.New(),
+		values:        make(map[uint64][]byte),
+		evals:         evaluate(nil, opt.MaxDifference),
+		additionals:   set.New(),
+		SentBytes:     0,
+		ReceivedBytes: 0,
+		FreezeLocal:   false,
+		options:       opt,
+	}, nil
+}
+
+func (c *cpiSync) SetFreezeLocal(freezeLocal bool) {
+	c.FreezeLocal = freezeLocal
+}
+
+// AddElement adds the element and multiplies its linear factor into the evaluations.
+func (c *cpiSync) AddElement(elem interface{}) error {
+	b, ok := elem.([]byte)
+	if !ok {
+		return fmt.Errorf("cpi only accepts []byte elements")
+	}
+	v, err := toFieldValue(b, c.options.hasher)
+	if err != nil {
+		return err
+	}
+	if existing, isExist := c.values[v]; isExist {
+		if string(existing) != string(b) {
+			return fmt.Errorf("hash collision for elements '%s' and '%s'", existing, b)
+		}
+		return nil
+	}
+
+	c.values[v] = b
+	c.Set.InsertKey(b)
+	for i := range c.evals {
+		c.evals[i] = mul(c.evals[i], sub(samplePoint(i), v))
+	}
+	return nil
+}
+
+// DeleteElement removes the element and divides its linear factor out of the evaluations.
+func (c *cpiSync) DeleteElement(elem interface{}) error {
+	b, ok := elem.([]byte)
+	if !ok {
+		return fmt.Errorf("cpi only accepts []byte elements")
+	}
+	v, err := toFieldValue(b, c.options.hasher)
+	if err != nil {
+		return err
+	}
+	if _, isExist := c.values[v]; !isExist {
+		return nil
+	}
+
+	delete(c.values, v)
+	c.Set.Remove(b)
+	for i := range c.evals {
+		c.evals[i] = mul(c.evals[i], inv(sub(samplePoint(i), v)))
+	}
+	return nil
+}
+
+func (c *cpiSync) SyncClient(ip string, port int) error {
+	return c.SyncClientContext(context.Background(), ip, port)
+}
+
+// SyncClientContext runs SyncClient until the context is done.
+func (c *cpiSync) SyncClientContext(ctx context.Context, ip string, port int) error {
+	client, err := genSync.NewTcpConnection(ip, port, c.options.connOptions...)
+	if err != nil {
+		return err
+	}
+	if err = client.ConnectContext(ctx); err != nil {
+		return err
+	}
+	defer client.Close()
+	return genSync.RunContext(ctx, client, c.SyncClientConn)
+}
+
+// SyncClientConn runs the client side of SyncClient over an established connection.
+func (c *cpiSync) SyncClientConn(client genSync.Connection) error {
+	// refresh additionals at each sync session.
+	c.additionals = set.New()
+
+	meter := genSync.NewMeter(client)
+	c.meter = meter
+	defer func() {
+		c.stats = meter.Stop()
+		c.SentBytes, c.ReceivedBytes = c.stats.SentBytes, c.stats.ReceivedBytes
+	}()
+
+	meter.Start(genSync.PhaseHandshake)
+	handshake, err := genSync.NewHandshake(c.options.syncType(), c.options.hasher, c.options)
+	if err != nil {
+		return err
+	}
+	if err = genSync.HandshakeClient(client, handshake); err != nil {
+		return err
+	}
+
+	meter.Start(genSync.PhaseDigest)
+
+	// Compare digest of the remote and local set
+	digest, err := c.Set.GetDigest(c.options.hasher)
+	if err != nil {
+		return err
+	}
+	serverDigest, err := client.Receive()
+	if err != nil {
+		return err
+	}
+	isSame := util.BytesToUint64(serverDigest) == digest
+	if err = client.SendSkipSyncBoolWithInfo(isSame, "No sync operation necessary, local and remote digests are the same."); err != nil {
+		return err
+	}
+	if isSame {
+		return nil
+	}
+
+	meter.EndRound()
+	meter.Start(genSync.PhaseTable)
+	if c.options.Partitions > 0 {
+		err = c.interactiveClient(client)
+	} else {
+		err = c.differenceClient(client)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Send the elements the server is missing unless the server is freezing its local set.
+	meter.Start(genSync.PhaseLiteral)
+	if skipSync, err := client.ReceiveSkipSyncBoolWithInfo("Server is freezing local set."); err != nil {
+		return err
+	} else if !skipSync {
+		requests, err := client.ReceiveBytesSlice()
+		if err != nil {
+			return err
+		}
+		elems := make([][]byte, len(requests))
+		for j, req := range requests {
+			elem, isExist := c.values[util.BytesToUint64(req)]
+			if !isExist {
+				return fmt.Errorf("server requests element %d which is not in the local set", util.BytesToUint64(req))
+			}
+			elems[j] = elem
+		}
+		if _, err = client.SendBytesSlice(elems); err != nil {
+			return err
+		}
+	}
+
+	// Skip updating local set if set to frozen
+	if err = client.SendSkipSyncBoolWithInfo(c.FreezeLocal, "Client is freezing local set and skipping set update."); err != nil {
+		return err
+	}
+	if c.FreezeLocal {
+		return nil
+	}
+
+	// Receive differences
+	diffElem, err := client.ReceiveBytesSlice()
+	if err != nil {
+		return err
+	}
+	for _, d := range diffElem {
+		c.additionals.InsertKey(d)
+		if err = c.AddElement(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *cpiSync) SyncServer(ip string, port int) error {
+	return c.SyncServerContext(context.Background(), ip, port)
+}
+
+// SyncServerContext runs SyncServer until the context is done.
+func (c *cpiSync) SyncServerContext(ctx context.Context, ip string, port int) error {
+	server, err := genSync.NewTcpConnection(ip, port, c.options.connOptions...)
+	if err != nil {
+		return err
+	}
+	if err = server.ListenContext(ctx); err != nil {
+		return err
+	}
+	defer server.Close()
+	return genSync.RunContext(ctx, server, c.SyncServerConn)
+}
+
+// SyncServerConn runs the server side of SyncServer over an established connection.
+func (c *cpiSync) SyncServerConn(server genSync.Connection) error {
+	// refresh additionals at each sync session.
+	c.additionals = set.New()
+
+	meter := genSync.NewMeter(server)
+	c.meter = meter
+	defer func() {
+		c.stats = meter.Stop()
+		c.SentBytes, c.ReceivedBytes = c.stats.SentBytes, c.stats.ReceivedBytes
+	}()
+
+	meter.Start(genSync.PhaseHandshake)
+	handshake, err := genSync.NewHandshake(c.options.syncType(), c.options.hasher, c.options)
+	if err != nil {
+		return err
+	}
+	if err = genSync.HandshakeServer(server, handshake); err != nil {
+		return err
+	}
+
+	meter.Start(genSync.PhaseDigest)
+
+	digest, err := c.Set.GetDigest(c.options.hasher)
+	if err != nil {
+		return err
+	}
+
+	// Compare digest of the remote and local set
+	if _, err = server.Send(util.Uint64ToBytes(digest)); err != nil {
+		return err
+	}
+	if skipSync, err := server.ReceiveSkipSyncBoolWithInfo("No sync operation necessary, local and remote digests are the same."); err != nil {
+		return err
+	} else if skipSync {
+		return nil
+	}
+
+	meter.EndRound()
+	meter.Start(genSync.PhaseTable)
+	var clientOnly, serverOnly []uint64
+	if c.options.Partitions > 0 {
+		clientOnly, serverOnly, err = c.interactiveServer(server)
+	} else {
+		clientOnly, serverOnly, err = c.differenceServer(server)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Request the elements only the client has.
+	meter.Start(genSync.PhaseLiteral)
+	if err = server.SendSkipSyncBoolWithInfo(c.FreezeLocal, "Server is freezing local set."); err != nil {
+		return err
+	}
+	if !c.FreezeLocal {
+		if _, err = server.SendBytesSlice(valuesToBytesSlice(clientOnly)); err != nil {
+			return err
+		}
+		diffElem, err := server.ReceiveBytesSlice()
+		if err != nil {
+			return err
+		}
+		if len(diffElem) != len(clientOnly) {
+			return fmt.Errorf("requested %d elements from client but received %d", len(clientOnly), len(diffElem))
+		}
+		for j, d := range diffElem {
+			if v, err := toFieldValue(d, c.options.hasher); err != nil {
+				return err
+			} else if v != clientOnly[j] {
+				return fmt.Errorf("received element does not match the requested element %d", clientOnly[j])
+			}
+			c.additionals.InsertKey(d)
+			if err = c.AddElement(d); err != nil {
+				return err
+			}
+		}
+	} else {
+		logrus.Info("Server is freezing local set and skipping set update.")
+	}
+
+	if skipSync, err := server.ReceiveSkipSyncBoolWithInfo("Client is freezing local, skipping the rest of the sync..."); err != nil {
+		return err
+	} else if skipSync {
+		return nil
+	}
+
+	// Send diff from server - client to client
+	diffElem := make([][]byte, len(serverOnly))
+	for j, v := range serverOnly {
+		diffElem[j] = c.values[v]
+	}
+	_, err = server.SendBytesSlice(diffElem)
+	return err
+}
+
+// Snapshot copies the local set and its evaluations for a session of a genSync.Server.
+func (c *cpiSync) Snapshot() (genSync.GenSync, error) {
+	values := make(map[uint64][]byte, len(c.values))
+	for v, elem := range c.values {
+		values[v] = elem
+	}
+	return &cpiSync{
+		Set:         c.Set.Union(set.New()),
+		values:      values,
+		evals:       append([]uint64(nil), c.evals...),
+		additionals: set.New(),
+		FreezeLocal: c.FreezeLocal,
+		options:     c.options,
+	}, nil
+}
+
+// Apply adds the elements a session received to the local set.
+func (c *cpiSync) Apply(session genSync.GenSync) error {
+	for elem := range *session.GetSetAdditions() {
+		if err := c.AddElement([]byte(fmt.Sprint(elem))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *cpiSync) GetLocalSet() *set.Set {
+	return c.Set
+}
+
+func (c *cpiSync) GetSetAdditions() *set.Set {
+	return c.additionals
+}
+
+func (c *cpiSync) GetSentBytes() int {
+	return c.SentBytes
+}
+
+func (c *cpiSync) GetReceivedBytes() int {
+	return c.ReceivedBytes
+}
+
+// Stats returns the traffic of the last sync.
+func (c *cpiSync) Stats() genSync.Stats {
+	return c.stats
+}
+
+func (c *cpiSync) GetTotalBytes() int {
+	return c.ReceivedBytes + c.SentBytes
+}
+
+// differenceClient sends the set size and the evaluations of the characteristic polynomial to the server, which finds
+// the differences.
+func (c *cpiSync) differenceClient(conn genSync.Connection) error {
+	if _, err := conn.Send(util.IntToBytes(len(c.values))); err != nil {
+		return err
+	}
+	if _, err := conn.SendBytesSlice(valuesToBytesSlice(c.evals)); err != nil {
+		return err
+	}
+	failed, err := conn.ReceiveSkipSyncBoolWithInfo("Server failed to interpolate the characteristic polynomials.")
+	if err != nil {
+		return err
+	}
+	c.meter.EndRound()
+	if failed {
+		return fmt.Errorf("error reconciling sets with difference bound %d, %w", c.options.MaxDifference, ErrBoundExceeded)
+	}
+	return nil
+}
+
+// differenceServer interpolates the ratio of the characteristic polynomials to find the differences and signals the
+// client whether it succeeded.
+func (c *cpiSync) differenceServer(conn genSync.Connection) ([]uint64, []uint64, error) {
+	sizeBuf, err := conn.Receive()
+	if err != nil {
+		return nil, nil, err
+	}
+	evalBuf, err := conn.ReceiveBytesSlice()
+	if err != nil {
+		return nil, nil, err
+	}
+	clientOnly, serverOnly, err := reconcile(bytesSliceToValues(evalBuf), c.evals, util.BytesToInt(sizeBuf)-len(c.values))
+	for _, v := range serverOnly {
+		if _, isExist := c.values[v]; !isExist && err == nil {
+			err = fmt.Errorf("interpolated element %d is not in the local set, %w", v, ErrBoundExceeded)
+		}
+	}
+	if statusErr := conn.SendSkipSyncBoolWithInfo(err != nil, "Server failed to interpolate the characteristic polynomials."); statusErr != nil {
+		return nil, nil, statusErr
+	}
+	c.meter.EndRound()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reconciling sets with difference bound %d, %w", c.options.MaxDifference, err)
+	}
+	return clientOnly, serverOnly, nil
+}
+
+// toFieldValue hashes an element with the hasher into the field below the sample points.
+func toFieldValue(elem []byte, hasher algorithm.Hasher) (uint64, error) {
+	h, err := algorithm.HashString(string(elem)).ToUint64With(hasher)
+	if err != nil {
+		return 0, err
+	}
+	return h % elementSpace, nil
+}
+
+func valuesToBytesSlice(values []uint64) [][]byte {
+	res := make([][]byte, len(values))
+	for i, v := range values {
+		res[i] = util.Uint64ToBytes(v)
+	}
+	return res
+}
+
+func bytesSliceToValues(b [][]byte) []uint64 {
+	res := make([]uint64, len(b))
+	for i := range b {
+		res[i] = util.BytesToUint64(b[i])
+	}
+	return res
+}
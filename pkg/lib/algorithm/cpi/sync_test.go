@@ -0,0 +1,123 @@
+package cpi
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/rand"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/set"
+)
+
+func TestCPISync(t *testing.T) {
+	rand.Seed(100)
+	tests := []struct {
+		serverSetSize    int
+		clientSetSize    int
+		intersectionSize int
+		maxDifference    int
+	}{
+		{
+			serverSetSize:    5,
+			intersectionSize: 4,
+			clientSetSize:    5,
+			maxDifference:    2,
+		},
+		{
+			serverSetSize:    400,
+			clientSetSize:    400,
+			intersectionSize: 380,
+			maxDifference:    50,
+		},
+		{
+			serverSetSize:    3000,
+			clientSetSize:    3010,
+			intersectionSize: 3000,
+			maxDifference:    10,
+		},
+		{
+			serverSetSize:    20,
+			clientSetSize:    0,
+			intersectionSize: 0,
+			maxDifference:    32,
+		},
+	}
+	for _, tt := range tests {
+		t.Logf("New Pair test with %+v", tt)
+		server, err := NewCPISetSync(WithMaxDifference(tt.maxDifference))
+		require.NoError(t, err)
+		client, err := NewCPISetSync(WithMaxDifference(tt.maxDifference))
+		require.NoError(t, err)
+
+		expectedClientExtra := set.New()
+		expectedServerExtra := set.New()
+		for i := 0; i < tt.intersectionSize; i++ {
+			td := []byte(rand.String(20))
+			require.NoError(t, server.AddElement(td))
+			require.NoError(t, client.AddElement(td))
+		}
+		for i := 0; i < tt.clientSetSize-tt.intersectionSize; i++ {
+			td := []byte(rand.String(20))
+			require.NoError(t, client.AddElement(td))
+			expectedClientExtra.InsertKey(td)
+		}
+		for i := 0; i < tt.serverSetSize-tt.intersectionSize; i++ {
+			td := []byte(rand.String(20))
+			require.NoError(t, server.AddElement(td))
+			expectedServerExtra.InsertKey(td)
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, server.SyncServer("", 8100))
+		}()
+		assert.NoError(t, client.SyncClient("", 8100))
+		wg.Wait()
+
+		assert.EqualValues(t, *expectedClientExtra, *server.GetSetAdditions())
+		assert.EqualValues(t, *expectedServerExtra, *client.GetSetAdditions())
+		assert.EqualValues(t, *server.GetLocalSet(), *client.GetLocalSet())
+		assert.Equal(t, server.GetTotalBytes(), client.GetTotalBytes())
+	}
+}
+
+func TestCPISync_BoundExceeded(t *testing.T) {
+	server, err := NewCPISetSync(WithMaxDifference(4))
+	require.NoError(t, err)
+	client, err := NewCPISetSync(WithMaxDifference(4))
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, server.AddElement([]byte(rand.String(10))))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.True(t, errors.Is(server.SyncServer("", 8101), ErrBoundExceeded))
+	}()
+	assert.True(t, errors.Is(client.SyncClient("", 8101), ErrBoundExceeded))
+	wg.Wait()
+	assert.Empty(t, *client.GetLocalSet())
+}
+
+func TestCPISync_DeleteElement(t *testing.T) {
+	c, err := NewCPISetSync(WithMaxDifference(3))
+	require.NoError(t, err)
+	empty := append([]uint64{}, c.(*cpiSync).evals...)
+
+	require.NoError(t, c.AddElement([]byte("a")))
+	require.NoError(t, c.AddElement([]byte("b")))
+	require.NoError(t, c.DeleteElement([]byte("a")))
+	require.NoError(t, c.DeleteElement([]byte("b")))
+	assert.Equal(t, empty, c.(*cpiSync).evals)
+	assert.Empty(t, *c.GetLocalSet())
+
+	_, err = NewCPISetSync()
+	assert.Error(t, err)
+}
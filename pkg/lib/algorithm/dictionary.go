@@ -10,13 +10,14 @@ type Dictionary map[uint64]string
 // This is a local Dictionary to store string and hash transition.
 var localDictionary = make(Dictionary)
 
-// AddToDict converts a string in a hash value and add this pair of string and hash to the local Dictionary.
-// It returns the hash value of the string and errors out if there exist hash collision or hash convection error.
-func (d *Dictionary) AddToDict(entry string) (uint64, error) {
+// AddToDict converts a string in a hash value with the hasher and add this pair of string and hash to the local
+// Dictionary. It returns the hash value of the string and errors out if there exist hash collision or hash convection
+// error.
+func (d *Dictionary) AddToDict(entry string, hasher Hasher) (uint64, error) {
 	if entry == "" {
 		return 0, fmt.Errorf("no empty string should be added to the Dictionary")
 	}
-	hash, err := HashString(entry).ToUint64()
+	hash, err := HashString(entry).ToUint64With(hasher)
 	if err != nil {
 		return 0, fmt.Errorf("failed to convert string '%s' to hash value, %v", entry, err)
 	}
@@ -16,7 +16,7 @@ func TestAddToDict(t *testing.T) {
 		"abc",
 	}
 	for _, in := range inputs {
-		_, err := testDict.AddToDict(in)
+		_, err := testDict.AddToDict(in, DefaultHasher)
 		assert.NoError(t, err)
 	}
 
@@ -26,7 +26,7 @@ func TestAddToDict(t *testing.T) {
 	_, err := HashString(s).ToUint64()
 	require.NoError(t, err, "failed to convert string to hash")
 
-	hash, err := testDict.AddToDict(s)
+	hash, err := testDict.AddToDict(s, DefaultHasher)
 	testDict[hash] = sFail
 	assert.NoError(t, err, "dictionary added a collision")
 }
@@ -35,7 +35,7 @@ func TestLookupDict(t *testing.T) {
 	testDict := make(Dictionary)
 	t.Run("Dictionary lookup", func(t *testing.T) {
 		s := "abcd"
-		hash, err := testDict.AddToDict(s)
+		hash, err := testDict.AddToDict(s, DefaultHasher)
 		require.NoError(t, err)
 
 		lookup, err := testDict.LookupDict(hash)
@@ -0,0 +1,39 @@
+package full_sync
+
+import (
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm"
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/genSync"
+)
+
+type fullSyncOptions struct {
+	hasher      algorithm.Hasher           // hashes the set digest, negotiated with the remote at each sync. (default at FNV)
+	connOptions []genSync.ConnectionOption // options of the connections SyncClient and SyncServer open, such as TLS.
+}
+
+func (f *fullSyncOptions) apply(options []FullSyncOption) {
+	for _, option := range options {
+		option(f)
+	}
+}
+
+func (f *fullSyncOptions) complete() {
+	if f.hasher == nil {
+		f.hasher = algorithm.DefaultHasher
+	}
+}
+
+type FullSyncOption func(option *fullSyncOptions)
+
+// WithHasher sets the hash function of the set digest. Both peers must use the same hasher.
+func WithHasher(hasher algorithm.Hasher) FullSyncOption {
+	return func(option *fullSyncOptions) {
+		option.hasher = hasher
+	}
+}
+
+// WithConnectionOptions sets the options of the connections SyncClient and SyncServer open, such as WithTLS.
+func WithConnectionOptions(option ...genSync.ConnectionOption) FullSyncOption {
+	return func(options *fullSyncOptions) {
+		options.connOptions = option
+	}
+}
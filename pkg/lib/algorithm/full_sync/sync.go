@@ -1,28 +1,50 @@
 package full_sync
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm"
 	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/genSync"
 	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/set"
 	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/util"
 	"github.com/sirupsen/logrus"
 )
 
+// ErrDigestMismatch is returned when the set the staged changes would result in, or the set received from the client,
+// does not match the remote digest.
+var ErrDigestMismatch = errors.New("staged changes do not match the remote digest")
+
 type fullSync struct {
 	*set.Set
 	additionals   *set.Set
 	FreezeLocal   bool
+	DryRun        bool
+	staged        genSync.Changes // changes of the last sync, committed once they are validated.
+	committed     genSync.Changes // changes the last sync committed, reverted by Rollback.
 	SentBytes     int
 	ReceivedBytes int
+	options       fullSyncOptions
+	stats         genSync.Stats
+	checkpoint    *genSync.Checkpoint  // progress of the last client session, if it failed.
+	checkpoints   *genSync.Checkpoints // progress of the failed server sessions.
 }
 
-func NewFullSetSync() (genSync.GenSync, error) {
+func NewFullSetSync(option ...FullSyncOption) (genSync.GenSync, error) {
+	opt := fullSyncOptions{}
+	opt.apply(option)
+	opt.complete()
+
 	return &fullSync{
 		Set:           set.New(),
 		additionals:   set.New(),
 		SentBytes:     0,
 		ReceivedBytes: 0,
 		FreezeLocal:   false,
+		staged:        genSync.NewChanges(),
+		committed:     genSync.NewChanges(),
+		options:       opt,
+		checkpoints:   &genSync.Checkpoints{},
 	}, nil
 }
 
@@ -32,6 +54,11 @@ func (f *fullSync) SetFreezeLocal(freezeLocal bool) {
 	f.FreezeLocal = freezeLocal
 }
 
+// SetDryRun if set to true stages the changes of incoming syncs without committing them to the local set.
+func (f *fullSync) SetDryRun(dryRun bool) {
+	f.DryRun = dryRun
+}
+
 func (f *fullSync) AddElement(elem interface{}) error {
 	f.Set.InsertKey(elem)
 	return nil
@@ -44,27 +71,57 @@ func (f *fullSync) DeleteElement(elem interface{}) error {
 
 // SyncClient compares the digest of the local and the remote set and only transfer the entire set when the digests are different.
 func (f *fullSync) SyncClient(ip string, port int) error {
-	// refresh additionals at each sync session.
-	f.additionals = set.New()
+	return f.SyncClientContext(context.Background(), ip, port)
+}
 
-	client, err := genSync.NewTcpConnection(ip, port)
+// SyncClientContext runs SyncClient until the context is done.
+func (f *fullSync) SyncClientContext(ctx context.Context, ip string, port int) error {
+	client, err := genSync.NewTcpConnection(ip, port, f.options.connOptions...)
 	if err != nil {
 		return err
 	}
 
-	if err = client.Connect(); err != nil {
+	if err = client.ConnectContext(ctx); err != nil {
 		return err
 	}
+	defer client.Close()
+	return genSync.RunContext(ctx, client, f.SyncClientConn)
+}
+
+// SyncClientConn runs the client side of SyncClient over an established connection.
+func (f *fullSync) SyncClientConn(client genSync.Connection) error {
+	// refresh additionals and changes at each sync session.
+	f.additionals = set.New()
+	f.staged, f.committed = genSync.NewChanges(), genSync.NewChanges()
+
+	meter := genSync.NewMeter(client)
 	defer func() {
-		f.ReceivedBytes = client.GetReceivedBytes()
-		f.SentBytes = client.GetSentBytes()
-		client.Close()
+		f.stats = meter.Stop()
+		f.SentBytes, f.ReceivedBytes = f.stats.SentBytes, f.stats.ReceivedBytes
 	}()
 
-	digest, err := f.Set.GetDigest()
+	meter.Start(genSync.PhaseHandshake)
+	handshake, err := genSync.NewHandshake(algorithm.FullSync, f.options.hasher, nil)
+	if err != nil {
+		return err
+	}
+	if err = genSync.HandshakeClient(client, handshake); err != nil {
+		return err
+	}
+
+	digest, err := f.Set.GetDigest(f.options.hasher)
+	if err != nil {
+		return err
+	}
+
+	// Resume the last session if it failed, the set is only updated once a session completes.
+	checkpoint, err := genSync.ResumeClient(client, f.checkpoint, digest)
 	if err != nil {
 		return err
 	}
+	f.checkpoint = checkpoint
+
+	meter.Start(genSync.PhaseDigest)
 
 	// Compare digest of the remote and local set
 	serverDigest, err := client.Receive()
@@ -77,6 +134,7 @@ func (f *fullSync) SyncClient(ip string, port int) error {
 		if err != nil {
 			return err
 		}
+		f.checkpoint = nil
 		return nil
 	}
 
@@ -85,15 +143,14 @@ func (f *fullSync) SyncClient(ip string, port int) error {
 		return err
 	}
 
-	// send the number of element to expect
-	if _, err = client.Send(util.IntToBytes(f.Set.Len())); err != nil {
+	// send over the entire set.
+	meter.Start(genSync.PhaseLiteral)
+	if err = checkpoint.SendLiteral(client, "set", func() [][]byte { return setElements(f.Set) }); err != nil {
 		return err
 	}
-	// send over the entire set.
-	for elem := range *f.Set {
-		if _, err = client.Send([]byte(fmt.Sprint(elem))); err != nil {
-			return err
-		}
+	// Send the digest of the set for the server to validate the elements it received.
+	if _, err = client.Send(util.Uint64ToBytes(digest)); err != nil {
+		return err
 	}
 	if f.FreezeLocal {
 		logrus.Info("Client is freezing local set and skipping set update.")
@@ -101,6 +158,7 @@ func (f *fullSync) SyncClient(ip string, port int) error {
 		if err != nil {
 			return err
 		}
+		f.checkpoint = nil
 		return nil
 	}
 
@@ -109,45 +167,91 @@ func (f *fullSync) SyncClient(ip string, port int) error {
 		return err
 	}
 
-	setSize, err := client.Receive()
+	diff, err := checkpoint.ReceiveLiteral(client, "difference")
 	if err != nil {
 		return err
 	}
-
-	for i := 0; i < util.BytesToInt(setSize); i++ {
-		d, err := client.Receive()
-		if err != nil {
-			return err
+	for _, d := range diff {
+		if !f.Set.Has(d) {
+			f.staged.Additions.InsertKey(d)
 		}
-		f.additionals.InsertKey(d)
-		f.AddElement(d)
 	}
-	return nil
+
+	// Validate the staged set against the digest of the union the server computed.
+	unionDigest, err := client.Receive()
+	if err != nil {
+		return err
+	}
+	f.checkpoint = nil
+	stagedDigest, err := f.staged.Additions.GetDigest(f.options.hasher)
+	if err != nil {
+		return err
+	}
+	// The digest is the xor sum of the element hashes, so the digest of disjoint sets is the xor of their digests.
+	if digest^stagedDigest != util.BytesToUint64(unionDigest) {
+		return ErrDigestMismatch
+	}
+	return f.commit()
 }
 
 func (f *fullSync) SyncServer(ip string, port int) error {
-	// refresh additionals at each sync session.
-	f.additionals = set.New()
+	return f.SyncServerContext(context.Background(), ip, port)
+}
 
-	server, err := genSync.NewTcpConnection(ip, port)
+// SyncServerContext runs SyncServer until the context is done.
+func (f *fullSync) SyncServerContext(ctx context.Context, ip string, port int) error {
+	server, err := genSync.NewTcpConnection(ip, port, f.options.connOptions...)
 	if err != nil {
 		return err
 	}
 
-	if err = server.Listen(); err != nil {
+	if err = server.ListenContext(ctx); err != nil {
 		return err
 	}
+	defer server.Close()
+	return genSync.RunContext(ctx, server, f.SyncServerConn)
+}
+
+// SyncServerConn runs the server side of SyncServer over an established connection.
+func (f *fullSync) SyncServerConn(server genSync.Connection) (err error) {
+	// refresh additionals and changes at each sync session.
+	f.additionals = set.New()
+	f.staged, f.committed = genSync.NewChanges(), genSync.NewChanges()
+
+	meter := genSync.NewMeter(server)
 	defer func() {
-		f.ReceivedBytes = server.GetReceivedBytes()
-		f.SentBytes = server.GetSentBytes()
-		server.Close()
+		f.stats = meter.Stop()
+		f.SentBytes, f.ReceivedBytes = f.stats.SentBytes, f.stats.ReceivedBytes
 	}()
 
-	digest, err := f.Set.GetDigest()
+	meter.Start(genSync.PhaseHandshake)
+	handshake, err := genSync.NewHandshake(algorithm.FullSync, f.options.hasher, nil)
+	if err != nil {
+		return err
+	}
+	if err = genSync.HandshakeServer(server, handshake); err != nil {
+		return err
+	}
+
+	digest, err := f.Set.GetDigest(f.options.hasher)
 	if err != nil {
 		return err
 	}
 
+	// Keep the progress of a failed session for the client to resume it, the set is only updated once it completes.
+	checkpoint, err := f.checkpoints.Resume(server, digest)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// A session whose set does not match the client digest starts over rather than resuming from it.
+		if err != nil && !errors.Is(err, ErrDigestMismatch) {
+			f.checkpoints.Keep(checkpoint)
+		}
+	}()
+
+	meter.Start(genSync.PhaseDigest)
+
 	// Compare digest of the remote and local set
 	_, err = server.Send(util.Uint64ToBytes(digest))
 	if err != nil {
@@ -165,26 +269,30 @@ func (f *fullSync) SyncServer(ip string, port int) error {
 	}
 
 	// Create a temp set to extract the difference between the local and the remote set.
-	tempSet := set.New()
-	setSize, err := server.Receive()
+	meter.Start(genSync.PhaseLiteral)
+	tempSet, additions := set.New(), set.New()
+	elems, err := checkpoint.ReceiveLiteral(server, "set")
 	if err != nil {
 		return err
 	}
-
-	for i := 0; i < util.BytesToInt(setSize); i++ {
-		d, err := server.Receive()
-		if err != nil {
-			return err
-		}
+	for _, d := range elems {
 		tempSet.InsertKey(d)
-	}
-	if !f.FreezeLocal {
-		for elem := range *tempSet.Difference(f.Set) {
-			f.additionals.InsertKey(elem)
-			f.AddElement(elem)
+		if !f.Set.Has(d) {
+			additions.InsertKey(d)
 		}
-	} else {
-		logrus.Info("Server is freezing local set and skipping set update.")
+	}
+
+	// Validate the received set against the digest of the client before staging its additions.
+	clientDigest, err := server.Receive()
+	if err != nil {
+		return err
+	}
+	receivedDigest, err := tempSet.GetDigest(f.options.hasher)
+	if err != nil {
+		return err
+	}
+	if receivedDigest != util.BytesToUint64(clientDigest) {
+		return ErrDigestMismatch
 	}
 
 	syncStatus, err = server.Receive()
@@ -193,17 +301,102 @@ func (f *fullSync) SyncServer(ip string, port int) error {
 	}
 	if len(syncStatus) == 1 && syncStatus[0] == genSync.SYNC_SKIP {
 		logrus.Info("Client is freezing local, skipping the rest of the sync...")
+	} else {
+		// Send diff from server - client to client
+		err = checkpoint.SendLiteral(server, "difference", func() [][]byte { return setElements(f.Set.Difference(tempSet)) })
+		if err != nil {
+			return err
+		}
+
+		// Send the digest of the union for the client to validate its staged changes.
+		additionsDigest, err := additions.GetDigest(f.options.hasher)
+		if err != nil {
+			return err
+		}
+		if _, err = server.Send(util.Uint64ToBytes(digest ^ additionsDigest)); err != nil {
+			return err
+		}
+	}
+
+	if f.FreezeLocal {
+		logrus.Info("Server is freezing local set and skipping set update.")
 		return nil
 	}
+	f.staged.Additions = additions
+	return f.commit()
+}
 
-	// Send diff from server - client to client
-	diff := f.Set.Difference(tempSet)
-	// send the number of element to expect
-	if _, err = server.Send(util.IntToBytes(diff.Len())); err != nil {
-		return err
+// commit applies the staged changes to the local set in one step, unless in a dry run.
+func (f *fullSync) commit() error {
+	if f.DryRun {
+		logrus.Info("Dry run, skipping set update.")
+		return nil
 	}
-	for elem := range *diff {
-		if _, err = server.Send([]byte(fmt.Sprint(elem))); err != nil {
+	for elem := range *f.staged.Deletions {
+		if err := f.DeleteElement(elem); err != nil {
+			return err
+		}
+	}
+	for elem := range *f.staged.Additions {
+		f.additionals.InsertKey(elem)
+		if err := f.AddElement(elem); err != nil {
+			return err
+		}
+	}
+	f.committed = f.staged
+	return nil
+}
+
+// GetStagedChanges returns the changes the last sync staged, which are the would-be changes in a dry run. Full sync
+// merges the remote set into the local one, so it never deletes elements.
+func (f *fullSync) GetStagedChanges() genSync.Changes {
+	return f.staged
+}
+
+// Rollback reverts the changes the last sync committed to the local set.
+func (f *fullSync) Rollback() error {
+	for elem := range *f.committed.Additions {
+		if err := f.DeleteElement(elem); err != nil {
+			return err
+		}
+	}
+	for elem := range *f.committed.Deletions {
+		if err := f.AddElement(elem); err != nil {
+			return err
+		}
+	}
+	f.committed = genSync.NewChanges()
+	f.additionals = set.New()
+	return nil
+}
+
+// setElements returns the elements of the set as they are sent, as one slice so that they are compressed together.
+func setElements(s *set.Set) [][]byte {
+	elems := make([][]byte, 0, s.Len())
+	for elem := range *s {
+		elems = append(elems, []byte(fmt.Sprint(elem)))
+	}
+	return elems
+}
+
+// Snapshot copies the local set for a session of a genSync.Server.
+func (f *fullSync) Snapshot() (genSync.GenSync, error) {
+	return &fullSync{
+		Set:         f.Set.Union(set.New()),
+		additionals: set.New(),
+		FreezeLocal: f.FreezeLocal,
+		DryRun:      f.DryRun,
+		staged:      genSync.NewChanges(),
+		committed:   genSync.NewChanges(),
+		options:     f.options,
+		checkpoints: f.checkpoints,
+	}, nil
+}
+
+// Apply adds the elements a session received to the local set.
+func (f *fullSync) Apply(session genSync.GenSync) error {
+	for elem := range *session.GetSetAdditions() {
+		if err := f.AddElement(elem); err != nil {
 			return err
 		}
 	}
@@ -222,6 +415,11 @@ func (f *fullSync) GetReceivedBytes() int {
 	return f.ReceivedBytes
 }
 
+// Stats returns the traffic of the last sync.
+func (f *fullSync) Stats() genSync.Stats {
+	return f.stats
+}
+
 func (f *fullSync) GetTotalBytes() int {
 	return f.ReceivedBytes + f.SentBytes
 }
@@ -1,12 +1,18 @@
 package full_sync
 
 import (
+	"context"
+	"fmt"
+	"net"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"k8s.io/apimachinery/pkg/util/rand"
 
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm"
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/genSync"
 	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/set"
 )
 
@@ -84,3 +90,231 @@ func TestNewFullSetSync(t *testing.T) {
 		assert.EqualValues(t, *server.GetLocalSet(), *client.GetLocalSet())
 	}
 }
+
+func TestWithHasher(t *testing.T) {
+	server, err := NewFullSetSync(WithHasher(algorithm.NewXXHasher()))
+	assert.NoError(t, err)
+	client, err := NewFullSetSync(WithHasher(algorithm.NewXXHasher()))
+	assert.NoError(t, err)
+	assert.NoError(t, server.AddElement([]byte("server")))
+	assert.NoError(t, client.AddElement([]byte("client")))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		assert.NoError(t, client.SyncServer("", 8085))
+		wg.Done()
+	}()
+	assert.NoError(t, server.SyncClient("", 8085))
+	wg.Wait()
+	assert.EqualValues(t, *server.GetLocalSet(), *client.GetLocalSet())
+
+	// Peers hashing differently fail on both sides before comparing digests.
+	mismatched, err := NewFullSetSync(WithHasher(algorithm.NewSHA256Hasher()))
+	assert.NoError(t, err)
+	wg.Add(1)
+	go func() {
+		assert.ErrorIs(t, mismatched.SyncServer("", 8086), genSync.ErrHasherMismatch)
+		wg.Done()
+	}()
+	assert.ErrorIs(t, server.SyncClient("", 8086), genSync.ErrHasherMismatch)
+	wg.Wait()
+}
+
+func TestServer(t *testing.T) {
+	hub, err := NewFullSetSync()
+	assert.NoError(t, err)
+	assert.NoError(t, hub.AddElement([]byte("hub")))
+
+	const clientNum = 4
+	server, err := genSync.NewServer(hub, "", 8087, genSync.WithMaxSessions(clientNum))
+	assert.NoError(t, err)
+	served := make(chan error)
+	go func() {
+		served <- server.Serve()
+	}()
+
+	var wg sync.WaitGroup
+	expectedSet := set.New()
+	expectedSet.InsertKey([]byte("hub"))
+	for i := 0; i < clientNum; i++ {
+		edge, err := NewFullSetSync()
+		assert.NoError(t, err)
+		elem := []byte(rand.String(20))
+		assert.NoError(t, edge.AddElement(elem))
+		expectedSet.InsertKey(elem)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, edge.SyncClient("", 8087))
+			assert.True(t, edge.GetLocalSet().Has([]byte("hub")))
+		}()
+	}
+	wg.Wait()
+	assert.NoError(t, <-served)
+	assert.EqualValues(t, *expectedSet, *hub.GetLocalSet())
+}
+
+func TestSyncClientContext(t *testing.T) {
+	// A peer that accepts the connection but never answers.
+	stuck, err := genSync.NewTcpConnection("", 8088)
+	assert.NoError(t, err)
+	go func() {
+		if assert.NoError(t, stuck.Listen()) {
+			time.Sleep(time.Second)
+			stuck.Close()
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	client, err := NewFullSetSync()
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, client.SyncClientContext(ctx, "", 8088), context.DeadlineExceeded)
+
+	// Nobody listens, so connecting keeps retrying until the context is canceled.
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	assert.ErrorIs(t, client.SyncClientContext(ctx, "", 8089), context.Canceled)
+}
+
+func TestSyncConn(t *testing.T) {
+	server, err := NewFullSetSync()
+	assert.NoError(t, err)
+	client, err := NewFullSetSync()
+	assert.NoError(t, err)
+	assert.NoError(t, server.AddElement([]byte("server")))
+	assert.NoError(t, client.AddElement([]byte("client")))
+
+	// Reconcile over an in-memory pipe instead of TCP.
+	clientPipe, serverPipe := net.Pipe()
+	serverConn, err := genSync.NewConnection(serverPipe)
+	assert.NoError(t, err)
+	clientConn, err := genSync.NewConnection(clientPipe)
+	assert.NoError(t, err)
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	served := make(chan error)
+	go func() {
+		served <- server.SyncServerConn(serverConn)
+	}()
+	assert.NoError(t, client.SyncClientConn(clientConn))
+	assert.NoError(t, <-served)
+	assert.EqualValues(t, *server.GetLocalSet(), *client.GetLocalSet())
+	assert.Equal(t, 2, client.GetLocalSet().Len())
+}
+
+func TestCompression(t *testing.T) {
+	compression := WithConnectionOptions(genSync.WithCompression(genSync.CompressionGzip))
+	server, err := NewFullSetSync(compression)
+	assert.NoError(t, err)
+	client, err := NewFullSetSync(compression)
+	assert.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, server.AddElement([]byte(fmt.Sprintf("compressible element %d", i))))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, server.SyncServer("", 8114))
+	}()
+	assert.NoError(t, client.SyncClient("", 8114))
+	wg.Wait()
+	assert.EqualValues(t, *server.GetLocalSet(), *client.GetLocalSet())
+	// The elements cost fewer bytes on the wire than their length.
+	assert.Less(t, client.GetReceivedBytes(), 100*len("compressible element 00"))
+}
+
+func TestTransaction(t *testing.T) {
+	server, err := NewFullSetSync()
+	assert.NoError(t, err)
+	client, err := NewFullSetSync()
+	assert.NoError(t, err)
+	assert.NoError(t, server.AddElement([]byte("server")))
+	assert.NoError(t, server.AddElement([]byte("both")))
+	assert.NoError(t, client.AddElement([]byte("both")))
+	assert.NoError(t, client.AddElement([]byte("client")))
+	transactional := client.(genSync.Transactional)
+
+	syncConn := func() {
+		clientPipe, serverPipe := net.Pipe()
+		serverConn, err := genSync.NewConnection(serverPipe)
+		assert.NoError(t, err)
+		clientConn, err := genSync.NewConnection(clientPipe)
+		assert.NoError(t, err)
+		defer serverConn.Close()
+		defer clientConn.Close()
+
+		served := make(chan error)
+		go func() {
+			served <- server.SyncServerConn(serverConn)
+		}()
+		assert.NoError(t, client.SyncClientConn(clientConn))
+		assert.NoError(t, <-served)
+	}
+
+	// A dry run stages the additions without committing them.
+	server.SetFreezeLocal(true)
+	transactional.SetDryRun(true)
+	syncConn()
+	changes := transactional.GetStagedChanges()
+	assert.True(t, changes.Additions.Has("server"))
+	assert.Equal(t, 1, changes.Additions.Len())
+	assert.Equal(t, 0, changes.Deletions.Len())
+	assert.Equal(t, 2, client.GetLocalSet().Len())
+	assert.Equal(t, 0, client.GetSetAdditions().Len())
+
+	// A sync commits them in one step, and a rollback reverts them.
+	transactional.SetDryRun(false)
+	syncConn()
+	assert.True(t, client.GetLocalSet().Has("server"))
+	assert.Equal(t, 1, client.GetSetAdditions().Len())
+	assert.NoError(t, transactional.Rollback())
+	assert.False(t, client.GetLocalSet().Has("server"))
+	assert.Equal(t, 2, client.GetLocalSet().Len())
+	assert.Equal(t, 2, server.GetLocalSet().Len())
+}
+
+// corruptingConn replaces the first element of each slice it sends.
+type corruptingConn struct {
+	genSync.Connection
+}
+
+func (c corruptingConn) SendBytesSlice(dataSlice [][]byte) (int, error) {
+	corrupted := append([][]byte{[]byte("corrupted")}, dataSlice[1:]...)
+	return c.Connection.SendBytesSlice(corrupted)
+}
+
+func TestServerValidatesClientSet(t *testing.T) {
+	server, err := NewFullSetSync()
+	assert.NoError(t, err)
+	client, err := NewFullSetSync()
+	assert.NoError(t, err)
+	assert.NoError(t, server.AddElement([]byte("server")))
+	assert.NoError(t, client.AddElement([]byte("client")))
+
+	clientPipe, serverPipe := net.Pipe()
+	serverConn, err := genSync.NewConnection(serverPipe)
+	assert.NoError(t, err)
+	clientConn, err := genSync.NewConnection(clientPipe)
+	assert.NoError(t, err)
+	defer clientConn.Close()
+
+	served := make(chan error)
+	go func() {
+		err := server.SyncServerConn(serverConn)
+		serverConn.Close()
+		served <- err
+	}()
+	// The set the server receives does not match the client digest, so the server commits none of it.
+	assert.Error(t, client.SyncClientConn(corruptingConn{clientConn}))
+	assert.ErrorIs(t, <-served, ErrDigestMismatch)
+	assert.Equal(t, 1, server.GetLocalSet().Len())
+	assert.False(t, server.GetLocalSet().Has("corrupted"))
+	assert.Equal(t, 0, server.GetSetAdditions().Len())
+}
@@ -27,14 +27,17 @@ func HashBytesWithCryptoFunc(b []byte, hash crypto.Hash) *hashData {
 
 }
 
-// TODO: Provide methods to select different hash functions or provide custom hash functions.
+// ToUint64 hashes the data with the DefaultHasher.
 func (d *hashData) ToUint64() (uint64, error) {
+	return d.ToUint64With(DefaultHasher)
+}
+
+// ToUint64With hashes the data with the hasher.
+func (d *hashData) ToUint64With(hasher Hasher) (uint64, error) {
 	if d.err != nil {
 		return 0, d.err
 	}
-	h := fnv.New64()
-	_, err := h.Write(d.bytes)
-	return h.Sum64(), err
+	return hasher.Sum64(d.bytes), nil
 }
 
 func (d *hashData) ToUint32() (uint32, error) {
@@ -0,0 +1,121 @@
+package algorithm
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/dchest/siphash"
+)
+
+// Hasher hashes bytes into a 64-bit value. Peers must hash with the same function, which is identified by Name.
+type Hasher interface {
+	// Name identifies the hash function and its key, if any, so that peers can tell they hash the same way.
+	Name() string
+	Sum64(b []byte) uint64
+}
+
+const (
+	FNVHasherName    = "fnv64"
+	XXHasherName     = "xxhash64"
+	SipHasherName    = "siphash24"
+	SHA256HasherName = "sha256-64"
+)
+
+// DefaultHasher is FNV-64, which is the hash used before hash functions were selectable.
+var DefaultHasher Hasher = NewFNVHasher()
+
+type fnvHasher struct{}
+
+// NewFNVHasher returns the FNV-64 hasher.
+func NewFNVHasher() Hasher {
+	return fnvHasher{}
+}
+
+func (fnvHasher) Name() string {
+	return FNVHasherName
+}
+
+func (fnvHasher) Sum64(b []byte) uint64 {
+	h := fnv.New64()
+	// hash.Hash never returns an error on Write.
+	_, _ = h.Write(b)
+	return h.Sum64()
+}
+
+type xxHasher struct{}
+
+// NewXXHasher returns the 64-bit xxHash hasher, which is considerably faster than FNV on long inputs.
+func NewXXHasher() Hasher {
+	return xxHasher{}
+}
+
+func (xxHasher) Name() string {
+	return XXHasherName
+}
+
+func (xxHasher) Sum64(b []byte) uint64 {
+	return xxhash.Sum64(b)
+}
+
+type sipHasher struct {
+	k0, k1 uint64
+	name   string
+}
+
+// NewSipHasher returns the SipHash-2-4 hasher keyed by a 16 byte key. Keyed hashes keep an adversary who does not
+// know the key from crafting collisions. The name carries a fingerprint of the key instead of the key itself.
+func NewSipHasher(key []byte) (Hasher, error) {
+	if len(key) != 16 {
+		return nil, fmt.Errorf("siphash key should be 16 bytes but got %d", len(key))
+	}
+	fingerprint := sha256.Sum256(key)
+	return &sipHasher{
+		k0:   binary.LittleEndian.Uint64(key[:8]),
+		k1:   binary.LittleEndian.Uint64(key[8:]),
+		name: SipHasherName + "-" + hex.EncodeToString(fingerprint[:4]),
+	}, nil
+}
+
+func (s *sipHasher) Name() string {
+	return s.name
+}
+
+func (s *sipHasher) Sum64(b []byte) uint64 {
+	return siphash.Hash(s.k0, s.k1, b)
+}
+
+type sha256Hasher struct{}
+
+// NewSHA256Hasher returns the SHA-256 hasher truncated to the first 64 bits.
+func NewSHA256Hasher() Hasher {
+	return sha256Hasher{}
+}
+
+func (sha256Hasher) Name() string {
+	return SHA256HasherName
+}
+
+func (sha256Hasher) Sum64(b []byte) uint64 {
+	sum := sha256.Sum256(b)
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// NewHasher returns the hasher by name, where the key is only used by SipHash.
+func NewHasher(name string, key []byte) (Hasher, error) {
+	switch name {
+	case FNVHasherName:
+		return NewFNVHasher(), nil
+	case XXHasherName:
+		return NewXXHasher(), nil
+	case SipHasherName:
+		return NewSipHasher(key)
+	case SHA256HasherName:
+		return NewSHA256Hasher(), nil
+	default:
+		return nil, fmt.Errorf("unsupported hash function '%s'", name)
+	}
+}
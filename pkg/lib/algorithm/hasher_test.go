@@ -0,0 +1,58 @@
+package algorithm
+
+import (
+	"hash/fnv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHasher(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	sip, err := NewSipHasher(key)
+	require.NoError(t, err)
+
+	hashers := []Hasher{NewFNVHasher(), NewXXHasher(), sip, NewSHA256Hasher()}
+	names := make(map[string]bool)
+	for _, h := range hashers {
+		assert.Equal(t, h.Sum64([]byte("this")), h.Sum64([]byte("this")), h.Name())
+		assert.NotEqual(t, h.Sum64([]byte("this")), h.Sum64([]byte("that")), h.Name())
+		names[h.Name()] = true
+	}
+	assert.Len(t, names, len(hashers))
+
+	// The default hasher hashes the same as FNV-64 did before hashers were selectable.
+	f := fnv.New64()
+	_, _ = f.Write([]byte("this"))
+	hash, err := HashString("this").ToUint64()
+	assert.NoError(t, err)
+	assert.Equal(t, f.Sum64(), hash)
+}
+
+func TestNewSipHasher(t *testing.T) {
+	_, err := NewSipHasher([]byte("short"))
+	assert.Error(t, err)
+
+	h1, err := NewSipHasher([]byte("0123456789abcdef"))
+	require.NoError(t, err)
+	h2, err := NewSipHasher([]byte("fedcba9876543210"))
+	require.NoError(t, err)
+	assert.NotEqual(t, h1.Name(), h2.Name())
+	assert.NotEqual(t, h1.Sum64([]byte("this")), h2.Sum64([]byte("this")))
+	assert.NotContains(t, h1.Name(), "0123456789abcdef")
+}
+
+func TestNewHasher(t *testing.T) {
+	for _, name := range []string{FNVHasherName, XXHasherName, SHA256HasherName} {
+		h, err := NewHasher(name, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, name, h.Name())
+	}
+	h, err := NewHasher(SipHasherName, []byte("0123456789abcdef"))
+	assert.NoError(t, err)
+	assert.Contains(t, h.Name(), SipHasherName)
+
+	_, err = NewHasher("md5", nil)
+	assert.Error(t, err)
+}
@@ -3,15 +3,23 @@ package iblt
 import (
 	"crypto"
 	"fmt"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm"
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/genSync"
 )
 
 type ibltOptions struct {
 	HashSync          bool        // Converts data into hash values for IBLT and transfer literal data based on the differences. (enabled if HashFunc is provided)
 	HashFunc          crypto.Hash // the hash function to convert data into values for IBLT.
-	SymmetricDiff     int         // symmetrical set difference between set A and B  which is |A-B| + |B-A| (required)
+	SymmetricDiff     int         // symmetrical set difference between set A and B  which is |A-B| + |B-A| (estimated at each sync if not set)
+	EstimateDiff      bool        // sizes the table from a strata estimator exchanged at each sync (enabled if SymmetricDiff is not set)
 	DataLen           int         // maximum length of data elements (optional if HashSync is used.)
 	MaxSyncRetry      int         // IBLT is a probabilistic protocol and might need recomputing a table or double it's table size to be successful. This controls the number retires allowed. (default at 0)
 	TableSizeConstant float64     // TableSizeConstant * symmetric difference == number of table cells
+	ResyncFactor      float64     // each resync multiplies the table size by the factor. (default at 2)
+
+	hasher      algorithm.Hasher           // hashes the set digest and the strata estimator, negotiated before the parameters are compared. (default at FNV)
+	connOptions []genSync.ConnectionOption // options of the connections SyncClient and SyncServer open, such as TLS.
 }
 
 func (i *ibltOptions) apply(options []IBLTOption) {
@@ -21,9 +29,12 @@ func (i *ibltOptions) apply(options []IBLTOption) {
 }
 
 func (i *ibltOptions) complete() error {
-	if i.SymmetricDiff <= 0 {
+	if i.SymmetricDiff < 0 {
 		return fmt.Errorf("number of difference should be positive")
 	}
+	if i.SymmetricDiff == 0 {
+		i.EstimateDiff = true
+	}
 	// if Datalen is not set, which also says hash is not set, we go to default setting.
 	if i.DataLen == 0 {
 		i.HashSync = true
@@ -33,11 +44,22 @@ func (i *ibltOptions) complete() error {
 	if i.TableSizeConstant == 0 {
 		i.TableSizeConstant = 2.5
 	}
+	if i.ResyncFactor == 0 {
+		i.ResyncFactor = 2
+	}
+	if i.ResyncFactor <= 1 {
+		return fmt.Errorf("resync factor should be larger than 1")
+	}
+	if i.hasher == nil {
+		i.hasher = algorithm.DefaultHasher
+	}
 	return nil
 }
 
 type IBLTOption func(option *ibltOptions)
 
+// WithSymmetricSetDiff sizes the table for a known symmetric difference. Without it, both peers exchange strata
+// estimators at each sync and size the table from the estimated difference.
 func WithSymmetricSetDiff(diffNum int) IBLTOption {
 	return func(option *ibltOptions) {
 		option.SymmetricDiff = diffNum
@@ -79,3 +101,25 @@ func WithTableSizeConstant(constant float64) IBLTOption {
 		option.TableSizeConstant = constant
 	}
 }
+
+// WithResyncFactor sets the factor each resync grows the table by after a decode failure. Default factor doubles the
+// table.
+func WithResyncFactor(factor float64) IBLTOption {
+	return func(option *ibltOptions) {
+		option.ResyncFactor = factor
+	}
+}
+
+// WithHasher sets the hash function of the set digest and the strata estimator. Both peers must use the same hasher.
+func WithHasher(hasher algorithm.Hasher) IBLTOption {
+	return func(option *ibltOptions) {
+		option.hasher = hasher
+	}
+}
+
+// WithConnectionOptions sets the options of the connections SyncClient and SyncServer open, such as WithTLS.
+func WithConnectionOptions(option ...genSync.ConnectionOption) IBLTOption {
+	return func(options *ibltOptions) {
+		options.connOptions = option
+	}
+}
@@ -1,7 +1,8 @@
 package iblt
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"math"
 
@@ -9,20 +10,35 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm"
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm/strata"
 	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/genSync"
 	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/set"
 	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/util"
 )
 
+// ErrDigestMismatch is returned when the set the staged additions would result in does not match the remote digest.
+var ErrDigestMismatch = errors.New("staged additions do not match the remote digest")
+
 type ibltSync struct {
 	*iblt.Table
 	*set.Set
-	resyncIBLTs   []*iblt.Table
 	additionals   *set.Set
 	FreezeLocal   bool
 	SentBytes     int
 	ReceivedBytes int
 	options       ibltOptions
+	estimator     *strata.Estimator
+	diffNum       int
+	syncAttempt   int
+	stats         genSync.Stats
+	checkpoint    *genSync.Checkpoint  // progress of the last client session, if it failed.
+	checkpoints   *genSync.Checkpoints // progress of the failed server sessions.
+}
+
+// AttemptReporter is implemented by IBLT syncs to report the attempt that decoded the set difference in the last
+// sync, where attempt 0 is the initial table and attempt j is the j-th resync with a grown table.
+type AttemptReporter interface {
+	GetSyncAttempt() int
 }
 
 func NewIBLTSetSync(option ...IBLTOption) (genSync.GenSync, error) {
@@ -32,163 +48,264 @@ func NewIBLTSetSync(option ...IBLTOption) (genSync.GenSync, error) {
 		return nil, err
 	}
 
-	tableSize, numFxn := calculateTableDimentions(opt.SymmetricDiff, opt.TableSizeConstant)
-
-	IBLTs := make([]*iblt.Table, opt.MaxSyncRetry)
-	for i := range IBLTs {
-		tableSize, numFxn := calculateTableDimentions(opt.SymmetricDiff, opt.TableSizeConstant+float64(i+1))
-		IBLTs[i] = iblt.NewTable(uint(tableSize), opt.DataLen, 1, numFxn)
-	}
-
-	return &ibltSync{
-		Table:         iblt.NewTable(uint(tableSize), opt.DataLen, 1, numFxn),
-		resyncIBLTs:   IBLTs,
+	i := &ibltSync{
 		Set:           set.New(),
 		additionals:   set.New(),
 		SentBytes:     0,
 		ReceivedBytes: 0,
 		FreezeLocal:   false,
 		options:       opt,
-	}, nil
+		checkpoints:   &genSync.Checkpoints{},
+	}
+	if opt.EstimateDiff {
+		// Tables are built from the local set once the difference is estimated.
+		estimator, err := strata.NewEstimator(strata.WithHasher(opt.hasher))
+		if err != nil {
+			return nil, err
+		}
+		i.estimator = estimator
+		return i, nil
+	}
+	i.diffNum = opt.SymmetricDiff
+	table, err := i.newTable(1)
+	if err != nil {
+		return nil, err
+	}
+	i.Table = table
+	return i, nil
+}
+
+// newTable creates an IBLT for the symmetric difference, scaled by the factor, and inserts the local set.
+func (i *ibltSync) newTable(scale float64) (*iblt.Table, error) {
+	tableSize, numFxn := calculateTableDimentions(i.diffNum, i.options.TableSizeConstant*scale)
+	table := iblt.NewTable(uint(tableSize), i.options.DataLen, 1, numFxn)
+	for k := range *i.Set {
+		if err := table.Insert([]byte(fmt.Sprint(k))); err != nil {
+			return nil, err
+		}
+	}
+	return table, nil
+}
+
+// estimateDiff exchanges strata estimators with the remote and builds the tables from the estimated difference. The
+// client sends its estimator and the server replies with the estimate.
+func (i *ibltSync) estimateDiff(connection genSync.Connection, isServer bool) error {
+	var diffNum int
+	if isServer {
+		buf, err := connection.Receive()
+		if err != nil {
+			return err
+		}
+		remote, err := strata.Deserialize(buf)
+		if err != nil {
+			return err
+		}
+		if diffNum, err = i.estimator.Estimate(remote); err != nil {
+			return err
+		}
+		if _, err = connection.Send(util.IntToBytes(diffNum)); err != nil {
+			return err
+		}
+	} else {
+		buf, err := i.estimator.Serialize()
+		if err != nil {
+			return err
+		}
+		if _, err = connection.Send(buf); err != nil {
+			return err
+		}
+		if buf, err = connection.Receive(); err != nil {
+			return err
+		}
+		diffNum = util.BytesToInt(buf)
+	}
+	if diffNum < 1 {
+		diffNum = 1
+	}
+	logrus.Debugf("estimated symmetric difference of %d", diffNum)
+	i.diffNum = diffNum
+	table, err := i.newTable(1)
+	if err != nil {
+		return err
+	}
+	i.Table = table
+	return nil
 }
 
 func (i *ibltSync) SetFreezeLocal(freezeLocal bool) {
 	i.FreezeLocal = freezeLocal
 }
 
+// AddElement adds the element to the set, the table and the estimator, and leaves them unchanged if it fails.
 func (i *ibltSync) AddElement(elem interface{}) error {
-	if i.options.HashSync {
-		key, err := algorithm.HashBytesWithCryptoFunc(elem.([]byte), i.options.HashFunc).ToBytes()
-		if err != nil {
+	key, err := i.key(elem.([]byte))
+	if err != nil {
+		return err
+	}
+	if i.Set.Has(key) {
+		return nil
+	}
+	if i.Table != nil {
+		if err = i.Table.Insert(key); err != nil {
 			return err
 		}
-		i.Set.Insert(key, elem)
-
-		for j := range i.resyncIBLTs {
-			i.resyncIBLTs[j].Insert(key)
+	}
+	if i.estimator != nil {
+		if err = i.estimator.Insert(key); err != nil {
+			if i.Table != nil {
+				_ = i.Table.Delete(key)
+			}
+			return err
 		}
-		return i.Table.Insert(key)
+	}
+	i.insert(key, elem.([]byte))
+	return nil
+}
+
+// key returns the key of the element in the set and the table, which is its hash under hash sync.
+func (i *ibltSync) key(elem []byte) ([]byte, error) {
+	if !i.options.HashSync {
+		return elem, nil
+	}
+	return algorithm.HashBytesWithCryptoFunc(elem, i.options.HashFunc).ToBytes()
+}
+
+// insert inserts the element into the set under its key.
+func (i *ibltSync) insert(key, elem []byte) {
+	if i.options.HashSync {
+		i.Set.Insert(key, elem)
 	} else {
 		i.Set.InsertKey(elem)
 	}
-	key := elem.([]byte)
-	for j := range i.resyncIBLTs {
-		i.resyncIBLTs[j].Insert(key)
-	}
-	return i.Table.Insert(key)
 }
 
 func (i *ibltSync) DeleteElement(elem interface{}) error {
+	key := elem.([]byte)
 	if i.options.HashSync {
-		key, err := algorithm.HashBytesWithCryptoFunc(elem.([]byte), i.options.HashFunc).ToBytes()
-		if err != nil {
+		var err error
+		if key, err = algorithm.HashBytesWithCryptoFunc(elem.([]byte), i.options.HashFunc).ToBytes(); err != nil {
 			return err
 		}
-		i.Set.Remove(key)
-		for j := range i.resyncIBLTs {
-			i.resyncIBLTs[j].Delete(key)
+	}
+	if !i.Set.Has(key) {
+		return nil
+	}
+	i.Set.Remove(key)
+	if i.estimator != nil {
+		if err := i.estimator.Delete(key); err != nil {
+			return err
 		}
-		return i.Table.Delete(key)
 	}
-	i.Set.Remove(elem)
-	key := elem.([]byte)
-	for j := range i.resyncIBLTs {
-		i.resyncIBLTs[j].Delete(key)
+	if i.Table == nil {
+		return nil
 	}
 	return i.Table.Delete(key)
 }
 
 func (i *ibltSync) SyncClient(ip string, port int) error {
-	// refresh additionals at each sync session.
-	i.additionals = set.New()
+	return i.SyncClientContext(context.Background(), ip, port)
+}
 
-	client, err := genSync.NewTcpConnection(ip, port)
+// SyncClientContext runs SyncClient until the context is done.
+func (i *ibltSync) SyncClientContext(ctx context.Context, ip string, port int) error {
+	client, err := genSync.NewTcpConnection(ip, port, i.options.connOptions...)
 	if err != nil {
 		return err
 	}
 
-	if err = client.Connect(); err != nil {
+	if err = client.ConnectContext(ctx); err != nil {
 		return err
 	}
+	defer client.Close()
+	return genSync.RunContext(ctx, client, i.SyncClientConn)
+}
+
+// SyncClientConn runs the client side of SyncClient over an established connection.
+func (i *ibltSync) SyncClientConn(client genSync.Connection) error {
+	// refresh additionals at each sync session.
+	i.additionals = set.New()
+
+	meter := genSync.NewMeter(client)
 	defer func() {
-		i.ReceivedBytes = client.GetReceivedBytes()
-		i.SentBytes = client.GetSentBytes()
-		client.Close()
+		i.stats = meter.Stop()
+		i.SentBytes, i.ReceivedBytes = i.stats.SentBytes, i.stats.ReceivedBytes
 	}()
 
-	// Compare digest of the remote and local set
-	digest, err := i.Set.GetDigest()
+	meter.Start(genSync.PhaseHandshake)
+	handshake, err := genSync.NewHandshake(algorithm.IBLT, i.options.hasher, i.options)
 	if err != nil {
 		return err
 	}
-
-	serverDigest, err := client.Receive()
-	if err != nil {
+	if err = genSync.HandshakeClient(client, handshake); err != nil {
 		return err
 	}
-	if util.BytesToUint64(serverDigest) == digest {
-		logrus.Info("No sync operation necessary, local and remote digests are the same.")
-		_, err = client.Send([]byte{genSync.SYNC_SKIP})
-		if err != nil {
-			return err
-		}
-		return nil
-	}
 
-	_, err = client.Send([]byte{genSync.SYNC_CONTINUE})
+	digest, err := i.Set.GetDigest(i.options.hasher)
 	if err != nil {
 		return err
 	}
 
-	// check sync parameters
-	bufOpt, err := json.Marshal(i.options)
+	// Resume the last session if it failed, the set is only updated once a session completes.
+	checkpoint, err := genSync.ResumeClient(client, i.checkpoint, digest)
 	if err != nil {
 		return err
 	}
+	i.checkpoint = checkpoint
+
+	meter.Start(genSync.PhaseDigest)
 
-	_, err = client.Send(bufOpt)
+	// Compare digest of the remote and local set
+	serverDigest, err := client.Receive()
 	if err != nil {
 		return err
 	}
-	if skipSync, err := client.ReceiveSkipSyncBoolWithInfo("Client is using IBLT with %+v and is miss matching parameters with server", i.options); err != nil {
-		return err
-	} else if skipSync {
+	if util.BytesToUint64(serverDigest) == digest {
+		logrus.Info("No sync operation necessary, local and remote digests are the same.")
+		_, err = client.Send([]byte{genSync.SYNC_SKIP})
+		if err != nil {
+			return err
+		}
+		i.checkpoint = nil
 		return nil
 	}
 
-	// Send table to server to extract the differences
-	tableData, err := i.Table.Serialize()
+	_, err = client.Send([]byte{genSync.SYNC_CONTINUE})
 	if err != nil {
 		return err
 	}
 
-	if _, err = client.Send(tableData); err != nil {
-		return err
+	meter.Start(genSync.PhaseTable)
+	if i.options.EstimateDiff {
+		if err = i.estimateDiff(client, false); err != nil {
+			return err
+		}
 	}
-	if skipResync, err := client.ReceiveSkipSyncBoolWithInfo("IBLT decode success, resync not necessary"); err != nil {
+
+	// Send table to server to extract the differences
+	if err = i.syncTableClient(client); err != nil {
 		return err
-	} else if !skipResync {
-		if err = i.resyncClient(client); err != nil {
-			return fmt.Errorf("error decoding IBLT table after %d retries , %v", i.options.MaxSyncRetry, err)
-		}
 	}
 
 	// Help server if under hashsync and server is not freezing local set
+	meter.Start(genSync.PhaseLiteral)
+	serverFrozen := false
 	if i.options.HashSync {
-		if skipSync, err := client.ReceiveSkipSyncBoolWithInfo("Client is using IBLT with %+v and is miss matching parameters with server", i.options); err != nil {
+		if serverFrozen, err = client.ReceiveSkipSyncBoolWithInfo("Client is using IBLT with %+v and is miss matching parameters with server", i.options); err != nil {
 			return err
-		} else if !skipSync {
+		} else if !serverFrozen {
 			diffHash, err := client.ReceiveBytesSlice()
 			if err != nil {
 				return err
 			}
-			if _, err := client.Send(util.IntToBytes(len(diffHash))); err != nil {
-				return err
-			}
-			for _, h := range diffHash {
-				if _, err := client.Send(i.Set.Get(h).([]byte)); err != nil {
-					return err
+			err = checkpoint.SendLiteral(client, "requested", func() [][]byte {
+				elems := make([][]byte, len(diffHash))
+				for j, h := range diffHash {
+					elems[j] = i.Set.Get(h).([]byte)
 				}
+				return elems
+			})
+			if err != nil {
+				return err
 			}
 		}
 	}
@@ -198,152 +315,282 @@ func (i *ibltSync) SyncClient(ip string, port int) error {
 		return err
 	}
 	if i.FreezeLocal {
+		i.checkpoint = nil
 		return nil
 	}
 
 	// Receive differences
-	diffElem, err := client.ReceiveBytesSlice()
+	diffElem, err := checkpoint.ReceiveLiteral(client, "difference")
+	if err != nil {
+		return err
+	}
+	staged, err := i.stage(diffElem)
 	if err != nil {
 		return err
 	}
-	for _, d := range diffElem {
-		i.additionals.InsertKey(d)
-		if err = i.AddElement(d); err != nil {
+	i.checkpoint = nil
+
+	// Validate the staged set against the digest of the union the server computed, which a server freezing its set
+	// under hash sync cannot compute as it does not request the elements of the client.
+	if !i.options.HashSync || !serverFrozen {
+		unionDigest, err := client.Receive()
+		if err != nil {
+			return err
+		}
+		stagedDigest, err := staged.GetDigest(i.options.hasher)
+		if err != nil {
 			return err
 		}
+		// The digest is the xor sum of the element hashes, so the digest of disjoint sets is the xor of their digests.
+		if digest^stagedDigest != util.BytesToUint64(unionDigest) {
+			return ErrDigestMismatch
+		}
 	}
-
-	return nil
+	return i.commit(staged)
 }
+
 func (i *ibltSync) SyncServer(ip string, port int) error {
-	// refresh additionals at each sync session.
-	i.additionals = set.New()
+	return i.SyncServerContext(context.Background(), ip, port)
+}
 
-	server, err := genSync.NewTcpConnection(ip, port)
+// SyncServerContext runs SyncServer until the context is done.
+func (i *ibltSync) SyncServerContext(ctx context.Context, ip string, port int) error {
+	server, err := genSync.NewTcpConnection(ip, port, i.options.connOptions...)
 	if err != nil {
 		return err
 	}
 
-	if err = server.Listen(); err != nil {
+	if err = server.ListenContext(ctx); err != nil {
 		return err
 	}
+	defer server.Close()
+	return genSync.RunContext(ctx, server, i.SyncServerConn)
+}
+
+// SyncServerConn runs the server side of SyncServer over an established connection.
+func (i *ibltSync) SyncServerConn(server genSync.Connection) (err error) {
+	// refresh additionals at each sync session.
+	i.additionals = set.New()
+
+	meter := genSync.NewMeter(server)
 	defer func() {
-		i.ReceivedBytes = server.GetReceivedBytes()
-		i.SentBytes = server.GetSentBytes()
-		server.Close()
+		i.stats = meter.Stop()
+		i.SentBytes, i.ReceivedBytes = i.stats.SentBytes, i.stats.ReceivedBytes
 	}()
 
-	digest, err := i.Set.GetDigest()
+	meter.Start(genSync.PhaseHandshake)
+	handshake, err := genSync.NewHandshake(algorithm.IBLT, i.options.hasher, i.options)
 	if err != nil {
 		return err
 	}
+	if err = genSync.HandshakeServer(server, handshake); err != nil {
+		return err
+	}
 
-	// Compare digest of the remote and local set
-	_, err = server.Send(util.Uint64ToBytes(digest))
+	digest, err := i.Set.GetDigest(i.options.hasher)
 	if err != nil {
 		return err
 	}
 
-	if skipSync, err := server.ReceiveSkipSyncBoolWithInfo("No sync operation necessary, local and remote digests are the same."); err != nil {
+	// Keep the progress of a failed session for the client to resume it, the set is only updated once it completes.
+	checkpoint, err := i.checkpoints.Resume(server, digest)
+	if err != nil {
 		return err
-	} else if skipSync {
-		return nil
 	}
+	defer func() {
+		if err != nil {
+			i.checkpoints.Keep(checkpoint)
+		}
+	}()
 
-	// check sync parameters
-	opt := ibltOptions{}
-	bufOpt, err := server.Receive()
+	meter.Start(genSync.PhaseDigest)
+
+	// Compare digest of the remote and local set
+	_, err = server.Send(util.Uint64ToBytes(digest))
 	if err != nil {
 		return err
 	}
-	if err = json.Unmarshal(bufOpt, &opt); err != nil {
+
+	if skipSync, err := server.ReceiveSkipSyncBoolWithInfo("No sync operation necessary, local and remote digests are the same."); err != nil {
 		return err
+	} else if skipSync {
+		return nil
 	}
 
-	if err = server.SendSkipSyncBoolWithInfo(opt != i.options, "Server is using IBLT with %+v and is miss matching parameters with incoming sync %+v", i.options, opt); err != nil {
-		return err
+	meter.Start(genSync.PhaseTable)
+	if i.options.EstimateDiff {
+		if err = i.estimateDiff(server, true); err != nil {
+			return err
+		}
 	}
 
 	// Receive table from client to extract the differences
-	clientTableData, err := server.Receive()
+	diff, err := i.syncTableServer(server)
 	if err != nil {
 		return err
 	}
 
-	clientTable, err := iblt.Deserialize(clientTableData)
-	if err != nil {
-		return err
+	meter.Start(genSync.PhaseLiteral)
+
+	if i.options.HashSync {
+		if err = server.SendSkipSyncBoolWithInfo(i.FreezeLocal, "Server is freezing local set under hash sync."); err != nil {
+			return err
+		}
 	}
-	if err = clientTable.Subtract(i.Table); err != nil {
-		return err
+
+	// The additions are staged until the session completes. A server freezing its set under hash sync does not request
+	// them, but without hashes they are staged even when frozen, since the union digest the client validates against
+	// needs them.
+	var diffElem [][]byte
+	if !i.options.HashSync {
+		// if not hash is used, the original data in the IBLT is good enough.
+		diffElem = diff.AlphaSlice()
+	} else if !i.FreezeLocal {
+		// request diff by hash number
+		if _, err = server.SendBytesSlice(diff.AlphaSlice()); err != nil {
+			return err
+		}
+		// accept literal data return from the hash request
+		diffElem, err = checkpoint.ReceiveLiteral(server, "requested")
+		if err != nil {
+			return err
+		}
 	}
-	diff, err := clientTable.Decode()
-	if statusErr := server.SendSkipSyncBoolWithInfo(i.options.MaxSyncRetry > 0 && err == nil, "IBLT decode success, resync not necessary"); statusErr != nil {
-		return statusErr
+	if i.FreezeLocal {
+		logrus.Info("Server is freezing local set and skipping set update.")
 	}
+
+	skipSync, err := server.ReceiveSkipSyncBoolWithInfo("Client is freezing local, skipping the rest of the sync...")
 	if err != nil {
-		if i.options.MaxSyncRetry > 0 {
-			diff, err = i.resyncServer(server)
-		}
+		return err
+	}
+	if !skipSync {
+		// Send diff from server - client to client
+		err = checkpoint.SendLiteral(server, "difference", func() [][]byte {
+			if !i.options.HashSync {
+				return diff.BetaSlice()
+			}
+			elems := make([][]byte, len(diff.BetaSlice()))
+			for j, h := range diff.BetaSlice() {
+				elems[j] = i.Set.Get(h).([]byte)
+			}
+			return elems
+		})
 		if err != nil {
-			return fmt.Errorf("error decoding IBLT table after %d retries , %v", i.options.MaxSyncRetry, err)
+			return err
 		}
 	}
+	staged, err := i.stage(diffElem)
+	if err != nil {
+		return err
+	}
 
-	if i.options.HashSync {
-		if err = server.SendSkipSyncBoolWithInfo(i.FreezeLocal, "Server is freezing local set under hash sync."); err != nil {
+	// Send the digest of the union for the client to validate its staged additions.
+	if !skipSync && (!i.options.HashSync || !i.FreezeLocal) {
+		stagedDigest, err := staged.GetDigest(i.options.hasher)
+		if err != nil {
+			return err
+		}
+		if _, err = server.Send(util.Uint64ToBytes(digest ^ stagedDigest)); err != nil {
 			return err
 		}
 	}
 
-	if !i.FreezeLocal {
-		var diffElem [][]byte
+	if i.FreezeLocal {
+		return nil
+	}
+	return i.commit(staged)
+}
+
+// stage returns the elements that are not in the local set yet, keyed as in the local set so that the digest of the
+// staged set and the local set is the xor of their digests.
+func (i *ibltSync) stage(elems [][]byte) (*set.Set, error) {
+	staged := set.New()
+	for _, elem := range elems {
+		key, err := i.key(elem)
+		if err != nil {
+			return nil, err
+		}
+		if i.Set.Has(key) {
+			continue
+		}
 		if i.options.HashSync {
-			// request diff by hash number
-			if _, err = server.SendBytesSlice(diff.AlphaSlice()); err != nil {
-				return err
-			}
-			// accept literal data return from the hash request
-			diffElem, err = server.ReceiveBytesSlice()
-			if err != nil {
-				return err
-			}
+			staged.Insert(key, elem)
 		} else {
-			// if not hash is used, the original data in the IBLT is good enough.
-			diffElem = diff.AlphaSlice()
+			staged.InsertKey(elem)
 		}
-		for _, d := range diffElem {
-			i.additionals.InsertKey(d)
-			if err = i.AddElement(d); err != nil {
-				return err
+	}
+	return staged, nil
+}
+
+// commit adds the staged elements to the local set in one step. If one of them fails, the ones added before are
+// removed again and the local set is left unchanged.
+func (i *ibltSync) commit(staged *set.Set) error {
+	added := make([][]byte, 0, staged.Len())
+	for key, val := range *staged {
+		elem := []byte(key.(string))
+		if i.options.HashSync {
+			elem = val.([]byte)
+		}
+		if err := i.AddElement(elem); err != nil {
+			for _, a := range added {
+				if deleteErr := i.DeleteElement(a); deleteErr != nil {
+					return fmt.Errorf("%v, and failed to roll back the staged additions, %v", err, deleteErr)
+				}
 			}
+			return err
 		}
-	} else {
-		logrus.Info("Server is freezing local set and skipping set update.")
+		added = append(added, elem)
 	}
-
-	if skipSync, err := server.ReceiveSkipSyncBoolWithInfo("Client is freezing local, skipping the rest of the sync..."); err != nil {
-		return err
-	} else if skipSync {
-		return nil
+	for _, elem := range added {
+		i.additionals.InsertKey(elem)
 	}
+	return nil
+}
 
-	// Send diff from server - client to client
-	if i.options.HashSync {
-		if _, err := server.Send(util.IntToBytes(len(diff.BetaSlice()))); err != nil {
-			return err
-		}
-		for _, h := range diff.BetaSlice() {
-			if _, err := server.Send(i.Set.Get(h).([]byte)); err != nil {
-				return err
-			}
+// Snapshot copies the local set for a session of a genSync.Server. The tables and the estimator of the snapshot are
+// rebuilt from the copy, so sessions never share them.
+func (i *ibltSync) Snapshot() (genSync.GenSync, error) {
+	snapshot := &ibltSync{
+		Set:         set.New(),
+		additionals: set.New(),
+		FreezeLocal: i.FreezeLocal,
+		options:     i.options,
+		diffNum:     i.options.SymmetricDiff,
+		checkpoints: i.checkpoints,
+	}
+	if i.options.EstimateDiff {
+		estimator, err := strata.NewEstimator(strata.WithHasher(i.options.hasher))
+		if err != nil {
+			return nil, err
 		}
+		snapshot.estimator = estimator
 	} else {
-		if _, err = server.SendBytesSlice(diff.BetaSlice()); err != nil {
-			return err
+		table, err := snapshot.newTable(1)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Table = table
+	}
+	for key, val := range *i.Set {
+		elem := []byte(fmt.Sprint(key))
+		if i.options.HashSync {
+			elem = val.([]byte)
+		}
+		if err := snapshot.AddElement(elem); err != nil {
+			return nil, err
 		}
 	}
+	return snapshot, nil
+}
 
+// Apply adds the elements a session received to the local set.
+func (i *ibltSync) Apply(session genSync.GenSync) error {
+	for elem := range *session.GetSetAdditions() {
+		if err := i.AddElement([]byte(fmt.Sprint(elem))); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -359,6 +606,11 @@ func (i *ibltSync) GetReceivedBytes() int {
 	return i.ReceivedBytes
 }
 
+// Stats returns the traffic of the last sync.
+func (i *ibltSync) Stats() genSync.Stats {
+	return i.stats
+}
+
 func (i *ibltSync) GetTotalBytes() int {
 	return i.ReceivedBytes + i.SentBytes
 }
@@ -367,70 +619,126 @@ func (i *ibltSync) GetSetAdditions() *set.Set {
 	return i.additionals
 }
 
-// resyncServer double the IBLT size and resync with client
-func (i *ibltSync) resyncServer(connection genSync.Connection) (diff *iblt.Diff, syncErr error) {
-	for j := 0; j < i.options.MaxSyncRetry; j++ {
-		logrus.Debugf("server sync retires %d...", j+1)
+// GetSyncAttempt returns the attempt that decoded the set difference in the last sync.
+func (i *ibltSync) GetSyncAttempt() int {
+	return i.syncAttempt
+}
+
+// syncTableServer receives the client table and decodes the difference with the local table. On decode failure, the
+// client sends a table grown by the resync factor, which is matched by a local table built from the local set, for up
+// to MaxSyncRetry retries.
+func (i *ibltSync) syncTableServer(connection genSync.Connection) (*iblt.Diff, error) {
+	table := i.Table
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			logrus.Debugf("server sync retries %d...", attempt)
+			var err error
+			if table, err = i.newTable(math.Pow(i.options.ResyncFactor, float64(attempt))); err != nil {
+				return nil, err
+			}
+		}
 		clientTableData, err := connection.Receive()
 		if err != nil {
-			syncErr = err
-			continue
+			return nil, err
 		}
-
 		clientTable, err := iblt.Deserialize(clientTableData)
 		if err != nil {
-			syncErr = err
-			continue
+			return nil, err
 		}
-		if err = clientTable.Subtract(i.resyncIBLTs[j]); err != nil {
-			syncErr = err
-			continue
+		// Subtract shares the bucket checksums of the local table with the client table, which Decode overwrites.
+		localData, err := table.Serialize()
+		if err != nil {
+			return nil, err
 		}
-		diff, err := clientTable.Decode()
-		syncErr = connection.SendSkipSyncBoolWithInfo(err == nil, "resync success after %d additional tries, skipping the rest of retires", j+1)
+		localTable, err := iblt.Deserialize(localData)
 		if err != nil {
-			syncErr = fmt.Errorf("%v, %v", syncErr, err)
-			continue
+			return nil, err
+		}
+		if err = clientTable.Subtract(localTable); err != nil {
+			return nil, err
+		}
+		diff, decodeErr := clientTable.Decode()
+		if err = connection.SendSkipSyncBoolWithInfo(decodeErr == nil, "IBLT decode success after %d retries", attempt); err != nil {
+			return nil, err
+		}
+		if decodeErr == nil {
+			i.syncAttempt = attempt
+			return diff, nil
+		}
+		if attempt >= i.options.MaxSyncRetry {
+			return nil, fmt.Errorf("error decoding IBLT table after %d retries , %v", i.options.MaxSyncRetry, decodeErr)
 		}
-		return diff, syncErr
 	}
-	return nil, syncErr
 }
 
-// resyncClient double the IBLT size and resync with client
-func (i *ibltSync) resyncClient(connection genSync.Connection) (syncErr error) {
-	for j := 0; j < i.options.MaxSyncRetry; j++ {
-		logrus.Debugf("client sync retires %d...", j+1)
-		tableData, err := i.resyncIBLTs[j].Serialize()
+// syncTableClient sends the local table to the server and grows it by the resync factor until the server decodes the
+// difference or MaxSyncRetry retries are used. Larger tables are built from the local set only when needed.
+func (i *ibltSync) syncTableClient(connection genSync.Connection) error {
+	table := i.Table
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			logrus.Debugf("client sync retries %d...", attempt)
+			var err error
+			if table, err = i.newTable(math.Pow(i.options.ResyncFactor, float64(attempt))); err != nil {
+				return err
+			}
+		}
+		tableData, err := table.Serialize()
 		if err != nil {
-			syncErr = err
-			continue
+			return err
 		}
-
 		if _, err = connection.Send(tableData); err != nil {
-			syncErr = err
-			continue
+			return err
 		}
-		retrySuccess, err := connection.ReceiveSkipSyncBoolWithInfo("resync success after %d additional tries, skipping the rest of retires", j+1)
-		if retrySuccess {
+		success, err := connection.ReceiveSkipSyncBoolWithInfo("IBLT decode success after %d retries", attempt)
+		if err != nil {
+			return err
+		}
+		if success {
+			i.syncAttempt = attempt
 			return nil
-		} else {
-			syncErr = err
-			continue
+		}
+		if attempt >= i.options.MaxSyncRetry {
+			return fmt.Errorf("error decoding IBLT table after %d retries", i.options.MaxSyncRetry)
 		}
 	}
-	return syncErr
 }
 
+// maxTableSize is the largest prime that the uint16 bucket indexes of the IBLT library address.
+const maxTableSize = 65521
+
 // calculateTableDimentions calculates the IBLT dimentions include tablesize and number of hash functions used.
 func calculateTableDimentions(symmetricDifferences int, tableSizeContant float64) (int, int) {
 	tableSize := math.Ceil(float64(symmetricDifferences) * tableSizeContant)
 	if tableSize < 4 {
 		tableSize = 4
 	}
+	// The IBLT library serializes bucket indexes as uint16.
+	if tableSize > maxTableSize {
+		tableSize = maxTableSize
+	}
 	numFxn := int(math.Log10(tableSize))
 	if numFxn < 2 {
 		numFxn = 2
 	}
-	return int(tableSize), numFxn
+	// Buckets are picked by hash modulo the table size, so elements that collide in a table collide in every table
+	// whose size divides it, and the resyncs growing the table by a whole factor fail alike. Prime sizes keep the
+	// buckets of each resync independent.
+	size := int(tableSize)
+	for !isPrime(size) {
+		size++
+	}
+	return size, numFxn
+}
+
+func isPrime(n int) bool {
+	if n < 2 {
+		return false
+	}
+	for d := 2; d*d <= n; d++ {
+		if n%d == 0 {
+			return false
+		}
+	}
+	return true
 }
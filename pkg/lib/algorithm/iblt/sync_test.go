@@ -2,6 +2,8 @@ package iblt
 
 import (
 	"crypto"
+	"errors"
+	"net"
 	"sync"
 	"testing"
 
@@ -9,6 +11,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"k8s.io/apimachinery/pkg/util/rand"
 
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/genSync"
 	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/set"
 )
 
@@ -447,3 +450,319 @@ func TestIbltSync_SuccessRateWithRetries(t *testing.T) {
 	swg.Wait()
 	t.Logf("IBLT success rate with %d retries is %v", retries, float32(samples-failed)/float32(samples))
 }
+
+func TestWithEstimatedDiff(t *testing.T) {
+	rand.Seed(42)
+	tests := []struct {
+		serverSetSize    int
+		clientSetSize    int
+		intersectionSize int
+		options          []IBLTOption
+	}{
+		{serverSetSize: 10, clientSetSize: 10, intersectionSize: 9, options: []IBLTOption{WithDataLen(20)}},
+		{serverSetSize: 2000, clientSetSize: 1800, intersectionSize: 1500, options: []IBLTOption{WithDataLen(20), WithMaxSyncRetries(2)}},
+		{serverSetSize: 1000, clientSetSize: 1000, intersectionSize: 950, options: []IBLTOption{WithHashSync(), WithMaxSyncRetries(2)}},
+	}
+	for _, tt := range tests {
+		t.Logf("New Pair test with %+v", tt)
+		server, err := NewIBLTSetSync(tt.options...)
+		require.NoError(t, err)
+		client, err := NewIBLTSetSync(tt.options...)
+		require.NoError(t, err)
+
+		for i := 0; i < tt.intersectionSize; i++ {
+			td := []byte(rand.String(20))
+			require.NoError(t, server.AddElement(td))
+			require.NoError(t, client.AddElement(td))
+		}
+		for i := 0; i < tt.clientSetSize-tt.intersectionSize; i++ {
+			td := []byte(rand.String(20))
+			require.NoError(t, client.AddElement(td))
+		}
+		for i := 0; i < tt.serverSetSize-tt.intersectionSize; i++ {
+			td := []byte(rand.String(20))
+			require.NoError(t, server.AddElement(td))
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, server.SyncServer("", 8082))
+		}()
+		assert.NoError(t, client.SyncClient("", 8082))
+		wg.Wait()
+
+		assert.Len(t, *client.GetSetAdditions(), tt.serverSetSize-tt.intersectionSize)
+		assert.Len(t, *server.GetSetAdditions(), tt.clientSetSize-tt.intersectionSize)
+		assert.EqualValues(t, *server.GetLocalSet(), *client.GetLocalSet())
+		assert.Equal(t, server.GetTotalBytes(), client.GetTotalBytes())
+	}
+}
+
+func TestResyncGrowsTable(t *testing.T) {
+	rand.Seed(8)
+	server, err := NewIBLTSetSync(WithSymmetricSetDiff(4), WithDataLen(20), WithMaxSyncRetries(8))
+	require.NoError(t, err)
+	client, err := NewIBLTSetSync(WithSymmetricSetDiff(4), WithDataLen(20), WithMaxSyncRetries(8))
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		td := []byte(rand.String(20))
+		require.NoError(t, server.AddElement(td))
+		require.NoError(t, client.AddElement(td))
+	}
+	for i := 0; i < 60; i++ {
+		require.NoError(t, server.AddElement([]byte(rand.String(20))))
+		require.NoError(t, client.AddElement([]byte(rand.String(20))))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, server.SyncServer("", 8083))
+	}()
+	assert.NoError(t, client.SyncClient("", 8083))
+	wg.Wait()
+
+	assert.EqualValues(t, *server.GetLocalSet(), *client.GetLocalSet())
+	attempt := client.(AttemptReporter).GetSyncAttempt()
+	assert.Greater(t, attempt, 0)
+	assert.Equal(t, attempt, server.(AttemptReporter).GetSyncAttempt())
+	t.Logf("decoded at attempt %d", attempt)
+}
+
+func TestResyncTablesAreIndependent(t *testing.T) {
+	// Both hashes of the second element pick the same bucket of tables of 5 times a power of 2 buckets, and its third
+	// hash picks a bucket of the first element, so they cancel out in each such table.
+	colliding := [][]byte{[]byte("j2xjqnssjzvcm85k6cbcmm7rvs7m4cfz"), []byte("spktbn2h4rb2pwhjh5xz8lpxd9prx22c")}
+	server, err := NewIBLTSetSync(WithSymmetricSetDiff(2), WithDataLen(32), WithMaxSyncRetries(3))
+	require.NoError(t, err)
+	client, err := NewIBLTSetSync(WithSymmetricSetDiff(2), WithDataLen(32), WithMaxSyncRetries(3))
+	require.NoError(t, err)
+	require.NoError(t, server.AddElement(colliding[0]))
+	require.NoError(t, client.AddElement(colliding[1]))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, server.SyncServer("", 8120))
+	}()
+	assert.NoError(t, client.SyncClient("", 8120))
+	wg.Wait()
+	assert.EqualValues(t, *server.GetLocalSet(), *client.GetLocalSet())
+
+	for _, diff := range []int{1, 2, 10, 100, 30000} {
+		size, _ := calculateTableDimentions(diff, 2.5)
+		assert.True(t, isPrime(size), size)
+		assert.LessOrEqual(t, size, maxTableSize)
+	}
+}
+
+func TestResyncFailsWithoutRetries(t *testing.T) {
+	rand.Seed(9)
+	server, err := NewIBLTSetSync(WithSymmetricSetDiff(1), WithDataLen(20))
+	require.NoError(t, err)
+	client, err := NewIBLTSetSync(WithSymmetricSetDiff(1), WithDataLen(20))
+	require.NoError(t, err)
+	for i := 0; i < 30; i++ {
+		require.NoError(t, server.AddElement([]byte(rand.String(20))))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.Error(t, server.SyncServer("", 8084))
+	}()
+	assert.Error(t, client.SyncClient("", 8084))
+	wg.Wait()
+
+	_, err = NewIBLTSetSync(WithSymmetricSetDiff(1), WithResyncFactor(1))
+	assert.Error(t, err)
+}
+
+func TestParameterMismatch(t *testing.T) {
+	server, err := NewIBLTSetSync(WithSymmetricSetDiff(10), WithDataLen(20))
+	require.NoError(t, err)
+	client, err := NewIBLTSetSync(WithSymmetricSetDiff(10), WithDataLen(32))
+	require.NoError(t, err)
+	require.NoError(t, server.AddElement([]byte(rand.String(20))))
+
+	// Both peers refuse to sync instead of decoding each other's tables.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.ErrorIs(t, server.SyncServer("", 8113), genSync.ErrHandshakeMismatch)
+	}()
+	assert.ErrorIs(t, client.SyncClient("", 8113), genSync.ErrHandshakeMismatch)
+	wg.Wait()
+	assert.Zero(t, client.GetLocalSet().Len())
+}
+
+func TestStats(t *testing.T) {
+	server, err := NewIBLTSetSync(WithDataLen(20))
+	require.NoError(t, err)
+	client, err := NewIBLTSetSync(WithDataLen(20))
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		require.NoError(t, server.AddElement([]byte(rand.String(20))))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, server.SyncServer("", 8115))
+	}()
+	require.NoError(t, client.SyncClient("", 8115))
+	wg.Wait()
+
+	// Every phase ran and the phases add up to the bytes of the sync.
+	stats := client.Stats()
+	var sent, received int
+	for _, phase := range []genSync.Phase{genSync.PhaseHandshake, genSync.PhaseDigest, genSync.PhaseTable, genSync.PhaseLiteral} {
+		b := stats.Phase(phase)
+		assert.NotZero(t, b.Sent+b.Received, phase)
+		sent += b.Sent
+		received += b.Received
+	}
+	assert.Equal(t, client.GetSentBytes(), sent)
+	assert.Equal(t, client.GetReceivedBytes(), received)
+	assert.Equal(t, stats.SentBytes, server.Stats().ReceivedBytes)
+	// The literal elements the client receives dominate its traffic.
+	assert.Greater(t, stats.Phase(genSync.PhaseLiteral).Received, 20*20)
+}
+
+func TestFrozenServer(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		options []IBLTOption
+	}{
+		{name: "data", options: []IBLTOption{WithDataLen(20)}},
+		{name: "hash", options: []IBLTOption{WithHashSync()}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := NewIBLTSetSync(append(tt.options, WithSymmetricSetDiff(40), WithMaxSyncRetries(3))...)
+			require.NoError(t, err)
+			client, err := NewIBLTSetSync(append(tt.options, WithSymmetricSetDiff(40), WithMaxSyncRetries(3))...)
+			require.NoError(t, err)
+			for i := 0; i < 10; i++ {
+				require.NoError(t, server.AddElement([]byte(rand.String(20))))
+				require.NoError(t, client.AddElement([]byte(rand.String(20))))
+			}
+			server.SetFreezeLocal(true)
+			serverSet := server.GetLocalSet().Union(set.New())
+
+			clientPipe, serverPipe := net.Pipe()
+			serverConn, err := genSync.NewConnection(serverPipe)
+			require.NoError(t, err)
+			clientConn, err := genSync.NewConnection(clientPipe)
+			require.NoError(t, err)
+			defer serverConn.Close()
+			defer clientConn.Close()
+
+			served := make(chan error)
+			go func() {
+				served <- server.SyncServerConn(serverConn)
+			}()
+			require.NoError(t, client.SyncClientConn(clientConn))
+			require.NoError(t, <-served)
+
+			// The client receives the set of the server, which stays the same.
+			assert.Equal(t, 10, client.GetSetAdditions().Len())
+			assert.Equal(t, 20, client.GetLocalSet().Len())
+			assert.EqualValues(t, *serverSet, *server.GetLocalSet())
+			assert.Zero(t, server.GetSetAdditions().Len())
+		})
+	}
+}
+
+// faultyConnection fails on the element batch with the given index, by dropping the connection or corrupting an element.
+type faultyConnection struct {
+	genSync.Connection
+	batch   int
+	corrupt bool
+}
+
+func (f *faultyConnection) ReceiveBytesSlice() ([][]byte, error) {
+	f.batch--
+	if f.batch == 0 && !f.corrupt {
+		f.Close()
+		return nil, errors.New("connection dropped")
+	}
+	elems, err := f.Connection.ReceiveBytesSlice()
+	if f.batch == 0 && err == nil {
+		elems[len(elems)-1] = []byte(rand.String(20))
+	}
+	return elems, err
+}
+
+func TestAtomicCommit(t *testing.T) {
+	server, err := NewIBLTSetSync(WithDataLen(20), WithMaxSyncRetries(5))
+	require.NoError(t, err)
+	client, err := NewIBLTSetSync(WithDataLen(20), WithMaxSyncRetries(5))
+	require.NoError(t, err)
+	for i := 0; i < 600; i++ {
+		require.NoError(t, server.AddElement([]byte(rand.String(20))))
+	}
+	for i := 0; i < 10; i++ {
+		require.NoError(t, client.AddElement([]byte(rand.String(20))))
+	}
+	clientSet := client.GetLocalSet().Union(set.New())
+	serverSet := server.GetLocalSet().Union(set.New())
+
+	syncConn := func(batch int, corrupt bool) (error, error) {
+		clientPipe, serverPipe := net.Pipe()
+		serverConn, err := genSync.NewConnection(serverPipe)
+		require.NoError(t, err)
+		clientConn, err := genSync.NewConnection(clientPipe)
+		require.NoError(t, err)
+		defer serverConn.Close()
+		defer clientConn.Close()
+
+		served := make(chan error)
+		go func() {
+			served <- server.SyncServerConn(serverConn)
+		}()
+		clientErr := client.SyncClientConn(&faultyConnection{Connection: clientConn, batch: batch, corrupt: corrupt})
+		if clientErr != nil {
+			clientConn.Close()
+		}
+		return clientErr, <-served
+	}
+
+	// Neither set changes when the connection drops partway through the differences.
+	clientErr, serverErr := syncConn(2, false)
+	assert.Error(t, clientErr)
+	assert.Error(t, serverErr)
+	assert.EqualValues(t, *clientSet, *client.GetLocalSet())
+	assert.EqualValues(t, *serverSet, *server.GetLocalSet())
+	assert.Zero(t, client.GetSetAdditions().Len())
+
+	// A corrupted difference fails the validation against the remote digest.
+	clientErr, serverErr = syncConn(1, true)
+	assert.ErrorIs(t, clientErr, ErrDigestMismatch)
+	assert.NoError(t, serverErr)
+	assert.EqualValues(t, *clientSet, *client.GetLocalSet())
+	assert.Zero(t, client.GetSetAdditions().Len())
+
+	// A failing element rolls back the ones added before it.
+	staged := set.New()
+	for i := 0; i < 10; i++ {
+		staged.InsertKey([]byte(rand.String(20)))
+	}
+	staged.InsertKey([]byte("short"))
+	assert.Error(t, client.(*ibltSync).commit(staged))
+	assert.EqualValues(t, *clientSet, *client.GetLocalSet())
+	assert.Zero(t, client.GetSetAdditions().Len())
+
+	// A sync without failures commits all the differences.
+	clientErr, serverErr = syncConn(-1, false)
+	require.NoError(t, clientErr)
+	require.NoError(t, serverErr)
+	assert.EqualValues(t, *server.GetLocalSet(), *client.GetLocalSet())
+	assert.Equal(t, 600, client.GetSetAdditions().Len())
+}
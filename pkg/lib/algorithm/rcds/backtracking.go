@@ -1,17 +1,24 @@
 package rcds
 
 import (
+	"errors"
 	"fmt"
-	"reflect"
-	"sort"
+	"math"
+	"slices"
 )
 
+// maxBacktrackingSteps bounds the number of steps taken to trace a string with the shingle set. Highly repetitive
+// strings can have an exponential number of paths, in which case backtracking gives up with ErrBacktrackingLimit.
+var maxBacktrackingSteps = 1 << 22
+
+var ErrBacktrackingLimit = errors.New("backtracking exceeds the maximum number of steps")
+
+// sortedTailKeys returns the tails in ascending order, which is the order they are kept in.
 func sortedTailKeys(tails shingleTailCount) []uint64 {
-	keys := make([]uint64, 0, len(tails))
-	for k := range tails {
-		keys = append(keys, k)
+	keys := make([]uint64, len(tails))
+	for i, tc := range tails {
+		keys[i] = tc.tail
 	}
-	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
 	return keys
 }
 
@@ -19,189 +26,149 @@ func sortedTailKeys(tails shingleTailCount) []uint64 {
 // number of cycles needed to trace.
 type CycleInfo struct {
 	start    uint64
-	stepNum  uint16
-	cycleNum uint16
+	stepNum  uint32
+	cycleNum uint32
 }
 
+// BacktrackingWithCycle recovers the array of chunk hashes described by the cycle information. It walks the shingle
+// set in ascending hash order and returns the cycleNum-th path of stepNum chunks starting from the start chunk.
 func (s *hashShingleSet) BacktrackingWithCycle(info CycleInfo) (*[]uint64, error) {
 	if info == (CycleInfo{}) {
 		return nil, fmt.Errorf("input backtrack information is not set")
 	}
+	if info.stepNum < 1 || info.cycleNum < 1 {
+		return nil, fmt.Errorf("backtrack information step and cycle number are %d and %d, "+
+			"but they should be bigger than 1", info.stepNum, info.cycleNum)
+	}
 
-	return s.interactiveBacktracking(0, info.start, info.stepNum, info.cycleNum)
+	var res []uint64
+	cycle := uint32(0)
+	found, err := s.walk(info.start, info.stepNum, func(path []uint64) bool {
+		cycle++
+		if cycle == info.cycleNum {
+			res = append([]uint64(nil), path...)
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("shingle set only has %d paths of %d steps but cycle %d is requested",
+			cycle, info.stepNum, info.cycleNum)
+	}
+	return &res, nil
 }
 
+// BacktrackingWithString computes the cycle information of an array of chunk hashes whose shingles are all in the
+// shingle set. The peer holding the same shingle set recovers the array with BacktrackingWithCycle.
 func (s *hashShingleSet) BacktrackingWithString(hashArr []uint64) (*CycleInfo, error) {
 	if len(hashArr) == 0 {
 		return nil, fmt.Errorf("input string is empty")
 	}
-	return s.reverseInteractiveBacktracking(hashArr)
-}
-
-func (s *hashShingleSet) interactiveBacktracking(previousEdge, currentEdge uint64, stepNum, cycleNum uint16) (*[]uint64, error) {
-
-	if s == nil {
-		return nil, fmt.Errorf("input hash shingle set is empty")
+	if len(hashArr) > math.MaxUint32 {
+		return nil, fmt.Errorf("input string has %d chunks which exceeds the maximum of %d", len(hashArr), uint32(math.MaxUint32))
 	}
 
-	if stepNum < 1 || cycleNum < 1 {
-		return nil, fmt.Errorf("backtrack information step and cycle number are %d and %d, "+
-			"but they should be bigger than 1", stepNum, cycleNum)
+	cycle := uint32(0)
+	var overflow bool
+	found, err := s.walk(hashArr[0], uint32(len(hashArr)), func(path []uint64) bool {
+		if cycle == math.MaxUint32 {
+			overflow = true
+			return true
+		}
+		cycle++
+		for i := range path {
+			if path[i] != hashArr[i] {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
 	}
-
-	// backtracking with only one step.
-	if stepNum == uint16(1) {
-		return &[]uint64{currentEdge}, nil
+	if overflow {
+		return nil, fmt.Errorf("input string needs more than %d cycles to trace, %w", uint32(math.MaxUint32), ErrBacktrackingLimit)
 	}
-
-	hashArr := make([]uint64, stepNum, stepNum)
-	hashArr[0] = currentEdge
-
-	// tailChangeHistory is an array shingleTailCounts copied at the time.
-	tailChangeHistory := make([]hashShingleSet, stepNum, stepNum)
-
-	if err := s.sort(); err != nil {
-		return nil, fmt.Errorf("error sorting shingle set, %v", err)
+	if !found {
+		return nil, fmt.Errorf("input string can not be traced with the shingle set")
 	}
+	return &CycleInfo{start: hashArr[0], stepNum: uint32(len(hashArr)), cycleNum: cycle}, nil
+}
 
-	// Update the first stack of history
-	count, err := s.getShingleCount(previousEdge, currentEdge)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching first shingle")
+// walk visits every path of stepNum chunks from the start chunk in ascending hash order, where each shingle is used no
+// more than its count. It calls visit on each complete path and stops once visit returns true, which is reported by
+// the returned boolean. It returns ErrBacktrackingLimit after maxBacktrackingSteps steps.
+func (s *hashShingleSet) walk(start uint64, stepNum uint32, visit func(path []uint64) bool) (bool, error) {
+	if s == nil || len(*s) == 0 {
+		return false, fmt.Errorf("input hash shingle set is empty")
+	}
+	if !s.Exist(0, start) {
+		return false, fmt.Errorf("starting shingle of %d is not in the shingle set", start)
+	}
+
+	// remaining tracks the unused count of each shingle on the current path.
+	remaining := s.clone()
+	sortedTails := make(map[uint64][]uint64)
+	tailsOf := func(head uint64) []uint64 {
+		keys, isExist := sortedTails[head]
+		if !isExist {
+			keys = sortedTailKeys(s.getTailEdges(head))
+			sortedTails[head] = keys
+		}
+		return keys
 	}
-	err = tailChangeHistory[0].AddShingle(previousEdge, currentEdge, count-1)
-	if err != nil {
-		return nil, fmt.Errorf("error adding first shingle to changed history, %v", err)
+
+	type frame struct {
+		tails []uint64
+		next  int
 	}
+	path := make([]uint64, 1, stepNum)
+	path[0] = start
+	stack := []frame{{tails: tailsOf(start)}}
 
-	// Start backtracking from the possible edges at the 2nd history stack.
-	for i := uint16(1); i < stepNum; i++ {
-		tails := s.getTailEdges(currentEdge)
-		if tails == nil {
-			// i should only be as low as 1.
-			if i <= 1 {
-				return nil, fmt.Errorf("error getting first set of tails")
-			}
-			i = i - 1
+	for steps := 0; len(stack) > 0; steps++ {
+		if steps > maxBacktrackingSteps {
+			return false, ErrBacktrackingLimit
 		}
-		previousEdge = currentEdge
-<<<<<<< ours
-		for _, tail := range sortedTailKeys(tails) {
-=======
-		tailKeys := sortedTailKeys(tails)
-		for _, tail := range tailKeys {
->>>>>>> theirs
-			count := tails[tail]
-			currentEdge = tail
-			// get the changed shingles from last layer.
-			tailChangeHistory[i] = tailChangeHistory[i-1]
-
-			CHCount, tailCountErr := tailChangeHistory[i].getShingleCount(previousEdge, currentEdge)
-
-			if tailCountErr != ShingleNotFound && CHCount > 0 {
-				if _, err = tailChangeHistory[i].addShingleCount(currentEdge, tail, -1); err != nil {
-					return nil, fmt.Errorf("error changing tail count from history, %v", err)
-				}
-			} else if tailCountErr == ShingleNotFound && count > 0 {
-				if err = tailChangeHistory[i].AddShingle(currentEdge, tail, int(count)-1); err != nil {
-					return nil, fmt.Errorf("error adding tail count to history, %v", err)
-				}
-			} else {
-				continue
+		if uint32(len(path)) == stepNum {
+			if visit(path) {
+				return true, nil
 			}
-			hashArr[i] = tail
-			if i == stepNum-1 {
-				if cycleNum > 1 {
-					cycleNum = cycleNum - 1
-				} else {
+		} else {
+			top := &stack[len(stack)-1]
+			head := path[len(path)-1]
+			advanced := false
+			for top.next < len(top.tails) {
+				tail := top.tails[top.next]
+				top.next++
+				if count, err := remaining.getShingleCount(head, tail); err == nil && count > 0 {
+					if _, err = remaining.addShingleCount(head, tail, -1); err != nil {
+						return false, err
+					}
+					path = append(path, tail)
+					stack = append(stack, frame{tails: tailsOf(tail)})
+					advanced = true
 					break
 				}
 			}
-		}
-	}
-	return &hashArr, nil
-}
-
-func (s *hashShingleSet) reverseInteractiveBacktracking(hashArray []uint64) (*CycleInfo, error) {
-	if len(hashArray) == 1 {
-		return &CycleInfo{
-			start:    hashArray[0],
-			stepNum:  1,
-			cycleNum: 1,
-		}, nil
-	} else if len(hashArray) < 1 {
-		return nil, fmt.Errorf("empty hash array input")
-	}
-
-	cycleNum := uint16(1)
-
-	tailChangeHistory := make([]hashShingleSet, len(hashArray), len(hashArray))
-	previousEdge := uint64(0)
-	currentEdge := hashArray[0]
-
-	hashArr := make([]uint64, len(hashArray), len(hashArray))
-	hashArr[0] = currentEdge
-
-	if err := s.sort(); err != nil {
-		return nil, fmt.Errorf("error sorting shingle set, %v", err)
-	}
-
-	// Update the first stack of history
-	count, err := s.getShingleCount(previousEdge, currentEdge)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching first shingle")
-	}
-	err = tailChangeHistory[0].AddShingle(previousEdge, currentEdge, count-1)
-	if err != nil {
-		return nil, fmt.Errorf("error adding first shingle to changed history, %v", err)
-	}
-
-	// Start backtracking from the possible edges at the 2nd history stack.
-	for i := 1; i < len(hashArray); i++ {
-		tails := s.getTailEdges(currentEdge)
-		if tails == nil {
-			// i should only be as low as 1.
-			if i <= 1 {
-				return nil, fmt.Errorf("error getting first set of tails")
+			if advanced {
+				continue
 			}
-			i = i - 1
 		}
-		previousEdge = currentEdge
-<<<<<<< ours
-		for _, tail := range sortedTailKeys(tails) {
-=======
-		tailKeys := sortedTailKeys(tails)
-		for _, tail := range tailKeys {
->>>>>>> theirs
-			count := tails[tail]
-			currentEdge = tail
-			// get the changed shingles from last layer.
-			tailChangeHistory[i] = tailChangeHistory[i-1]
-
-			CHCount, tailCountErr := tailChangeHistory[i].getShingleCount(previousEdge, currentEdge)
 
-			if tailCountErr != ShingleNotFound && CHCount > 0 {
-				if _, err = tailChangeHistory[i].addShingleCount(currentEdge, tail, -1); err != nil {
-					return nil, fmt.Errorf("error changing tail count from history, %v", err)
-				}
-			} else if tailCountErr == ShingleNotFound && count > 0 {
-				if err = tailChangeHistory[i].AddShingle(currentEdge, tail, int(count)-1); err != nil {
-					return nil, fmt.Errorf("error adding tail count to history, %v", err)
-				}
-			} else {
-				continue
-			}
-			hashArray[i] = tail
-			if i == len(hashArray) {
-				if !reflect.DeepEqual(hashArr, hashArray) {
-					cycleNum = cycleNum + 1
-				} else {
-					break
-				}
+		// Backtrack to the previous chunk and give back the shingle used to get here.
+		stack = stack[:len(stack)-1]
+		if len(path) > 1 {
+			if _, err := remaining.addShingleCount(path[len(path)-2], path[len(path)-1], 1); err != nil {
+				return false, err
 			}
 		}
+		path = path[:len(path)-1]
 	}
-	return &CycleInfo{start: hashArray[0], stepNum: uint16(len(hashArray)), cycleNum: cycleNum}, nil
+	return false, nil
 }
 
 // getTailEdges gets the array of Tail Edges giving first edge.
@@ -213,47 +180,12 @@ func (s *hashShingleSet) getTailEdges(firstEdge uint64) shingleTailCount {
 	return nil
 }
 
-// sort sorts the hash shingle set and its tail counts.
-func (s *hashShingleSet) sort() error {
-	size := s.Size()
-	i := 0
-	arry := make([]shingle, size, size)
-	for f, s := range *s {
-		ta := s.toShingleArray(f)
-		copy(arry[i:i+len(ta)], ta)
-		i += len(ta)
+// clone returns a deep copy of the shingle set.
+func (s *hashShingleSet) clone() hashShingleSet {
+	c := make(hashShingleSet, len(*s))
+	for first, tails := range *s {
+		t := slices.Clone(*tails)
+		c[first] = &t
 	}
-	sort.Sort(shingles(arry))
-	s.Clear()
-	for i := range arry {
-		if err := s.AddShingle(arry[i].first, arry[i].second, arry[i].count); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func (tc *shingleTailCount) toShingleArray(first uint64) []shingle {
-	arry := make([]shingle, len(*tc), len(*tc))
-	i := 0
-	for s, c := range *tc {
-		arry[i] = shingle{
-			first:  first,
-			second: s,
-			count:  int(c),
-		}
-		i = i + 1
-	}
-	return arry
-}
-
-func sortedTailKeys(tails shingleTailCount) []uint64 {
-	keys := make([]uint64, 0, len(tails))
-	for tail := range tails {
-		keys = append(keys, tail)
-	}
-	sort.Slice(keys, func(i, j int) bool {
-		return keys[i] < keys[j]
-	})
-	return keys
+	return c
 }
@@ -102,3 +102,48 @@ func TestBacktrackingWithString(t *testing.T) {
 		assert.EqualValues(t, input.expectedCycle, *res)
 	}
 }
+
+func TestBacktrackingRoundTrip(t *testing.T) {
+	inputs := [][]uint64{
+		{7},
+		{1, 2, 3, 4},
+		// repeated chunks create several paths through the shingle set.
+		{1, 2, 1, 3, 1, 2, 4},
+		{5, 5, 5, 5},
+		{3, 1, 2, 1, 2, 1, 3, 2, 3},
+	}
+
+	for _, arr := range inputs {
+		testSet := make(hashShingleSet)
+		require.NoError(t, testSet.AddShingle(0, arr[0], 1))
+		for i := 1; i < len(arr); i++ {
+			if _, err := testSet.getShingleCount(arr[i-1], arr[i]); err != nil {
+				require.NoError(t, testSet.AddShingle(arr[i-1], arr[i], 1))
+			} else {
+				_, err = testSet.addShingleCount(arr[i-1], arr[i], 1)
+				require.NoError(t, err)
+			}
+		}
+
+		info, err := testSet.BacktrackingWithString(arr)
+		require.NoError(t, err)
+		res, err := testSet.BacktrackingWithCycle(*info)
+		require.NoError(t, err)
+		assert.EqualValues(t, arr, *res)
+	}
+}
+
+func TestBacktrackingErrors(t *testing.T) {
+	testSet := make(hashShingleSet)
+	require.NoError(t, testSet.AddShingle(0, 1, 1))
+	require.NoError(t, testSet.AddShingle(1, 2, 1))
+
+	_, err := testSet.BacktrackingWithCycle(CycleInfo{1, 2, 2})
+	assert.Error(t, err, "only one path of two steps exists")
+
+	_, err = testSet.BacktrackingWithCycle(CycleInfo{2, 1, 1})
+	assert.Error(t, err, "chunk 2 does not start the string")
+
+	_, err = testSet.BacktrackingWithString([]uint64{1, 3})
+	assert.Error(t, err, "shingle 1 : 3 does not exist")
+}
@@ -0,0 +1,156 @@
+package rcds
+
+import (
+	"io"
+	"slices"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm"
+)
+
+// readBlockSize is the least number of bytes the chunker reads from its input at once.
+const readBlockSize = 64 << 10
+
+// chunker streams the content-dependent chunks of a reader, which are the same chunks contentDependentChunking finds
+// in the entire string. It only holds the pending chunk and the window hashes within the inter-partition distance of
+// the current position, so the input does not have to fit in memory unless it has no local minimum to partition at.
+type chunker struct {
+	rd     io.Reader
+	level  PartitionLevel
+	roll   *rollingHash
+	window windowMin
+
+	// buf holds the input from offset start, which is the beginning of the pending chunk, and eof tells whether the
+	// reader has ended.
+	buf   []byte
+	start int
+	eof   bool
+	// hashes holds the window hashes from index hashStart.
+	hashes    []uint64
+	hashStart int
+
+	// i is the next position to partition at, prefilled tells whether the first 2h window hashes are in the window.
+	i         int
+	prefilled bool
+	done      bool
+}
+
+func newChunker(rd io.Reader, level PartitionLevel, hasher algorithm.Hasher) *chunker {
+	return &chunker{
+		rd:    rd,
+		level: level,
+		roll:  newRollingHash(level.RollingWindow, hasher),
+	}
+}
+
+// next returns the next chunk or io.EOF after the last chunk.
+func (c *chunker) next() ([]byte, error) {
+	if c.done {
+		return nil, io.EOF
+	}
+	h := c.level.ChunkDistance
+
+	if !c.prefilled {
+		for j := 0; j < 2*h; j++ {
+			ok, err := c.hashTo(j)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return c.last()
+			}
+			c.window.put(j, c.hash(j))
+		}
+		c.i = h
+		c.prefilled = true
+	}
+
+	for {
+		ok, err := c.hashTo(c.i + h)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return c.last()
+		}
+		c.window.put(c.i+h, c.hash(c.i+h))
+
+		var chunk []byte
+		// Partition at i if it has been h distance since the last partition and i is the local minimum.
+		if c.i-c.start > h && c.window.min(c.i-h) == c.hash(c.i) {
+			n := c.i - c.start
+			chunk = c.buf[:n:n]
+			c.buf = c.buf[n:]
+			c.start = c.i
+		}
+		c.i++
+		c.trimHashes()
+		if chunk != nil {
+			return chunk, nil
+		}
+	}
+}
+
+// last returns the rest of the input as the last chunk.
+func (c *chunker) last() ([]byte, error) {
+	c.done = true
+	if len(c.buf) == 0 {
+		return nil, io.EOF
+	}
+	return c.buf, nil
+}
+
+// hashTo computes the window hashes up to the index j and returns false if the input ends before the window at j.
+func (c *chunker) hashTo(j int) (bool, error) {
+	r := c.level.RollingWindow
+	if err := c.fill(j + r); err != nil {
+		return false, err
+	}
+	if c.start+len(c.buf) < j+r {
+		return false, nil
+	}
+	space := uint64(c.level.HashSpace)
+	for next := c.hashStart + len(c.hashes); next <= j; next++ {
+		if next == 0 {
+			c.roll.reset(string(c.buf[:r]))
+		} else {
+			c.roll.roll(c.at(next-1), c.at(next+r-1))
+		}
+		c.hashes = append(c.hashes, c.roll.hash%space)
+	}
+	return true, nil
+}
+
+// fill reads the input up to the offset n, or to its end, in blocks of at least readBlockSize.
+func (c *chunker) fill(n int) error {
+	for !c.eof && c.start+len(c.buf) < n {
+		// Chunks handed out share the array of buf, which is why it is only ever grown into a new array.
+		c.buf = slices.Grow(c.buf, readBlockSize)
+		m, err := c.rd.Read(c.buf[len(c.buf):cap(c.buf)])
+		c.buf = c.buf[:len(c.buf)+m]
+		if err == io.EOF {
+			c.eof = true
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// at returns the input byte at the offset, which must not be before the pending chunk.
+func (c *chunker) at(offset int) byte {
+	return c.buf[offset-c.start]
+}
+
+func (c *chunker) hash(j int) uint64 {
+	return c.hashes[j-c.hashStart]
+}
+
+// trimHashes drops the window hashes before the window of the current position once enough of them pile up.
+func (c *chunker) trimHashes() {
+	n := c.i - c.level.ChunkDistance - c.hashStart
+	if n < 4096 {
+		return
+	}
+	c.hashes = c.hashes[:copy(c.hashes, c.hashes[n:])]
+	c.hashStart += n
+}
@@ -0,0 +1,76 @@
+package rcds
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/rand"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm"
+)
+
+func TestChunker(t *testing.T) {
+	repeated := rand.String(100)
+	inputs := []string{
+		"",
+		"a",
+		"abc",
+		"iHeart Victoria",
+		rand.String(20000),
+		repeated + repeated + repeated + rand.String(500) + repeated,
+	}
+	levels := []PartitionLevel{
+		{ChunkDistance: 0, RollingWindow: 1, HashSpace: 16},
+		{ChunkDistance: 1, RollingWindow: 2, HashSpace: 2},
+		{ChunkDistance: 2, RollingWindow: 3, HashSpace: 16},
+		{ChunkDistance: 16, RollingWindow: 8, HashSpace: 64},
+		{ChunkDistance: 256, RollingWindow: 16, HashSpace: 1024},
+	}
+
+	for _, s := range inputs {
+		for _, level := range levels {
+			var expected []string
+			if len(s) > 0 {
+				var err error
+				expected, err = contentDependentChunking(&s, level.ChunkDistance, level.RollingWindow, level.HashSpace, algorithm.DefaultHasher)
+				require.NoError(t, err)
+			}
+
+			c := newChunker(bytes.NewReader([]byte(s)), level, algorithm.DefaultHasher)
+			var actual []string
+			for {
+				chunk, err := c.next()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				actual = append(actual, string(chunk))
+			}
+			assert.Equal(t, expected, actual, "input of %d bytes with %+v", len(s), level)
+
+			_, err := c.next()
+			assert.Equal(t, io.EOF, err)
+		}
+	}
+}
+
+func BenchmarkChunker(b *testing.B) {
+	raw := []byte(rand.String(16 << 20))
+	level := PartitionLevel{ChunkDistance: defaultH, RollingWindow: defaultRollingR, HashSpace: defaultHashSpace}
+	b.SetBytes(int64(len(raw)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c := newChunker(bytes.NewReader(raw), level, algorithm.DefaultHasher)
+		for {
+			if _, err := c.next(); err == io.EOF {
+				break
+			} else if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -3,8 +3,6 @@ package rcds
 import (
 	"fmt"
 
-	rbtree "github.com/emirpasic/gods/trees/redblacktree"
-	"github.com/emirpasic/gods/utils"
 	logger "sigs.k8s.io/controller-runtime/pkg/log"
 
 	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm"
@@ -13,38 +11,11 @@ import (
 // global log for algorithm
 var log = logger.Log.WithName("algorithm")
 
-// stringToHashContent converts string into an array of content hash values with the rolling hash algorithm and
-// returns error if fails in anyway.
-// TODO: Use threads to fill up content hashes
-func stringToHashContent(s *string, rollingWinSize, hashSpace int) (*[]uint64, error) {
-	if rollingWinSize < 1 {
-		return nil, fmt.Errorf("rolling window size should be one or bigger")
-	}
-	if hashSpace < 0 {
-		return nil, fmt.Errorf("hash space should be a non-negative value")
-	}
-
-	contentHashSize := len(*s) - rollingWinSize + 1
-	if contentHashSize < 1 {
-		return nil, fmt.Errorf("rolling windows size is bigger than string input")
-	}
-	contentHash := make([]uint64, contentHashSize)
-
-	for i := 0; i < contentHashSize; i++ {
-		hash, err := algorithm.HashString((*s)[i : i+rollingWinSize]).ToUint64()
-		if err != nil {
-			return nil, err
-		}
-		contentHash[i] = hash % uint64(hashSpace)
-	}
-	return &contentHash, nil
-}
-
 // contentDependentChunking partitions a string into several partitions based on content hash values.
 // This uses Local minimum chunking. It looks h distances forward and backwards and partition if the middle element is
-// the local minimum. It uses stringToHashContent to convert the string into an array of hashes r as rolling windows size
-// and hs as hash space.
-func contentDependentChunking(s *string, h, r, hs int) (chunks []string, err error) {
+// the local minimum. It uses stringToHashContentParallel to convert the string into an array of hashes r as rolling
+// windows size and hs as hash space. Inputs of parallelHashThreshold bytes or more are hashed by parallel workers.
+func contentDependentChunking(s *string, h, r, hs int, hasher algorithm.Hasher) (chunks []string, err error) {
 	// Sanity check for string and inter-partition distance.
 	if len(*s) == 0 {
 		return chunks, fmt.Errorf("empty input string")
@@ -58,32 +29,66 @@ func contentDependentChunking(s *string, h, r, hs int) (chunks []string, err err
 	}
 
 	// Convert string into an array of hashes.
-	hArr, err := stringToHashContent(s, r, hs)
+	hArr, err := stringToHashContentParallel(s, r, hs, hasher, hashWorkers(len(*s)))
 	if err != nil {
 		log.V(2).Info(fmt.Sprintf("failed to convert string to hash array: '%s'", *s))
 		return nil, fmt.Errorf("error converting string into an hash array, %v", err)
 	}
 
-	// Prefill rb-tree to 2*h of the hash array.
-	rbt := rbtree.NewWith(utils.UInt64Comparator)
+	// Prefill the window with 2*h of the hash array.
+	var window windowMin
 	for i := 0; i < 2*h; i++ {
-		rbt.Put((*hArr)[i], nil)
+		window.put(i, (*hArr)[i])
 	}
 
 	parIdx := 0
 
-	// Fills rb-tree as we go to the end of the string and evaluate if the middle number is the local minimum.
+	// Fills the window as we go to the end of the string and evaluate if the middle number is the local minimum.
 	for i := h; i < len(*hArr)-h; i++ {
 		// Add the last member in the window
-		rbt.Put((*hArr)[i+h], nil)
+		window.put(i+h, (*hArr)[i+h])
 		// If the middle element is a local minimum and it has been h distance since the last partition,
 		// partition at i and move the last partition idx
-		if i-parIdx > h && rbt.Left().Key == (*hArr)[i] {
+		if i-parIdx > h && window.min(i-h) == (*hArr)[i] {
 			chunks = append(chunks, (*s)[parIdx:i])
 			parIdx = i
 		}
-		// kick the last leftest element out of the window.
-		rbt.Remove((*hArr)[i-h])
 	}
 	return append(chunks, (*s)[parIdx:]), nil
 }
+
+// windowMin keeps the minimum of the hashes in a window sliding over the positions of a string. It is a deque of the
+// hashes that are smaller than every hash put after them, which therefore increase from the front, so that each hash is
+// put and dropped once. The minimum only depends on the hashes within the window, which lets edits re-chunk only the
+// region around them.
+type windowMin struct {
+	hashes []windowHash
+	// head is the index of the front of the deque in hashes.
+	head int
+}
+
+type windowHash struct {
+	pos  int
+	hash uint64
+}
+
+// put adds the hash at the position, which follows the positions put before.
+func (w *windowMin) put(pos int, hash uint64) {
+	for len(w.hashes) > w.head && w.hashes[len(w.hashes)-1].hash > hash {
+		w.hashes = w.hashes[:len(w.hashes)-1]
+	}
+	// Reuse the space of the dropped front once it is half of the deque.
+	if w.head > 0 && w.head >= len(w.hashes)-w.head {
+		w.hashes = w.hashes[:copy(w.hashes, w.hashes[w.head:])]
+		w.head = 0
+	}
+	w.hashes = append(w.hashes, windowHash{pos: pos, hash: hash})
+}
+
+// min returns the minimum of the hashes from the position on, dropping the hashes before it.
+func (w *windowMin) min(from int) uint64 {
+	for w.hashes[w.head].pos < from {
+		w.head++
+	}
+	return w.hashes[w.head].hash
+}
@@ -4,20 +4,63 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/rand"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm"
 )
 
 func TestStringToHashContent(t *testing.T) {
 	tmpStr := "iHeartVictoria"
-	strVal, err := stringToHashContent(&tmpStr, 3, 16)
+	strVal, err := stringToHashContent(&tmpStr, 3, 16, algorithm.DefaultHasher)
 	assert.NoError(t, err)
 	assert.Equal(t, 12, len(*strVal))
 
 	singleChar := "i"
-	_, err = stringToHashContent(&singleChar, 1, 16)
+	_, err = stringToHashContent(&singleChar, 1, 16, algorithm.DefaultHasher)
 	assert.NoError(t, err)
 
 	emptyString := ""
-	_, err = stringToHashContent(&emptyString, 3, 16)
+	_, err = stringToHashContent(&emptyString, 3, 16, algorithm.DefaultHasher)
+	assert.Error(t, err)
+}
+
+func TestRollingHash(t *testing.T) {
+	s := rand.String(1000)
+	for _, window := range []int{1, 3, 16, 64, 100} {
+		rolled := newRollingHash(window, algorithm.DefaultHasher)
+		rolled.reset(s[:window])
+		for i := 1; i+window <= len(s); i++ {
+			rolled.roll(s[i-1], s[i+window-1])
+			fresh := newRollingHash(window, algorithm.DefaultHasher)
+			fresh.reset(s[i : i+window])
+			require.Equal(t, fresh.hash, rolled.hash, "window %d at %d", window, i)
+		}
+	}
+
+	// Tables derive from the hasher, so different hashers hash the windows differently.
+	a, b := newRollingHash(8, algorithm.NewFNVHasher()), newRollingHash(8, algorithm.NewXXHasher())
+	a.reset(s[:8])
+	b.reset(s[:8])
+	assert.NotEqual(t, a.hash, b.hash)
+}
+
+func TestStringToHashContentParallel(t *testing.T) {
+	s := rand.String(10007)
+	expected, err := stringToHashContent(&s, 16, 1024, algorithm.DefaultHasher)
+	require.NoError(t, err)
+	for _, workers := range []int{2, 3, 8, 64} {
+		actual, err := stringToHashContentParallel(&s, 16, 1024, algorithm.DefaultHasher, workers)
+		require.NoError(t, err)
+		assert.Equal(t, *expected, *actual, "%d workers", workers)
+	}
+
+	short := "abcd"
+	actual, err := stringToHashContentParallel(&short, 2, 16, algorithm.DefaultHasher, 8)
+	require.NoError(t, err)
+	assert.Len(t, *actual, 3)
+
+	_, err = stringToHashContentParallel(&s, 16, 1024, algorithm.DefaultHasher, 0)
 	assert.Error(t, err)
 }
 
@@ -81,7 +124,7 @@ func TestContentDependentChunking(t *testing.T) {
 	}
 
 	for _, in := range inputs {
-		chunks, err := contentDependentChunking(&in.s, in.h, in.r, in.hs)
+		chunks, err := contentDependentChunking(&in.s, in.h, in.r, in.hs, algorithm.DefaultHasher)
 		if in.expectingError {
 			assert.Error(t, err, "expect error from input: %v", in)
 			assert.Empty(t, chunks)
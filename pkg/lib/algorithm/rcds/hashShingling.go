@@ -4,8 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"slices"
+	"sort"
 
 	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm"
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/util"
 )
 
 type shingle struct {
@@ -23,9 +26,40 @@ func (s shingles) Less(i, j int) bool {
 }
 func (s shingles) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
 
+// shingleElemSize is the length of a shingle encoded as a set element, which is the partition level, head, tail and
+// count.
+const shingleElemSize = 32
+
+// toBytes encodes a shingle of a partition level into a fixed length element for set reconciliation.
+func (s shingle) toBytes(level int) []byte {
+	b := make([]byte, 0, shingleElemSize)
+	b = append(b, util.Uint64ToBytes(uint64(level))...)
+	b = append(b, util.Uint64ToBytes(s.first)...)
+	b = append(b, util.Uint64ToBytes(s.second)...)
+	return append(b, util.Uint64ToBytes(uint64(s.count))...)
+}
+
+// bytesToShingle decodes a shingle and its partition level encoded by toBytes.
+func bytesToShingle(b []byte) (int, shingle, error) {
+	if len(b) != shingleElemSize {
+		return 0, shingle{}, fmt.Errorf("encoded shingle should be %d bytes but got %d", shingleElemSize, len(b))
+	}
+	return int(util.BytesToUint64(b[:8])), shingle{
+		first:  util.BytesToUint64(b[8:16]),
+		second: util.BytesToUint64(b[16:24]),
+		count:  int(util.BytesToUint64(b[24:])),
+	}, nil
+}
+
 // We use 2-shingle method because backtracking is efficient enough for constant number of shingles. The local shingle
-// store is a double map -> map [shingle head] map [shingle tail] count.
-type shingleTailCount map[uint64]uint16
+// store maps each shingle head to its tails and their counts, which are kept in a slice sorted by tail since most
+// heads only have a few tails and a slice holds them in a fraction of the memory of a map.
+type shingleTailCount []tailCount
+
+type tailCount struct {
+	tail  uint64
+	count uint16
+}
 
 // shingle sets are defined by hash shingles and their count within the set.
 type hashShingleSet map[uint64]*shingleTailCount
@@ -60,7 +94,7 @@ func (s *hashShingleSet) AddShingle(first, second uint64, count int) error {
 func (s *hashShingleSet) RemoveShingle(first, second uint64) {
 	firstRef, refExist := (*s)[first]
 	if refExist && firstRef != nil {
-		delete(*firstRef, second)
+		firstRef.remove(second)
 		if len(*firstRef) == 0 {
 			delete(*s, first)
 		}
@@ -71,8 +105,8 @@ func (s *hashShingleSet) RemoveShingle(first, second uint64) {
 func (s *hashShingleSet) RemoveSpecShingle(first, second uint64, count uint16) error {
 	firstRef, refExist := (*s)[first]
 	if refExist && firstRef != nil {
-		if val, isExist := (*firstRef)[second]; isExist && val == count {
-			delete(*firstRef, second)
+		if i, isExist := firstRef.find(second); isExist && (*firstRef)[i].count == count {
+			firstRef.remove(second)
 			if len(*firstRef) == 0 {
 				delete(*s, first)
 			}
@@ -84,25 +118,25 @@ func (s *hashShingleSet) RemoveSpecShingle(first, second uint64, count uint16) e
 
 // convertChunksToShingleSet converts an array of substrings to a set of shingles.
 // This conversion creates a shingle set of one array of substrings and should be merged into the local shingle set.
-func (s *hashShingleSet) addChunksToShingleSet(chunks *[]string) (*algorithm.Dictionary, error) {
+func (s *hashShingleSet) addChunksToShingleSet(chunks *[]string, hasher algorithm.Hasher) (*algorithm.Dictionary, error) {
 	if len(*chunks) == 0 {
 		return nil, fmt.Errorf("input array of strings is empty")
 	}
 
 	dict := make(algorithm.Dictionary, len(*chunks))
 
-	hash, err := dict.AddToDict((*chunks)[0])
+	hash, err := dict.AddToDict((*chunks)[0], hasher)
 	if err != nil {
 		return nil, err
 	}
 	s.AddShingle(0, hash, 1)
 
 	for i := 1; i < len(*chunks); i++ {
-		first, err := dict.AddToDict((*chunks)[i-1])
+		first, err := dict.AddToDict((*chunks)[i-1], hasher)
 		if err != nil {
 			return nil, err
 		}
-		second, err := dict.AddToDict((*chunks)[i])
+		second, err := dict.AddToDict((*chunks)[i], hasher)
 		if err != nil {
 			return nil, err
 		}
@@ -117,11 +151,59 @@ func (s *hashShingleSet) addChunksToShingleSet(chunks *[]string) (*algorithm.Dic
 	return &dict, nil
 }
 
+// addHashSequence adds the shingles of an array of chunk hashes, where the first chunk is marked by a shingle with a
+// zero head. Repeated shingles increase the count.
+func (s *hashShingleSet) addHashSequence(hashes []uint64) error {
+	prev := uint64(0)
+	for _, h := range hashes {
+		if err := s.incrementShingle(prev, h); err != nil {
+			return err
+		}
+		prev = h
+	}
+	return nil
+}
+
+// removeHashSequence removes the shingles added by addHashSequence for the same array of chunk hashes.
+func (s *hashShingleSet) removeHashSequence(hashes []uint64) error {
+	prev := uint64(0)
+	for _, h := range hashes {
+		if err := s.decrementShingle(prev, h); err != nil {
+			return err
+		}
+		prev = h
+	}
+	return nil
+}
+
+// incrementShingle adds one to the count of a shingle, adding the shingle if it does not exist.
+func (s *hashShingleSet) incrementShingle(first, second uint64) error {
+	if s.Exist(first, second) {
+		_, err := s.addShingleCount(first, second, 1)
+		return err
+	}
+	return s.AddShingle(first, second, 1)
+}
+
+// decrementShingle subtracts one from the count of a shingle and removes the shingle when the count drops to zero.
+func (s *hashShingleSet) decrementShingle(first, second uint64) error {
+	count, err := s.addShingleCount(first, second, -1)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		s.RemoveShingle(first, second)
+	}
+	return nil
+}
+
 // addToHashShingleSet adds a hash shingle set to the local set of hash shingles.
 func (s *hashShingleSet) addToHashShingleSet(shingleSet *hashShingleSet) error {
-	for first, tailMap := range *shingleSet {
-		for second, count := range *tailMap {
-			return s.AddShingle(first, second, int(count))
+	for first, tails := range *shingleSet {
+		for _, tc := range *tails {
+			if err := s.AddShingle(first, tc.tail, int(tc.count)); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
@@ -130,9 +212,9 @@ func (s *hashShingleSet) addToHashShingleSet(shingleSet *hashShingleSet) error {
 // removeFromHashShingleSet removes shingles from the local shingle set. It returns error if the shingle does not exist
 // or the shingle count is different.
 func (s *hashShingleSet) removeFromHashShingleSet(shingleSet *hashShingleSet) error {
-	for first, tailMap := range *shingleSet {
-		for second, count := range *tailMap {
-			if err := s.RemoveSpecShingle(first, second, count); err != nil {
+	for first, tails := range *shingleSet {
+		for _, tc := range *tails {
+			if err := s.RemoveSpecShingle(first, tc.tail, tc.count); err != nil {
 				return fmt.Errorf("error removing shingle from set, %v", err)
 			}
 		}
@@ -144,8 +226,8 @@ func (s *hashShingleSet) removeFromHashShingleSet(shingleSet *hashShingleSet) er
 func (s *hashShingleSet) getShingleCount(first, second uint64) (int, error) {
 	firstRef, refExist := (*s)[first]
 	if refExist && firstRef != nil {
-		if val, isExist := (*firstRef)[second]; isExist {
-			return int(val), nil
+		if i, isExist := firstRef.find(second); isExist {
+			return int((*firstRef)[i].count), nil
 		}
 	}
 	return 0, ShingleNotFound
@@ -154,19 +236,29 @@ func (s *hashShingleSet) getShingleCount(first, second uint64) (int, error) {
 // Exist checks if a shingle exist in a set regardless of its count.
 func (s *hashShingleSet) Exist(first, second uint64) bool {
 	if firstRef, refExist := (*s)[first]; refExist && firstRef != nil {
-		if _, isExist := (*firstRef)[second]; isExist {
+		if _, isExist := firstRef.find(second); isExist {
 			return true
 		}
 	}
 	return false
 }
 
+// toShingles lists every shingle within the set in sorted order.
+func (s *hashShingleSet) toShingles() shingles {
+	arr := make(shingles, 0, s.Size())
+	for first, tails := range *s {
+		for _, tc := range *tails {
+			arr = append(arr, shingle{first: first, second: tc.tail, count: int(tc.count)})
+		}
+	}
+	sort.Sort(arr)
+	return arr
+}
+
 // Clear deletes all shingles within the set.
 func (s *hashShingleSet) Clear() {
 	for first, tail := range *s {
-		for second := range *tail {
-			delete(*tail, second)
-		}
+		*tail = (*tail)[:0]
 		delete(*s, first)
 	}
 }
@@ -199,11 +291,33 @@ func (s *hashShingleSet) addShingleCount(first, second uint64, val int) (int, er
 	return 0, fmt.Errorf("shingle %d : %d does not exist", first, second)
 }
 
+// find returns the index of the tail, or the index to insert it at, and whether it exists.
+func (tc *shingleTailCount) find(tail uint64) (int, bool) {
+	i := sort.Search(len(*tc), func(i int) bool { return (*tc)[i].tail >= tail })
+	return i, i < len(*tc) && (*tc)[i].tail == tail
+}
+
+// put sets the count of the tail, adding the tail if it does not exist.
+func (tc *shingleTailCount) put(tail uint64, count uint16) {
+	if i, isExist := tc.find(tail); isExist {
+		(*tc)[i].count = count
+	} else {
+		*tc = slices.Insert(*tc, i, tailCount{tail: tail, count: count})
+	}
+}
+
+// remove deletes the tail if it exists.
+func (tc *shingleTailCount) remove(tail uint64) {
+	if i, isExist := tc.find(tail); isExist {
+		*tc = slices.Delete(*tc, i, i+1)
+	}
+}
+
 // addCount adds the count to the tail.
 func (tc *shingleTailCount) addCount(tail uint64, val int) (int, error) {
-	res := int((*tc)[tail]) + val
+	res := tc.getCount(tail) + val
 	if res >= 0 && res <= math.MaxUint16 {
-		(*tc)[tail] = uint16(res)
+		tc.put(tail, uint16(res))
 	} else {
 		return 0, fmt.Errorf("edge count %d is not between 0 and %d", res, math.MaxUint16)
 	}
@@ -213,7 +327,7 @@ func (tc *shingleTailCount) addCount(tail uint64, val int) (int, error) {
 // setCount sets tail count to a uint16 number and returns error if count input is negative or larger than the upper bound.
 func (tc *shingleTailCount) setCount(tail uint64, count int) error {
 	if count < math.MaxUint16 && count >= 0 {
-		(*tc)[tail] = uint16(count)
+		tc.put(tail, uint16(count))
 		return nil
 	}
 	return fmt.Errorf("tail count is %d, which should be a non-negative value and not exceeding %d", count, math.MaxUint16)
@@ -222,18 +336,14 @@ func (tc *shingleTailCount) setCount(tail uint64, count int) error {
 
 // getCount returns the count of a tail or 0 if not found.
 func (tc *shingleTailCount) getCount(tail uint64) int {
-	count, tailExist := (*tc)[tail]
+	i, tailExist := tc.find(tail)
 	if !tailExist {
 		return 0
 	}
-	return int(count)
+	return int((*tc)[i].count)
 }
 
 // tailExists checks if a tail exist. It returns false for both non-existing tail and tail with zero count.
 func (tc *shingleTailCount) tailExists(tail uint64) bool {
-	count, tailExists := (*tc)[tail]
-	if !tailExists || count == 0 {
-		return false
-	}
-	return true
+	return tc.getCount(tail) > 0
 }
@@ -39,13 +39,13 @@ func TestRemoveFromHashShingleSet(t *testing.T) {
 	testShingleSet := make(hashShingleSet)
 
 	testShingleSet.AddShingle(3, 2, 1)
-	rmShingleSet := hashShingleSet{3: {2: 1}}
+	rmShingleSet := hashShingleSet{3: {{tail: 2, count: 1}}}
 	err := testShingleSet.removeFromHashShingleSet(&rmShingleSet)
 	assert.NoError(t, err)
 	assert.Zero(t, len(testShingleSet))
 
 	// Test function throwing error if removing shingle does not exist.
-	nonExistingShingle := hashShingleSet{400: {400: 400}}
+	nonExistingShingle := hashShingleSet{400: {{tail: 400, count: 400}}}
 	isExist := testShingleSet.Exist(400, 400)
 	require.False(t, isExist)
 	err = testShingleSet.removeFromHashShingleSet(&nonExistingShingle)
@@ -53,7 +53,7 @@ func TestRemoveFromHashShingleSet(t *testing.T) {
 
 	// Test function throwing error if removing shingle has different count.
 	testShingleSet.AddShingle(400, 400, 400)
-	wrongShingleCount := hashShingleSet{400: {400: 300}}
+	wrongShingleCount := hashShingleSet{400: {{tail: 400, count: 300}}}
 	count, err := testShingleSet.getShingleCount(400, 400)
 	require.NoError(t, err)
 	require.Equal(t, 400, count)
@@ -95,7 +95,7 @@ func TestConvertChunksToShingleSet(t *testing.T) {
 		},
 	}
 	for _, in := range input {
-		dict, err := testShingleSet.addChunksToShingleSet(&in.arr)
+		dict, err := testShingleSet.addChunksToShingleSet(&in.arr, algorithm.DefaultHasher)
 		if in.noError {
 			assert.NoError(t, err, "error converting", in)
 			assert.Equal(t, in.setSize, len(*dict))
@@ -107,7 +107,7 @@ func TestConvertChunksToShingleSet(t *testing.T) {
 	testShingleSet.Clear()
 
 	// Test shingle counting.
-	_, err := testShingleSet.addChunksToShingleSet(&[]string{"abc", "abc", "abc"})
+	_, err := testShingleSet.addChunksToShingleSet(&[]string{"abc", "abc", "abc"}, algorithm.DefaultHasher)
 	require.NoError(t, err, "error converting string chunks into shingle set")
 	hash, err := algorithm.HashString("abc").ToUint64()
 	require.NoError(t, err, "error converting string to hash")
@@ -0,0 +1,272 @@
+package rcds
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// SyncMode selects which peer's string changes in a sync. The client chooses the mode and sends it to the server.
+type SyncMode uint8
+
+const (
+	// PullMode replaces the client string with the server string.
+	PullMode SyncMode = iota
+	// PushMode replaces the server string with the client string.
+	PushMode
+	// MergeMode merges the server string into the client string against a common base given by WithMergeBase and
+	// replaces both strings with the merged string, unless the peers changed a region of the base differently.
+	MergeMode
+)
+
+func (m SyncMode) String() string {
+	switch m {
+	case PullMode:
+		return "pull"
+	case PushMode:
+		return "push"
+	case MergeMode:
+		return "merge"
+	default:
+		return fmt.Sprintf("SyncMode(%d)", uint8(m))
+	}
+}
+
+// ErrMergeConflict is returned by a merge in which the local and remote strings changed a region of the base
+// differently. The conflicting regions are reported by ConflictReporter.
+var ErrMergeConflict = errors.New("local and remote strings have conflicting changes")
+
+// Conflict is a region of the merge base that the local and the remote strings changed differently. The base region
+// is empty if both inserted different bytes at the same offset.
+type Conflict struct {
+	BaseOffset int
+	Base       []byte
+	Local      []byte
+	Remote     []byte
+}
+
+// ConflictReporter reports the conflicts of the last merge. The syncs created by this package implement it.
+type ConflictReporter interface {
+	Conflicts() []Conflict
+}
+
+// Conflicts returns the conflicting regions of the last merge, which is empty unless the sync returned
+// ErrMergeConflict.
+func (r *rcdsSync) Conflicts() []Conflict {
+	return r.conflicts
+}
+
+// merge merges the remote string into the local string against the merge base. The strings are compared by the
+// sequences of their leaf chunks, so a change is reported at the granularity of the lowest partition level.
+func (r *rcdsSync) merge(remote *partitionTree) ([]byte, []Conflict, error) {
+	base, err := newPartitionTree(r.mergeBase, r.levels, r.hasher)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, l, o := newLeafSequence(base), newLeafSequence(r.tree), newLeafSequence(remote)
+	localMatches := matchIndexes(b.hashes, l.hashes)
+	remoteMatches := matchIndexes(b.hashes, o.hashes)
+
+	var merged bytes.Buffer
+	var conflicts []Conflict
+	i, j, k := 0, 0, 0
+	for {
+		// Find the next base chunk that both strings kept, which ends the region changed by either side.
+		next := i
+		for next < len(b.hashes) && (localMatches[next] < 0 || remoteMatches[next] < 0) {
+			next++
+		}
+		nextJ, nextK := len(l.hashes), len(o.hashes)
+		if next < len(b.hashes) {
+			nextJ, nextK = localMatches[next], remoteMatches[next]
+		}
+
+		if next > i || nextJ > j || nextK > k {
+			baseChanged, localChanged, remoteChanged := b.slice(i, next), l.slice(j, nextJ), o.slice(k, nextK)
+			var take *leafSequence
+			var from, to int
+			switch {
+			case equalHashes(localChanged, baseChanged):
+				take, from, to = o, k, nextK
+			case equalHashes(remoteChanged, baseChanged), equalHashes(localChanged, remoteChanged):
+				take, from, to = l, j, nextJ
+			}
+			if take != nil {
+				if err = take.writeTo(&merged, from, to); err != nil {
+					return nil, nil, err
+				}
+			} else {
+				c := Conflict{BaseOffset: b.offset(i)}
+				if c.Base, err = b.content(i, next); err != nil {
+					return nil, nil, err
+				}
+				if c.Local, err = l.content(j, nextJ); err != nil {
+					return nil, nil, err
+				}
+				if c.Remote, err = o.content(k, nextK); err != nil {
+					return nil, nil, err
+				}
+				conflicts = append(conflicts, c)
+			}
+		}
+		if next == len(b.hashes) {
+			break
+		}
+
+		if err = l.writeTo(&merged, nextJ, nextJ+1); err != nil {
+			return nil, nil, err
+		}
+		i, j, k = next+1, nextJ+1, nextK+1
+	}
+	return merged.Bytes(), conflicts, nil
+}
+
+// leafSequence is the sequence of leaf chunks of a partition tree.
+type leafSequence struct {
+	tree   *partitionTree
+	leaves []partitionNode
+	hashes []uint64
+}
+
+func newLeafSequence(tree *partitionTree) *leafSequence {
+	s := &leafSequence{tree: tree, leaves: tree.leaves()}
+	s.hashes = make([]uint64, len(s.leaves))
+	for i, leaf := range s.leaves {
+		s.hashes[i] = tree.hash(leaf)
+	}
+	return s
+}
+
+func (s *leafSequence) slice(from, to int) []uint64 {
+	return s.hashes[from:to]
+}
+
+// offset returns the offset of a leaf in the string.
+func (s *leafSequence) offset(i int) int {
+	if i == len(s.leaves) {
+		return s.tree.size
+	}
+	return s.tree.offset(s.leaves[i])
+}
+
+func (s *leafSequence) writeTo(buf *bytes.Buffer, from, to int) error {
+	for _, leaf := range s.leaves[from:to] {
+		c, err := s.tree.content(leaf)
+		if err != nil {
+			return err
+		}
+		buf.Write(c)
+	}
+	return nil
+}
+
+func (s *leafSequence) content(from, to int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := s.writeTo(&buf, from, to); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func equalHashes(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// matchIndexes finds a longest common subsequence of a and b and returns, for each element of a, the index of the
+// element of b it is matched to, or -1. It trims the common prefix and suffix and uses the Myers difference algorithm
+// for the rest, which takes time and memory proportional to the square of the number of differences.
+func matchIndexes(a, b []uint64) []int {
+	res := make([]int, len(a))
+	for i := range res {
+		res[i] = -1
+	}
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		res[prefix] = prefix
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		res[len(a)-1-suffix] = len(b) - 1 - suffix
+		suffix++
+	}
+	for _, m := range myersMatches(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		res[prefix+m[0]] = prefix + m[1]
+	}
+	return res
+}
+
+// myersMatches returns the index pairs of a longest common subsequence of a and b in order.
+func myersMatches(a, b []uint64) [][2]int {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return nil
+	}
+	max := n + m
+	v := make([]int, 2*max+2)
+	// trace[d] holds the furthest x on the diagonals -d to d after d differences.
+	var trace [][]int
+	found := false
+	for d := 0; d <= max && !found; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[max+k-1] < v[max+k+1]) {
+				x = v[max+k+1]
+			} else {
+				x = v[max+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[max+k] = x
+			if x >= n && y >= m {
+				found = true
+			}
+		}
+		trace = append(trace, append([]int(nil), v[max-d:max+d+1]...))
+	}
+
+	var res [][2]int
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		furthest := func(k int) int { return prev[k+d-1] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && furthest(k-1) < furthest(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := furthest(prevK)
+		startX := prevX
+		if prevK == k-1 {
+			startX++
+		}
+		for x > startX {
+			x--
+			y--
+			res = append(res, [2]int{x, y})
+		}
+		x, y = prevX, prevX-prevK
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		res = append(res, [2]int{x, y})
+	}
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return res
+}
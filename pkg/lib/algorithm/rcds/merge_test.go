@@ -0,0 +1,108 @@
+package rcds
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/rand"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm"
+)
+
+func TestMatchIndexes(t *testing.T) {
+	lcsLength := func(a, b []uint64) int {
+		dp := make([][]int, len(a)+1)
+		for i := range dp {
+			dp[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					dp[i][j] = dp[i+1][j+1] + 1
+				} else {
+					dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+				}
+			}
+		}
+		return dp[0][0]
+	}
+	randomSeq := func(n int) []uint64 {
+		s := make([]uint64, n)
+		for i := range s {
+			s[i] = uint64(rand.Intn(5))
+		}
+		return s
+	}
+
+	for i := 0; i < 500; i++ {
+		a, b := randomSeq(rand.Intn(30)), randomSeq(rand.Intn(30))
+		matches := matchIndexes(a, b)
+		require.Len(t, matches, len(a))
+		count, last := 0, -1
+		for i, j := range matches {
+			if j < 0 {
+				continue
+			}
+			require.Greater(t, j, last, "matches should be increasing")
+			require.Equal(t, a[i], b[j])
+			last = j
+			count++
+		}
+		require.Equal(t, lcsLength(a, b), count, "%v and %v", a, b)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	levels := []PartitionLevel{
+		{ChunkDistance: 16, RollingWindow: 4, HashSpace: 256},
+		{ChunkDistance: 4, RollingWindow: 4, HashSpace: 256},
+	}
+	base := []byte(rand.String(8000))
+	splice := func(s []byte, offset, deleted int, data string) []byte {
+		return append(append(append([]byte(nil), s[:offset]...), data...), s[offset+deleted:]...)
+	}
+	merge := func(base, local, remote []byte) ([]byte, []Conflict) {
+		s, err := NewRCDSSetSync(WithPartitionLevels(levels...), WithMergeBase(base))
+		require.NoError(t, err)
+		require.NoError(t, s.AddElement(local))
+		r := s.(*rcdsSync)
+		remoteTree, err := newPartitionTree(remote, levels, algorithm.DefaultHasher)
+		require.NoError(t, err)
+		merged, conflicts, err := r.merge(remoteTree)
+		require.NoError(t, err)
+		return merged, conflicts
+	}
+
+	// Edits far apart merge cleanly in either direction.
+	local := splice(base, 1000, 50, "local edit")
+	remote := splice(base, 6000, 0, "remote insertion")
+	expected := splice(splice(base, 6000, 0, "remote insertion"), 1000, 50, "local edit")
+	merged, conflicts := merge(base, local, remote)
+	assert.Empty(t, conflicts)
+	assert.Equal(t, string(expected), string(merged))
+	merged, conflicts = merge(base, remote, local)
+	assert.Empty(t, conflicts)
+	assert.Equal(t, string(expected), string(merged))
+
+	// The same edit on both sides is taken once.
+	merged, conflicts = merge(base, local, local)
+	assert.Empty(t, conflicts)
+	assert.Equal(t, string(local), string(merged))
+
+	// Different edits of the same region conflict.
+	local = splice(base, 4000, 20, "the local version")
+	remote = splice(base, 4005, 10, "the remote version")
+	_, conflicts = merge(base, local, remote)
+	require.Len(t, conflicts, 1)
+	c := conflicts[0]
+	assert.Equal(t, string(base[c.BaseOffset:c.BaseOffset+len(c.Base)]), string(c.Base))
+	assert.Contains(t, string(c.Local), "the local version")
+	assert.Contains(t, string(c.Remote), "the remote version")
+	assert.Equal(t, string(local), string(splice(base, c.BaseOffset, len(c.Base), string(c.Local))))
+	assert.Equal(t, string(remote), string(splice(base, c.BaseOffset, len(c.Base), string(c.Remote))))
+
+	// Without a base both strings are entirely added and conflict unless they are equal.
+	_, conflicts = merge(nil, local, remote)
+	assert.Len(t, conflicts, 1)
+}
@@ -0,0 +1,601 @@
+package rcds
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sort"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm"
+)
+
+// PartitionLevel holds the content-dependent chunking parameters of one level of the partition tree, which are the
+// inter-partition distance h, the rolling window size r, and the hash space hs.
+type PartitionLevel struct {
+	ChunkDistance int
+	RollingWindow int
+	HashSpace     int
+}
+
+func (p PartitionLevel) validate() error {
+	if p.ChunkDistance < 0 {
+		return fmt.Errorf("inter-partition distance has to be non-negative")
+	}
+	if p.RollingWindow < 1 {
+		return fmt.Errorf("rolling window size should be one or bigger")
+	}
+	if p.HashSpace <= 0 {
+		return fmt.Errorf("hash space should be a positive value")
+	}
+	return nil
+}
+
+// partitionNode is a substring of the local string in the partition tree, which is the node at the index of a level
+// or the root, whose level is rootLevel. The children of a node partition its substring with the parameters of the
+// next level and a node without children is a leaf.
+type partitionNode struct {
+	level int
+	index int
+}
+
+const rootLevel = -1
+
+// treeLevel holds the nodes of a partition level in string order.
+type treeLevel struct {
+	hashes  []uint64
+	offsets []int
+	lengths []int
+	// firstChild holds the index of the first child of each node in the next level, so the children of a node end at
+	// the first child of the node after it, or at the end of the next level. It is empty at the lowest level.
+	firstChild []int
+}
+
+func (l *treeLevel) len() int {
+	return len(l.hashes)
+}
+
+// append adds a node to the end of the level, whose children start at the end of the next level.
+func (l *treeLevel) append(hash uint64, offset, length int, next *treeLevel) {
+	l.hashes = append(l.hashes, hash)
+	l.offsets = append(l.offsets, offset)
+	l.lengths = append(l.lengths, length)
+	if next != nil {
+		l.firstChild = append(l.firstChild, next.len())
+	}
+}
+
+// occurrence is the index of the first occurrence of a chunk in its level and the number of its occurrences.
+type occurrence struct {
+	index int32
+	count int32
+}
+
+// partitionTree recursively partitions a string. The root is the entire string and its children are the chunks of
+// level 0. Each level keeps the shingles of the chunk sequences of its nodes and the first occurrence of its nodes by
+// hash. Occurrences of a chunk partition identically, so only the first occurrence of a chunk adds the shingles of its
+// children. The tree only keeps the hashes, offsets and lengths of its nodes in a slice per level and reads their
+// content from the source of the string.
+type partitionTree struct {
+	src         io.ReaderAt
+	size        int
+	levels      []PartitionLevel
+	hasher      algorithm.Hasher
+	root        uint64
+	nodes       []treeLevel
+	shingles    []hashShingleSet
+	occurrences []map[uint64]occurrence
+}
+
+// newPartitionTree partitions a string in memory, where large strings are hashed by parallel workers.
+func newPartitionTree(raw []byte, levels []PartitionLevel, hasher algorithm.Hasher) (*partitionTree, error) {
+	t := initPartitionTree(bytes.NewReader(raw), len(raw), levels, hasher)
+	if len(raw) == 0 {
+		return t, nil
+	}
+	s := string(raw)
+	chunks, err := contentDependentChunking(&s, levels[0].ChunkDistance, levels[0].RollingWindow, levels[0].HashSpace, hasher)
+	if err != nil {
+		return nil, err
+	}
+	if err = t.appendTop(chunkIterator(chunks), len(raw), nil); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// newStreamingPartitionTree partitions a string of the size read from the source. The top level is chunked while
+// streaming the source, so only a top level chunk at a time is held in memory.
+func newStreamingPartitionTree(src io.ReaderAt, size int, levels []PartitionLevel, hasher algorithm.Hasher) (*partitionTree, error) {
+	t := initPartitionTree(src, size, levels, hasher)
+	if size == 0 {
+		return t, nil
+	}
+	c := newChunker(io.NewSectionReader(src, 0, int64(size)), levels[0], hasher)
+	if err := t.appendTop(c.next, size, nil); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func initPartitionTree(src io.ReaderAt, size int, levels []PartitionLevel, hasher algorithm.Hasher) *partitionTree {
+	t := &partitionTree{
+		src:         src,
+		size:        size,
+		levels:      levels,
+		hasher:      hasher,
+		nodes:       make([]treeLevel, len(levels)),
+		shingles:    make([]hashShingleSet, len(levels)),
+		occurrences: make([]map[uint64]occurrence, len(levels)),
+	}
+	for l := range levels {
+		t.shingles[l] = make(hashShingleSet)
+		t.occurrences[l] = make(map[uint64]occurrence)
+	}
+	t.updateRoot()
+	return t
+}
+
+// clone returns a copy of the tree that can be patched without changing the tree.
+func (t *partitionTree) clone() *partitionTree {
+	c := *t
+	c.nodes = make([]treeLevel, len(t.nodes))
+	c.shingles = make([]hashShingleSet, len(t.shingles))
+	c.occurrences = make([]map[uint64]occurrence, len(t.occurrences))
+	for l := range t.nodes {
+		c.nodes[l] = treeLevel{
+			hashes:     slices.Clone(t.nodes[l].hashes),
+			offsets:    slices.Clone(t.nodes[l].offsets),
+			lengths:    slices.Clone(t.nodes[l].lengths),
+			firstChild: slices.Clone(t.nodes[l].firstChild),
+		}
+		c.shingles[l] = t.shingles[l].clone()
+		c.occurrences[l] = maps.Clone(t.occurrences[l])
+	}
+	return &c
+}
+
+// rootHash returns the hash of the chunk hashes of the top level, which identifies the string without hashing all of
+// it at once.
+func (t *partitionTree) rootHash() uint64 {
+	return t.root
+}
+
+// updateRoot computes the root hash again after the top level changes.
+func (t *partitionTree) updateRoot() {
+	t.root = t.hasher.Sum64(hashesToBytes(t.nodes[0].hashes))
+}
+
+// chunkIterator iterates over the chunks in the same way as chunker.next.
+func chunkIterator(chunks []string) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		if len(chunks) == 0 {
+			return nil, io.EOF
+		}
+		c := chunks[0]
+		chunks = chunks[1:]
+		return []byte(c), nil
+	}
+}
+
+// appendTop appends the chunks given by the next function to the top level, which must end at the offset. Chunks that
+// already occur in the nodes moved aside by replace are looked up in them.
+func (t *partitionTree) appendTop(next func() ([]byte, error), end int, moved []treeLevel) error {
+	top := &t.nodes[0]
+	offset := 0
+	if n := top.len(); n > 0 {
+		offset = top.offsets[n-1] + top.lengths[n-1]
+	}
+	for {
+		c, err := next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		hash := t.hasher.Sum64(c)
+		if err = t.shingles[0].incrementShingle(t.topHash(top.len()-1), hash); err != nil {
+			return err
+		}
+		if err = t.addNode(0, hash, offset, c, moved); err != nil {
+			return err
+		}
+		offset += len(c)
+	}
+	if offset != end {
+		return fmt.Errorf("top level chunks end at %d instead of %d", offset, end)
+	}
+	t.updateRoot()
+	return nil
+}
+
+// topHash returns the hash of the top level node at the index, or zero, which heads the first shingle, before the
+// first node.
+func (t *partitionTree) topHash(i int) uint64 {
+	if i < 0 {
+		return 0
+	}
+	return t.nodes[0].hashes[i]
+}
+
+// nextLevel returns the level after the level of the nodes, or nil below the lowest level.
+func nextLevel(nodes []treeLevel, level int) *treeLevel {
+	if level+1 >= len(nodes) {
+		return nil
+	}
+	return &nodes[level+1]
+}
+
+// addNode appends an occurrence of a chunk with the content to the level. The first occurrence of a chunk is
+// partitioned for the lower levels and the other occurrences copy its subtree.
+func (t *partitionTree) addNode(level int, hash uint64, offset int, content []byte, moved []treeLevel) error {
+	l := &t.nodes[level]
+	i := l.len()
+	l.append(hash, offset, len(content), nextLevel(t.nodes, level))
+
+	if o, isExist := t.occurrences[level][hash]; isExist {
+		from, j := t.nodes, int(o.index)
+		if o.index < 0 {
+			from, j = moved, movedIndex(o.index)
+		}
+		c, err := t.read(from[level].offsets[j], from[level].lengths[j])
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(c, content) {
+			return fmt.Errorf("hash collision for chunks '%s' and '%s'", c, content)
+		}
+		o.count++
+		if o.index < 0 {
+			o.index = int32(i)
+		}
+		t.occurrences[level][hash] = o
+		t.copyChildren(level, offset, from, j)
+		return nil
+	}
+	t.occurrences[level][hash] = occurrence{index: int32(i), count: 1}
+	if level+1 >= len(t.levels) {
+		return nil
+	}
+
+	p := t.levels[level+1]
+	s := string(content)
+	chunks, err := contentDependentChunking(&s, p.ChunkDistance, p.RollingWindow, p.HashSpace, t.hasher)
+	if err != nil {
+		return err
+	}
+	if len(chunks) < 2 {
+		return nil
+	}
+	childOffset := offset
+	hashes := make([]uint64, len(chunks))
+	for j, c := range chunks {
+		hashes[j] = t.hasher.Sum64([]byte(c))
+		if err = t.addNode(level+1, hashes[j], childOffset, []byte(c), moved); err != nil {
+			return err
+		}
+		childOffset += len(c)
+	}
+	return t.shingles[level+1].addHashSequence(hashes)
+}
+
+// copyChildren appends the subtree of the node at the index of the level in the nodes to the children of the last
+// node of the level, which is another occurrence of the chunk at the offset.
+func (t *partitionTree) copyChildren(level, offset int, from []treeLevel, i int) {
+	if level+1 >= len(t.levels) {
+		return
+	}
+	start, end := children(from, level, i)
+	shift := offset - from[level].offsets[i]
+	for j := start; j < end; j++ {
+		c := &from[level+1]
+		hash, childOffset, length := c.hashes[j], c.offsets[j]+shift, c.lengths[j]
+		t.nodes[level+1].append(hash, childOffset, length, nextLevel(t.nodes, level+1))
+		o := t.occurrences[level+1][hash]
+		o.count++
+		if o.index < 0 {
+			o.index = int32(t.nodes[level+1].len() - 1)
+		}
+		t.occurrences[level+1][hash] = o
+		t.copyChildren(level+1, childOffset, from, j)
+	}
+}
+
+// children returns the range of the indices of the children of the node at the index of the level in the next level.
+func children(nodes []treeLevel, level, i int) (int, int) {
+	if level+1 >= len(nodes) {
+		return 0, 0
+	}
+	l := &nodes[level]
+	end := nodes[level+1].len()
+	if i+1 < l.len() {
+		end = l.firstChild[i+1]
+	}
+	return l.firstChild[i], end
+}
+
+// movedOccurrence is the negative index of the occurrence whose first node is the moved node at the index, as -1 marks
+// an occurrence whose first node is removed.
+func movedOccurrence(i int) int32 {
+	return int32(-2 - i)
+}
+
+// movedIndex is the index of the moved node of a negative occurrence index.
+func movedIndex(o int32) int {
+	return int(-2 - o)
+}
+
+// replace updates the tree after the bytes of the string at the offset are replaced, which leaves the new string of
+// the size read from the source. Chunk boundaries only depend on the window hashes within the inter-partition
+// distance, so the top level is chunked again from the last boundary before the edit that the edit cannot move, until
+// a boundary after the edit lines up with an old one. The nodes in between are replaced and the nodes after are
+// moved, which only hashes the region around the edit, but still moves the nodes after it in memory.
+func (t *partitionTree) replace(offset, deleted int, src io.ReaderAt, size int) error {
+	inserted := size - (t.size - deleted)
+	if offset < 0 || deleted < 0 || inserted < 0 || offset+deleted > t.size {
+		return fmt.Errorf("edit of %d bytes at %d is out of the %d bytes string", deleted, offset, t.size)
+	}
+	top := &t.nodes[0]
+	p := t.levels[0]
+
+	// Keep the boundaries whose windows end before the edit.
+	k := sort.Search(top.len(), func(i int) bool {
+		return top.offsets[i] > offset-p.ChunkDistance-p.RollingWindow
+	}) - 1
+	if k < 0 {
+		k = 0
+	}
+	start := 0
+	if k < top.len() {
+		start = top.offsets[k]
+	}
+
+	// Chunk until a boundary, whose window is entirely after the edit, lines up with an old boundary.
+	editEnd, delta := offset+inserted, inserted-deleted
+	m := top.len()
+	var chunks []string
+	end := start
+	c := newChunker(io.NewSectionReader(src, int64(start), int64(size-start)), p, t.hasher)
+	for {
+		chunk, err := c.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		chunks = append(chunks, string(chunk))
+		end += len(chunk)
+		if end < editEnd+p.ChunkDistance || end >= size {
+			continue
+		}
+		old := end - delta
+		if j := sort.Search(top.len(), func(i int) bool { return top.offsets[i] >= old }); j < top.len() && j > k && top.offsets[j] == old {
+			m = j
+			break
+		}
+	}
+
+	// Remove the shingles that end at the replaced nodes or at the first node kept after them.
+	for i := k; i <= m && i < top.len(); i++ {
+		if err := t.shingles[0].decrementShingle(t.topHash(i-1), top.hashes[i]); err != nil {
+			return err
+		}
+	}
+	// The replaced nodes and the nodes kept after them start at an index of each level, starting with the top level.
+	from, to := make([]int, len(t.levels)), make([]int, len(t.levels))
+	from[0], to[0] = k, m
+	for level := 1; level < len(t.levels); level++ {
+		from[level], to[level] = childStart(t.nodes, level-1, from[level-1]), childStart(t.nodes, level-1, to[level-1])
+	}
+	if err := t.removeNodes(from, to); err != nil {
+		return err
+	}
+	moved := t.moveAside(from, to, delta)
+
+	t.src, t.size = src, size
+	if err := t.appendTop(chunkIterator(chunks), end, moved); err != nil {
+		return err
+	}
+	if moved[0].len() > 0 {
+		if err := t.shingles[0].incrementShingle(t.topHash(top.len()-1), moved[0].hashes[0]); err != nil {
+			return err
+		}
+	}
+	t.restore(moved)
+	t.updateRoot()
+	return nil
+}
+
+// childStart returns the index of the first child of the node at the index of the level in the next level, or the end
+// of the next level after the last node.
+func childStart(nodes []treeLevel, level, i int) int {
+	if i < nodes[level].len() {
+		return nodes[level].firstChild[i]
+	}
+	return nodes[level+1].len()
+}
+
+// removeNodes removes the nodes from the start to the end index of each level. The shingles of the children of a chunk
+// are removed with its last occurrence, and the first occurrence of a chunk that is removed is marked to be found
+// again.
+func (t *partitionTree) removeNodes(from, to []int) error {
+	for level := range t.levels {
+		l := &t.nodes[level]
+		for i := from[level]; i < to[level]; i++ {
+			o := t.occurrences[level][l.hashes[i]]
+			o.count--
+			if o.count > 0 {
+				if int(o.index) == i {
+					o.index = -1
+				}
+				t.occurrences[level][l.hashes[i]] = o
+				continue
+			}
+			delete(t.occurrences[level], l.hashes[i])
+			if start, end := children(t.nodes, level, i); end > start {
+				if err := t.shingles[level+1].removeHashSequence(t.nodes[level+1].hashes[start:end]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// moveAside truncates each level at the start of the removed nodes and returns the nodes kept after them, shifted by
+// delta bytes, with the indices of their children relative to the moved nodes. The moved first occurrences of chunks
+// are marked by a negative index, which is also where the first occurrence of a removed chunk now is.
+func (t *partitionTree) moveAside(from, to []int, delta int) []treeLevel {
+	moved := make([]treeLevel, len(t.levels))
+	for level := range t.levels {
+		l, m := &t.nodes[level], &moved[level]
+		m.hashes = append([]uint64(nil), l.hashes[to[level]:]...)
+		m.offsets = append([]int(nil), l.offsets[to[level]:]...)
+		m.lengths = append([]int(nil), l.lengths[to[level]:]...)
+		for i := range m.offsets {
+			m.offsets[i] += delta
+		}
+		for i, h := range m.hashes {
+			if o := t.occurrences[level][h]; int(o.index) == to[level]+i || o.index == -1 {
+				o.index = movedOccurrence(i)
+				t.occurrences[level][h] = o
+			}
+		}
+		l.hashes, l.offsets, l.lengths = l.hashes[:from[level]], l.offsets[:from[level]], l.lengths[:from[level]]
+		if level+1 < len(t.levels) {
+			m.firstChild = append([]int(nil), l.firstChild[to[level]:]...)
+			for i := range m.firstChild {
+				m.firstChild[i] -= to[level+1]
+			}
+			l.firstChild = l.firstChild[:from[level]]
+		}
+	}
+	return moved
+}
+
+// restore appends the nodes moved aside back to each level.
+func (t *partitionTree) restore(moved []treeLevel) {
+	for level := range t.levels {
+		l, m := &t.nodes[level], &moved[level]
+		base := l.len()
+		for i, h := range m.hashes {
+			if o := t.occurrences[level][h]; o.index == movedOccurrence(i) {
+				o.index = int32(base + i)
+				t.occurrences[level][h] = o
+			}
+		}
+		// The next level is restored after this one, so its moved nodes start at its current end.
+		if level+1 < len(t.levels) {
+			childBase := t.nodes[level+1].len()
+			for _, c := range m.firstChild {
+				l.firstChild = append(l.firstChild, c+childBase)
+			}
+		}
+		l.hashes = append(l.hashes, m.hashes...)
+		l.offsets = append(l.offsets, m.offsets...)
+		l.lengths = append(l.lengths, m.lengths...)
+	}
+}
+
+// read reads the bytes of the string at the offset.
+func (t *partitionTree) read(offset, length int) ([]byte, error) {
+	b := make([]byte, length)
+	if _, err := t.src.ReadAt(b, int64(offset)); err != nil && !(err == io.EOF && offset+length == t.size) {
+		return nil, fmt.Errorf("error reading %d bytes at %d of the local string, %v", length, offset, err)
+	}
+	return b, nil
+}
+
+// content reads the substring of a node.
+func (t *partitionTree) content(node partitionNode) ([]byte, error) {
+	return t.read(t.offset(node), t.length(node))
+}
+
+func (t *partitionTree) hash(node partitionNode) uint64 {
+	if node.level == rootLevel {
+		return t.root
+	}
+	return t.nodes[node.level].hashes[node.index]
+}
+
+func (t *partitionTree) offset(node partitionNode) int {
+	if node.level == rootLevel {
+		return 0
+	}
+	return t.nodes[node.level].offsets[node.index]
+}
+
+func (t *partitionTree) length(node partitionNode) int {
+	if node.level == rootLevel {
+		return t.size
+	}
+	return t.nodes[node.level].lengths[node.index]
+}
+
+// children returns the children of a node.
+func (t *partitionTree) children(node partitionNode) []partitionNode {
+	start, end := 0, t.nodes[0].len()
+	if node.level != rootLevel {
+		start, end = children(t.nodes, node.level, node.index)
+	}
+	res := make([]partitionNode, 0, end-start)
+	for i := start; i < end; i++ {
+		res = append(res, partitionNode{level: node.level + 1, index: i})
+	}
+	return res
+}
+
+// childHashes returns the hashes of the children of a node, which share the memory of the tree until it changes.
+func (t *partitionTree) childHashes(node partitionNode) []uint64 {
+	if node.level == rootLevel {
+		return t.nodes[0].hashes
+	}
+	start, end := children(t.nodes, node.level, node.index)
+	if start == end {
+		return nil
+	}
+	return t.nodes[node.level+1].hashes[start:end:end]
+}
+
+// node returns the first occurrence of the node with the hash at the level.
+func (t *partitionTree) node(level int, hash uint64) (partitionNode, bool) {
+	o, isExist := t.occurrences[level][hash]
+	if !isExist {
+		return partitionNode{}, false
+	}
+	return partitionNode{level: level, index: int(o.index)}, true
+}
+
+// lookup returns the node of any level in the tree, or the root, with the hash.
+func (t *partitionTree) lookup(hash uint64) (partitionNode, bool) {
+	for level := range t.levels {
+		if node, isExist := t.node(level, hash); isExist {
+			return node, true
+		}
+	}
+	if hash == t.root {
+		return partitionNode{level: rootLevel}, true
+	}
+	return partitionNode{}, false
+}
+
+// leaves returns the leaf nodes of the tree in order.
+func (t *partitionTree) leaves() []partitionNode {
+	var res []partitionNode
+	var visit func(level, start, end int)
+	visit = func(level, start, end int) {
+		for i := start; i < end; i++ {
+			from, to := children(t.nodes, level, i)
+			if from == to {
+				res = append(res, partitionNode{level: level, index: i})
+				continue
+			}
+			visit(level+1, from, to)
+		}
+	}
+	if t.size > 0 {
+		visit(0, 0, t.nodes[0].len())
+	}
+	return res
+}
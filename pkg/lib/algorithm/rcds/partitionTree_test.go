@@ -0,0 +1,166 @@
+package rcds
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/rand"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm"
+)
+
+func TestPartitionTree(t *testing.T) {
+	levels := []PartitionLevel{
+		{ChunkDistance: 64, RollingWindow: 8, HashSpace: 256},
+		{ChunkDistance: 8, RollingWindow: 4, HashSpace: 256},
+	}
+	block := rand.String(4096)
+	raw := []byte(block + rand.String(1024) + block)
+	tree, err := newPartitionTree(raw, levels, algorithm.DefaultHasher)
+	require.NoError(t, err)
+
+	content := func(node partitionNode) []byte {
+		c, err := tree.content(node)
+		require.NoError(t, err)
+		return c
+	}
+
+	// Every node is partitioned exactly by its children.
+	var check func(node partitionNode, depth int)
+	check = func(node partitionNode, depth int) {
+		children := tree.children(node)
+		if len(children) == 0 {
+			return
+		}
+		assert.Less(t, depth, len(levels))
+		var buf bytes.Buffer
+		for _, c := range children {
+			buf.Write(content(c))
+			check(c, depth+1)
+		}
+		assert.Equal(t, content(node), buf.Bytes())
+	}
+	check(partitionNode{level: rootLevel}, 0)
+	var leaves [][]byte
+	for _, leaf := range tree.leaves() {
+		leaves = append(leaves, content(leaf))
+	}
+	assert.Equal(t, raw, bytes.Join(leaves, nil))
+
+	// The occurrences of every node point to its first occurrence, which has the same content.
+	for level := range levels {
+		counts := make(map[uint64]int32)
+		for i, h := range tree.nodes[level].hashes {
+			found, isExist := tree.lookup(h)
+			assert.True(t, isExist)
+			assert.Equal(t, content(partitionNode{level: level, index: i}), content(found))
+			if counts[h] == 0 {
+				assert.Equal(t, occurrence{index: int32(i)}, occurrence{index: tree.occurrences[level][h].index})
+			}
+			counts[h]++
+		}
+		assert.Len(t, tree.occurrences[level], len(counts))
+		for h, count := range counts {
+			assert.Equal(t, count, tree.occurrences[level][h].count)
+		}
+	}
+	_, isExist := tree.lookup(1)
+	assert.False(t, isExist)
+}
+
+func TestPartitionTree_Empty(t *testing.T) {
+	tree, err := newPartitionTree(nil, []PartitionLevel{{ChunkDistance: 4, RollingWindow: 2, HashSpace: 16}}, algorithm.DefaultHasher)
+	require.NoError(t, err)
+	assert.Empty(t, tree.children(partitionNode{level: rootLevel}))
+	assert.Empty(t, tree.leaves())
+	assert.Empty(t, tree.shingles[0])
+
+	streamed, err := newStreamingPartitionTree(bytes.NewReader(nil), 0, tree.levels, algorithm.DefaultHasher)
+	require.NoError(t, err)
+	assert.Equal(t, tree.rootHash(), streamed.rootHash())
+}
+
+func TestStreamingPartitionTree(t *testing.T) {
+	levels := []PartitionLevel{
+		{ChunkDistance: 64, RollingWindow: 8, HashSpace: 256},
+		{ChunkDistance: 8, RollingWindow: 4, HashSpace: 256},
+	}
+	block := rand.String(4096)
+	raw := []byte(block + rand.String(1024) + block)
+	tree, err := newPartitionTree(raw, levels, algorithm.DefaultHasher)
+	require.NoError(t, err)
+	streamed, err := newStreamingPartitionTree(bytes.NewReader(raw), len(raw), levels, algorithm.DefaultHasher)
+	require.NoError(t, err)
+
+	assert.Equal(t, tree.rootHash(), streamed.rootHash())
+	assert.Equal(t, tree.shingles, streamed.shingles)
+	assert.Equal(t, len(tree.leaves()), len(streamed.leaves()))
+
+	// The root hash changes with the string.
+	raw[len(raw)/2]++
+	edited, err := newPartitionTree(raw, levels, algorithm.DefaultHasher)
+	require.NoError(t, err)
+	assert.NotEqual(t, tree.rootHash(), edited.rootHash())
+}
+
+func TestPartitionTree_Replace(t *testing.T) {
+	levels := []PartitionLevel{
+		{ChunkDistance: 32, RollingWindow: 8, HashSpace: 256},
+		{ChunkDistance: 4, RollingWindow: 4, HashSpace: 256},
+	}
+	block := rand.String(1024)
+	raw := []byte(block + rand.String(4096) + block)
+	tree, err := newPartitionTree(raw, levels, algorithm.DefaultHasher)
+	require.NoError(t, err)
+
+	equalTrees := func(expected, actual *partitionTree) {
+		require.Equal(t, expected.rootHash(), actual.rootHash())
+		require.Equal(t, expected.shingles, actual.shingles)
+		require.Equal(t, expected.occurrences, actual.occurrences)
+		for level := range levels {
+			e, a := expected.nodes[level], actual.nodes[level]
+			require.True(t, slices.Equal(e.hashes, a.hashes))
+			require.True(t, slices.Equal(e.offsets, a.offsets))
+			require.True(t, slices.Equal(e.lengths, a.lengths))
+			require.True(t, slices.Equal(e.firstChild, a.firstChild))
+		}
+		var leaves [][]byte
+		for _, leaf := range actual.leaves() {
+			c, err := actual.content(leaf)
+			require.NoError(t, err)
+			leaves = append(leaves, c)
+		}
+		require.Equal(t, string(raw), string(bytes.Join(leaves, nil)))
+	}
+
+	for i := 0; i < 100; i++ {
+		offset := rand.Intn(len(raw) + 1)
+		deleted := 0
+		if i%3 != 0 && offset < len(raw) {
+			deleted = rand.Intn(min(len(raw)-offset, 300) + 1)
+		}
+		inserted := []byte(rand.String(rand.Intn(300)))
+		if i%5 == 0 {
+			// Repeat a part of the string, so edits add and remove occurrences of existing chunks.
+			inserted = append([]byte(nil), raw[:min(len(raw), 500)]...)
+		}
+		edited := append(append(append([]byte(nil), raw[:offset]...), inserted...), raw[offset+deleted:]...)
+		raw = edited
+		require.NoError(t, tree.replace(offset, deleted, bytes.NewReader(raw), len(raw)))
+
+		fresh, err := newPartitionTree(raw, levels, algorithm.DefaultHasher)
+		require.NoError(t, err)
+		equalTrees(fresh, tree)
+	}
+
+	// Deleting the entire string leaves an empty tree.
+	require.NoError(t, tree.replace(0, len(raw), bytes.NewReader(nil), 0))
+	raw = nil
+	empty, err := newPartitionTree(nil, levels, algorithm.DefaultHasher)
+	require.NoError(t, err)
+	equalTrees(empty, tree)
+	assert.Error(t, tree.replace(1, 0, bytes.NewReader([]byte("a")), 1))
+}
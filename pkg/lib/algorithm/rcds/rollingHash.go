@@ -0,0 +1,114 @@
+package rcds
+
+import (
+	"fmt"
+	"math/bits"
+	"runtime"
+	"sync"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm"
+)
+
+// parallelHashThreshold is the input length from which content hashes are computed by parallel workers.
+const parallelHashThreshold = 1 << 20
+
+// buzTable maps each byte to a pseudo-random value for the buzhash rolling hash. The values are hashes of the bytes,
+// so peers that negotiated the same hasher derive the same table.
+type buzTable [256]uint64
+
+// buzTables caches the table of each hasher by name.
+var buzTables sync.Map
+
+func buzTableOf(hasher algorithm.Hasher) *buzTable {
+	if t, isExist := buzTables.Load(hasher.Name()); isExist {
+		return t.(*buzTable)
+	}
+	t := new(buzTable)
+	for b := range t {
+		t[b] = hasher.Sum64([]byte{byte(b)})
+	}
+	actual, _ := buzTables.LoadOrStore(hasher.Name(), t)
+	return actual.(*buzTable)
+}
+
+// rollingHash is a buzhash over a fixed size window. Sliding the window by one byte rotates the hash, removes the
+// rotated value of the outgoing byte and adds the value of the incoming byte, which takes constant time regardless of
+// the window size.
+type rollingHash struct {
+	table  *buzTable
+	window int
+	hash   uint64
+}
+
+func newRollingHash(window int, hasher algorithm.Hasher) *rollingHash {
+	return &rollingHash{table: buzTableOf(hasher), window: window}
+}
+
+// reset sets the hash to the hash of the window.
+func (r *rollingHash) reset(window string) {
+	r.hash = 0
+	for i := 0; i < len(window); i++ {
+		r.hash = bits.RotateLeft64(r.hash, 1) ^ r.table[window[i]]
+	}
+}
+
+// roll slides the window by one byte.
+func (r *rollingHash) roll(out, in byte) {
+	r.hash = bits.RotateLeft64(r.hash, 1) ^ bits.RotateLeft64(r.table[out], r.window) ^ r.table[in]
+}
+
+// stringToHashContent converts string into an array of content hash values of each rolling window with a buzhash
+// derived from the hasher and returns error if fails in anyway.
+func stringToHashContent(s *string, rollingWinSize, hashSpace int, hasher algorithm.Hasher) (*[]uint64, error) {
+	return stringToHashContentParallel(s, rollingWinSize, hashSpace, hasher, 1)
+}
+
+// stringToHashContentParallel is stringToHashContent split over workers. Each worker rolls over its own segment of
+// the windows, and segments overlap by one window less a byte so that the result is identical to a single worker.
+func stringToHashContentParallel(s *string, rollingWinSize, hashSpace int, hasher algorithm.Hasher, workers int) (*[]uint64, error) {
+	if rollingWinSize < 1 {
+		return nil, fmt.Errorf("rolling window size should be one or bigger")
+	}
+	if hashSpace <= 0 {
+		return nil, fmt.Errorf("hash space should be a positive value")
+	}
+	if workers < 1 {
+		return nil, fmt.Errorf("number of workers should be one or bigger")
+	}
+
+	contentHashSize := len(*s) - rollingWinSize + 1
+	if contentHashSize < 1 {
+		return nil, fmt.Errorf("rolling windows size is bigger than string input")
+	}
+	contentHash := make([]uint64, contentHashSize)
+
+	segment := (contentHashSize + workers - 1) / workers
+	var wg sync.WaitGroup
+	for start := 0; start < contentHashSize; start += segment {
+		end := start + segment
+		if end > contentHashSize {
+			end = contentHashSize
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			rh := newRollingHash(rollingWinSize, hasher)
+			rh.reset((*s)[start : start+rollingWinSize])
+			contentHash[start] = rh.hash % uint64(hashSpace)
+			for i := start + 1; i < end; i++ {
+				rh.roll((*s)[i-1], (*s)[i+rollingWinSize-1])
+				contentHash[i] = rh.hash % uint64(hashSpace)
+			}
+		}(start, end)
+	}
+	wg.Wait()
+	return &contentHash, nil
+}
+
+// hashWorkers returns the number of workers hashing an input of the length.
+func hashWorkers(length int) int {
+	if length < parallelHashThreshold {
+		return 1
+	}
+	return runtime.GOMAXPROCS(0)
+}
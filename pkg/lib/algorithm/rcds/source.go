@@ -0,0 +1,159 @@
+package rcds
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// pieceString is a string made of pieces of other strings. An edited string read from a source is kept as one, so the
+// bytes the edits keep are still read from the source and only the inserted bytes are held in memory.
+type pieceString struct {
+	pieces []piece
+	size   int
+}
+
+// piece is the bytes of a source from an offset, which start at the offset of the piece in the string.
+type piece struct {
+	src    io.ReaderAt
+	from   int
+	offset int
+	length int
+}
+
+func newPieceString(src io.ReaderAt, size int) *pieceString {
+	p := &pieceString{size: size}
+	if size > 0 {
+		p.pieces = []piece{{src: src, length: size}}
+	}
+	return p
+}
+
+// ReadAt reads the bytes at the offset from the pieces they are in.
+func (p *pieceString) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	if off >= int64(p.size) {
+		return 0, io.EOF
+	}
+	i := sort.Search(len(p.pieces), func(i int) bool { return p.pieces[i].offset+p.pieces[i].length > int(off) })
+	n := 0
+	for ; n < len(b) && i < len(p.pieces); i++ {
+		pc := p.pieces[i]
+		start := int(off) + n - pc.offset
+		m := min(len(b)-n, pc.length-start)
+		k, err := pc.src.ReadAt(b[n:n+m], int64(pc.from+start))
+		n += k
+		if k < m {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+	}
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// replace returns the string with the bytes at the offset replaced by the data, which is copied. The string itself is
+// left unchanged.
+func (p *pieceString) replace(offset, length int, data []byte) *pieceString {
+	res := &pieceString{size: p.size - length + len(data)}
+	res.pieces = p.appendRange(res.pieces, 0, offset)
+	if len(data) > 0 {
+		res.pieces = append(res.pieces, piece{src: bytes.NewReader(bytes.Clone(data)), length: len(data)})
+	}
+	res.pieces = p.appendRange(res.pieces, offset+length, p.size)
+	offset = 0
+	for i := range res.pieces {
+		res.pieces[i].offset = offset
+		offset += res.pieces[i].length
+	}
+	return res
+}
+
+// appendRange appends the parts of the pieces from the start to the end offset of the string.
+func (p *pieceString) appendRange(pieces []piece, start, end int) []piece {
+	for _, pc := range p.pieces {
+		from, to := max(start, pc.offset), min(end, pc.offset+pc.length)
+		if from >= to {
+			continue
+		}
+		pieces = append(pieces, piece{src: pc.src, from: pc.from + from - pc.offset, length: to - from})
+	}
+	return pieces
+}
+
+// index returns the offset of the first occurrence of the bytes in the string of the size read from the source, or -1
+// if there is none. The string is searched in blocks, which overlap by the length of the bytes less one.
+func index(src io.ReaderAt, size int, b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	block := max(readBlockSize, len(b))
+	buf := make([]byte, block+len(b)-1)
+	for offset := 0; offset+len(b) <= size; offset += block {
+		n := min(len(buf), size-offset)
+		if _, err := src.ReadAt(buf[:n], int64(offset)); err != nil && !(err == io.EOF && offset+n == size) {
+			return 0, fmt.Errorf("error reading %d bytes at %d of the local string, %v", n, offset, err)
+		}
+		if i := bytes.Index(buf[:n], b); i >= 0 {
+			return offset + i, nil
+		}
+	}
+	return -1, nil
+}
+
+// tempFile is a temporary file holding a received string, which is removed once the file is closed.
+type tempFile struct {
+	*os.File
+}
+
+func newTempFile() (tempFile, error) {
+	f, err := os.CreateTemp("", "rcds-*")
+	if err != nil {
+		return tempFile{}, fmt.Errorf("error creating a temporary file for the received string, %v", err)
+	}
+	return tempFile{f}, nil
+}
+
+func (f tempFile) Close() error {
+	err := f.File.Close()
+	if rmErr := os.Remove(f.Name()); err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// sharedCloser closes a source shared by several syncs once each of them has closed it.
+type sharedCloser struct {
+	closer io.Closer
+	mu     sync.Mutex
+	refs   int
+}
+
+// share counts one more sync closing the source.
+func (c *sharedCloser) share() *sharedCloser {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refs++
+	return c
+}
+
+func (c *sharedCloser) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.refs == 0 {
+		return nil
+	}
+	if c.refs--; c.refs > 0 {
+		return nil
+	}
+	return c.closer.Close()
+}
@@ -0,0 +1,61 @@
+package rcds
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/rand"
+)
+
+func TestPieceString(t *testing.T) {
+	raw := []byte(rand.String(4096))
+	p := newPieceString(bytesReaderAt(raw), len(raw))
+	for i := 0; i < 200; i++ {
+		offset := rand.Intn(len(raw) + 1)
+		length := rand.Intn(min(len(raw)-offset, 100) + 1)
+		data := []byte(rand.String(rand.Intn(100)))
+		edited := p.replace(offset, length, data)
+		// The string that is edited is left unchanged.
+		assert.Equal(t, len(raw), p.size)
+
+		raw = append(append(append([]byte(nil), raw[:offset]...), data...), raw[offset+length:]...)
+		p = edited
+		require.Equal(t, len(raw), p.size)
+
+		from := rand.Intn(len(raw) + 1)
+		b := make([]byte, rand.Intn(len(raw)-from+1))
+		n, err := p.ReadAt(b, int64(from))
+		if from == len(raw) {
+			require.Equal(t, io.EOF, err)
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, string(raw[from:from+n]), string(b))
+	}
+
+	all := make([]byte, len(raw)+1)
+	n, err := p.ReadAt(all, 0)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, string(raw), string(all[:n]))
+	_, err = p.ReadAt(all, int64(len(raw)))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestIndex(t *testing.T) {
+	raw := []byte(rand.String(3 * readBlockSize))
+	for _, offset := range []int{0, 100, readBlockSize - 5, readBlockSize, 2*readBlockSize - 1, len(raw) - 10} {
+		b := raw[offset : offset+10]
+		i, err := index(bytes.NewReader(raw), len(raw), b)
+		require.NoError(t, err)
+		assert.Equal(t, bytes.Index(raw, b), i)
+	}
+	i, err := index(bytes.NewReader(raw), len(raw), []byte("not in the lowercase string"))
+	require.NoError(t, err)
+	assert.Equal(t, -1, i)
+	i, err = index(bytes.NewReader(raw[:5]), 5, raw[:10])
+	require.NoError(t, err)
+	assert.Equal(t, -1, i)
+}
@@ -1,48 +1,115 @@
 package rcds
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"sort"
+	"io"
+	"math"
+	"os"
+	"slices"
 
-	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm/full_sync"
+	"github.com/sirupsen/logrus"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm"
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm/iblt"
 	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/genSync"
 	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/set"
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/util"
 )
 
 const (
-	defaultH         = 4
+	defaultH         = 1024
 	defaultRollingR  = 16
 	defaultHashSpace = 1024
+	// defaultShingleSyncRetries is the number of times the default shingle set backend grows its table after failing to
+	// decode it.
+	defaultShingleSyncRetries = 3
+)
+
+// ErrEditOutOfRange is returned by edits of bytes outside the local string.
+var ErrEditOutOfRange = errors.New("edit is out of the range of the local string")
+
+// Editor edits the local string of an RCDS sync at byte offsets and patches its partition tree around each edit. The
+// syncs created by this package implement it.
+type Editor interface {
+	InsertAt(offset int, data []byte) error
+	DeleteRange(offset, length int) error
+	Replace(offset, length int, data []byte) error
+}
+
+// Document reads the local string of an RCDS sync in its original order, which after a client sync is the string of
+// the server byte for byte. The syncs created by this package implement it.
+type Document interface {
+	GetString() string
+	io.WriterTo
+}
+
+const (
+	// levelShrinkFactor divides the inter-partition distance of each derived level.
+	levelShrinkFactor = 4
+	// minDerivedChunkDistance is the smallest inter-partition distance of the levels derived when WithLevelNum is not
+	// given, which bounds the size of the leaf chunks a small edit sends.
+	minDerivedChunkDistance = 64
 )
 
-// rcdsSync is a model-friendly sync adapter that prepares RCDS metadata while relying on a full sync
-// transport/backend for wire exchange.
+// rcdsSync reconciles the local string with a remote string. The string is recursively partitioned into a tree of
+// content-dependent chunks whose hash shingles, tagged by partition level, are reconciled with a set reconciliation
+// backend. The client then descends the partition tree of the server level by level, only requesting the nodes it
+// does not have, and the server answers each of them with either the literal chunk or the cycle information of its
+// children, which the client recovers by backtracking the shingles of the next level.
 //
-// NOTE: This keeps compatibility with existing GenSync workflows and provides a foundation for replacing
-// backend sync with pure RCDS reconciliation in follow-up changes.
+// The local set holds the leaf chunks of the local string and the set additions hold the leaf chunks received from
+// the remote.
+//
+// The local string is either held in memory or read from a source such as a file, in which case only the partition
+// tree is kept in memory and chunks are read from the source when needed. Edits of such a string only hold the inserted
+// bytes in memory, and a sync that replaces it spools the received string to a temporary file.
 type rcdsSync struct {
-	*set.Set
 	additionals *set.Set
 
 	FreezeLocal   bool
 	SentBytes     int
 	ReceivedBytes int
 
-	h         int
-	r         int
-	hs        int
-	localRaw  []byte
-	chunkList []string
-	dictSize  int
+	levels   []PartitionLevel
+	hasher   algorithm.Hasher
+	localRaw []byte
+	tree     *partitionTree
+	// shared reports whether the local string and its partition tree are shared with a snapshot or the session a
+	// snapshot was taken for, in which case they are copied before the next edit.
+	shared bool
+	// rebuilds counts the edits that rebuilt the partition tree after failing to patch it.
+	rebuilds int
+
+	mode      SyncMode
+	mergeBase []byte
+	conflicts []Conflict
+	// replaced reports whether the last sync replaced the local string.
+	replaced bool
+	stats    genSync.Stats
 
-	backend genSync.GenSync
+	source       io.ReaderAt
+	sourceSize   int
+	sourceCloser io.Closer
+
+	newBackend  func() (genSync.GenSync, error)
+	connOptions []genSync.ConnectionOption
 }
 
 type rcdsOptions struct {
-	h  int
-	r  int
-	hs int
+	h           int
+	r           int
+	hs          int
+	levelNum    int
+	levels      []PartitionLevel
+	hasher      algorithm.Hasher
+	mode        SyncMode
+	mergeBase   []byte
+	newBackend  func() (genSync.GenSync, error)
+	connOptions []genSync.ConnectionOption
 }
 
 type RCDSOption func(option *rcdsOptions)
@@ -54,124 +121,899 @@ func (r *rcdsOptions) apply(options []RCDSOption) {
 }
 
 func (r *rcdsOptions) complete() error {
-	if r.h < 0 {
-		return fmt.Errorf("inter-partition distance has to be non-negative")
+	if r.levelNum < 0 {
+		return fmt.Errorf("number of partition levels has to be positive")
+	}
+	if len(r.levels) == 0 {
+		// The levels cannot depend on the string since both peers must use the same levels, so the number of levels
+		// is derived from the inter-partition distance of the first level instead.
+		if r.levelNum == 0 {
+			r.levelNum = 1
+			for h := r.h / levelShrinkFactor; h >= minDerivedChunkDistance; h /= levelShrinkFactor {
+				r.levelNum++
+			}
+		}
+		h := r.h
+		for i := 0; i < r.levelNum; i++ {
+			r.levels = append(r.levels, PartitionLevel{ChunkDistance: h, RollingWindow: r.r, HashSpace: r.hs})
+			h /= levelShrinkFactor
+		}
+	} else if r.levelNum != 0 && r.levelNum != len(r.levels) {
+		return fmt.Errorf("number of partition levels is %d but parameters of %d levels are given", r.levelNum, len(r.levels))
+	}
+	for i, l := range r.levels {
+		if err := l.validate(); err != nil {
+			return fmt.Errorf("invalid parameters of partition level %d, %v", i, err)
+		}
 	}
-	if r.r < 1 {
-		return fmt.Errorf("rolling window size should be one or bigger")
+	if r.mode > MergeMode {
+		return fmt.Errorf("unknown sync mode %d", r.mode)
 	}
-	if r.hs <= 0 {
-		return fmt.Errorf("hash space should be a positive value")
+	if r.hasher == nil {
+		r.hasher = algorithm.DefaultHasher
+	}
+	if r.newBackend == nil {
+		hasher := r.hasher
+		r.newBackend = func() (genSync.GenSync, error) {
+			return iblt.NewIBLTSetSync(iblt.WithDataLen(shingleElemSize), iblt.WithHasher(hasher),
+				iblt.WithMaxSyncRetries(defaultShingleSyncRetries))
+		}
 	}
 	return nil
 }
 
+// WithChunkDistance sets the inter-partition distance of the first partition level.
 func WithChunkDistance(h int) RCDSOption {
 	return func(option *rcdsOptions) {
 		option.h = h
 	}
 }
 
+// WithRollingWindow sets the rolling window size of every derived partition level.
 func WithRollingWindow(r int) RCDSOption {
 	return func(option *rcdsOptions) {
 		option.r = r
 	}
 }
 
+// WithHashSpace sets the hash space of every derived partition level.
 func WithHashSpace(hs int) RCDSOption {
 	return func(option *rcdsOptions) {
 		option.hs = hs
 	}
 }
 
+// WithLevelNum sets the number of partition levels. Unless the levels are given by WithPartitionLevels, each level
+// divides the inter-partition distance of the level above by levelShrinkFactor. By default levels are added while the
+// inter-partition distance stays at least minDerivedChunkDistance, which is 3 levels for the default distance.
+func WithLevelNum(levelNum int) RCDSOption {
+	return func(option *rcdsOptions) {
+		option.levelNum = levelNum
+	}
+}
+
+// WithPartitionLevels sets the chunking parameters of each partition level from the top of the tree, which overrides
+// the chunk distance, rolling window and hash space options. Both peers must use the same levels.
+func WithPartitionLevels(levels ...PartitionLevel) RCDSOption {
+	return func(option *rcdsOptions) {
+		option.levels = levels
+	}
+}
+
+// WithShingleSetSync sets the constructor of the set reconciliation backend used to exchange hash shingles. Both peers
+// must use the same backend. By default the shingles are reconciled with IBLT, sized from a strata estimator exchanged at
+// each sync, so the shingles cost bandwidth proportional to their differences rather than to the string.
+func WithShingleSetSync(newBackend func() (genSync.GenSync, error)) RCDSOption {
+	return func(option *rcdsOptions) {
+		option.newBackend = newBackend
+	}
+}
+
+// WithHasher sets the hash function of the rolling windows, the chunks and the string digest. Both peers must use the
+// same hasher. The default shingle set backend uses it as well.
+func WithHasher(hasher algorithm.Hasher) RCDSOption {
+	return func(option *rcdsOptions) {
+		option.hasher = hasher
+	}
+}
+
+// WithSyncMode sets whether SyncClient pulls the server string, which is the default, pushes the local string to the
+// server or merges the two. The server follows the mode of the client.
+func WithSyncMode(mode SyncMode) RCDSOption {
+	return func(option *rcdsOptions) {
+		option.mode = mode
+	}
+}
+
+// WithMergeBase sets the common version of the strings that MergeMode merges against.
+func WithMergeBase(base []byte) RCDSOption {
+	return func(option *rcdsOptions) {
+		option.mergeBase = base
+	}
+}
+
+// WithConnectionOptions sets the options of the connections SyncClient and SyncServer open, such as genSync.WithTLS.
+// The shingle set backend shares these connections.
+func WithConnectionOptions(option ...genSync.ConnectionOption) RCDSOption {
+	return func(options *rcdsOptions) {
+		options.connOptions = option
+	}
+}
+
 func NewRCDSSetSync(option ...RCDSOption) (genSync.GenSync, error) {
-	opts := rcdsOptions{h: defaultH, r: defaultRollingR, hs: defaultHashSpace}
-	opts.apply(option)
-	if err := opts.complete(); err != nil {
+	r, err := newRCDSSync(option)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.rebuildMetadata(); err != nil {
 		return nil, err
 	}
+	return r, nil
+}
 
-	backend, err := full_sync.NewFullSetSync()
+// NewRCDSSetSyncFromReader creates a sync of the string of the size read from the source. The string is partitioned
+// while streaming the source and chunks are read from the source again when needed, so the source must not change
+// while it is used by the sync. Edits are kept on top of the source and a sync that replaces the string spools the
+// received string to a temporary file, which Close removes.
+func NewRCDSSetSyncFromReader(src io.ReaderAt, size int64, option ...RCDSOption) (genSync.GenSync, error) {
+	r, err := newRCDSSync(option)
 	if err != nil {
 		return nil, err
 	}
+	if err = r.setSource(src, size, nil); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// NewRCDSSetSyncFromFile creates a sync of the content of the file, which is read as NewRCDSSetSyncFromReader reads
+// its source. The returned sync implements io.Closer to close the file.
+func NewRCDSSetSyncFromFile(path string, option ...RCDSOption) (genSync.GenSync, error) {
+	r, err := newRCDSSync(option)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err = r.setSource(f, info.Size(), f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func newRCDSSync(option []RCDSOption) (*rcdsSync, error) {
+	opts := rcdsOptions{h: defaultH, r: defaultRollingR, hs: defaultHashSpace}
+	opts.apply(option)
+	if err := opts.complete(); err != nil {
+		return nil, err
+	}
 
 	return &rcdsSync{
-		Set:         set.New(),
 		additionals: set.New(),
 		FreezeLocal: false,
-		h:           opts.h,
-		r:           opts.r,
-		hs:          opts.hs,
-		backend:     backend,
+		levels:      opts.levels,
+		hasher:      opts.hasher,
+		mode:        opts.mode,
+		mergeBase:   opts.mergeBase,
+		newBackend:  opts.newBackend,
+		connOptions: opts.connOptions,
 	}, nil
 }
 
+// setSource partitions the string read from the source, which is closed by Close if the closer is given.
+func (r *rcdsSync) setSource(src io.ReaderAt, size int64, closer io.Closer) error {
+	if size < 0 || size > math.MaxInt {
+		return fmt.Errorf("source size %d is out of range", size)
+	}
+	r.source, r.sourceSize, r.sourceCloser = src, int(size), closer
+	return r.rebuildMetadata()
+}
+
+// Close closes the source of the local string given to NewRCDSSetSyncFromFile, or removes the temporary file of the
+// string received in its place.
+func (r *rcdsSync) Close() error {
+	closer := r.sourceCloser
+	r.source, r.sourceSize, r.sourceCloser = nil, 0, nil
+	if closer == nil {
+		return nil
+	}
+	return closer.Close()
+}
+
+// local returns the local string and its size.
+func (r *rcdsSync) local() (io.ReaderAt, int) {
+	if r.source != nil {
+		return r.source, r.sourceSize
+	}
+	return bytes.NewReader(r.localRaw), len(r.localRaw)
+}
+
+// SetFreezeLocal if set to true will not update the local string when syncing as a client.
 func (r *rcdsSync) SetFreezeLocal(freezeLocal bool) {
 	r.FreezeLocal = freezeLocal
-	r.backend.SetFreezeLocal(freezeLocal)
 }
 
+// AddElement appends the element to the local string.
 func (r *rcdsSync) AddElement(elem interface{}) error {
 	buf, ok := elem.([]byte)
 	if !ok {
 		return fmt.Errorf("rcds only accepts []byte elements")
 	}
-
-	r.Set.InsertKey(buf)
-	r.localRaw = append(r.localRaw, buf...)
-
-	if err := r.rebuildMetadata(); err != nil {
-		return err
-	}
-	return r.backend.AddElement(buf)
+	_, size := r.local()
+	return r.InsertAt(size, buf)
 }
 
+// DeleteElement removes the first occurrence of the element from the local string. DeleteRange removes bytes at a
+// known offset instead.
 func (r *rcdsSync) DeleteElement(elem interface{}) error {
 	buf, ok := elem.([]byte)
 	if !ok {
 		return fmt.Errorf("rcds only accepts []byte elements")
 	}
+	if len(buf) == 0 {
+		return nil
+	}
+	src, size := r.local()
+	i, err := index(src, size, buf)
+	if err != nil {
+		return err
+	}
+	if i < 0 {
+		return nil
+	}
+	return r.DeleteRange(i, len(buf))
+}
+
+// InsertAt inserts the data before the byte at the offset of the local string, or appends it at the end.
+func (r *rcdsSync) InsertAt(offset int, data []byte) error {
+	return r.Replace(offset, 0, data)
+}
+
+// DeleteRange removes the bytes from the offset of the local string.
+func (r *rcdsSync) DeleteRange(offset, length int) error {
+	return r.Replace(offset, length, nil)
+}
 
-	r.Set.Remove(buf)
-	for i := 0; i+len(buf) <= len(r.localRaw); i++ {
-		candidate := r.localRaw[i : i+len(buf)]
-		if bytes.Equal(candidate, buf) {
-			r.localRaw = append(r.localRaw[:i], r.localRaw[i+len(buf):]...)
-			break
+// Replace replaces the bytes from the offset of the local string with the data. It returns ErrEditOutOfRange if the
+// bytes are not within the local string. A string in memory is edited in place and only grows its buffer when it runs
+// out of capacity, but the bytes after the edit still move by the length difference, which costs time proportional to
+// them. A string read from a source is not loaded, the edit is kept as a piece of the string on top of the source.
+func (r *rcdsSync) Replace(offset, length int, data []byte) error {
+	_, size := r.local()
+	if offset < 0 || length < 0 || offset > size || length > size-offset {
+		return fmt.Errorf("%w, %d bytes at %d of a %d bytes string", ErrEditOutOfRange, length, offset, size)
+	}
+	if length == 0 && len(data) == 0 {
+		return nil
+	}
+	if r.shared {
+		r.localRaw, r.tree, r.shared = slices.Clone(r.localRaw), r.tree.clone(), false
+	}
+	if r.source != nil {
+		pieces, ok := r.source.(*pieceString)
+		if !ok {
+			pieces = newPieceString(r.source, r.sourceSize)
 		}
+		r.source, r.sourceSize = pieces.replace(offset, length, data), size-length+len(data)
+		return r.edit(offset, length)
 	}
 
-	if err := r.rebuildMetadata(); err != nil {
-		return err
+	n, size := len(r.localRaw), len(r.localRaw)-length+len(data)
+	if size > n {
+		r.localRaw = slices.Grow(r.localRaw, size-n)[:size]
 	}
-	return r.backend.DeleteElement(buf)
+	copy(r.localRaw[offset+len(data):], r.localRaw[offset+length:n])
+	copy(r.localRaw[offset:], data)
+	r.localRaw = r.localRaw[:size]
+	return r.edit(offset, length)
 }
 
+// edit patches the partition tree after the bytes deleted at the offset of the local string are replaced, which only
+// re-chunks the region around the edit. The tree is rebuilt and the rebuild counted if it cannot be patched.
+func (r *rcdsSync) edit(offset, deleted int) error {
+	src, size := r.local()
+	if err := r.tree.replace(offset, deleted, src, size); err != nil {
+		logrus.Warnf("Rebuilding the partition tree after failing to patch it, %v", err)
+		r.rebuilds++
+		return r.rebuildMetadata()
+	}
+	return nil
+}
+
+// SyncClient reconciles the local string with the server in the mode set by WithSyncMode, which pulls the server string
+// by default. The shingle sets are reconciled first, after which the peer receiving a string descends the partition
+// tree of the other, which sends the cycle information of its string and the chunks the receiver does not have.
 func (r *rcdsSync) SyncClient(ip string, port int) error {
+	return r.SyncClientContext(context.Background(), ip, port)
+}
+
+// SyncClientContext runs SyncClient until the context is done.
+func (r *rcdsSync) SyncClientContext(ctx context.Context, ip string, port int) error {
+	client, err := genSync.NewTcpConnection(ip, port, r.connOptions...)
+	if err != nil {
+		return err
+	}
+	if err = client.ConnectContext(ctx); err != nil {
+		return err
+	}
+	defer client.Close()
+	return genSync.RunContext(ctx, client, r.SyncClientConn)
+}
+
+// SyncClientConn runs the client side of SyncClient over an established connection, which the shingle set backend
+// shares.
+func (r *rcdsSync) SyncClientConn(client genSync.Connection) error {
 	r.additionals = set.New()
-	r.backend.SetFreezeLocal(r.FreezeLocal)
-	if err := r.backend.SyncClient(ip, port); err != nil {
+	r.conflicts = nil
+	r.replaced = false
+	meter := genSync.NewMeter(client)
+	defer func() {
+		r.stats = meter.Stop()
+		r.SentBytes, r.ReceivedBytes = r.stats.SentBytes, r.stats.ReceivedBytes
+	}()
+
+	// The shingle set backend opens its own handshake.
+	meter.Start(genSync.PhaseHandshake)
+	handshake, err := genSync.NewHandshake(algorithm.RCDS, r.hasher, r.levels)
+	if err != nil {
+		return err
+	}
+	if err = genSync.HandshakeClient(client, handshake); err != nil {
+		return err
+	}
+	meter.Start(genSync.PhaseTable)
+	serverOnly, err := r.syncShingles(client, false)
+	if err != nil {
+		return err
+	}
+
+	meter.Start(genSync.PhaseDigest)
+
+	if err = client.SendSyncStatus(uint8(r.mode)); err != nil {
 		return err
 	}
+	if status, err := client.ReceiveSyncStatus(); err != nil {
+		return err
+	} else if status != genSync.SYNC_SUCCESS {
+		return fmt.Errorf("server does not support the %s sync mode", r.mode)
+	}
 
-	r.syncFromBackendState()
+	// Compare digest of the remote and local string
+	b, err := client.Receive()
+	if err != nil {
+		return err
+	}
+	serverDigest := util.BytesToUint64(b)
+	digest, err := r.digest()
+	if err != nil {
+		return err
+	}
+	if r.mode == PushMode {
+		if _, err = client.Send(util.Uint64ToBytes(digest)); err != nil {
+			return err
+		}
+	}
+	isSame := serverDigest == digest
+	if err = client.SendSkipSyncBoolWithInfo(isSame, "No sync operation necessary, local and remote digests are the same."); err != nil {
+		return err
+	}
+	if isSame {
+		return nil
+	}
+
+	meter.Start(genSync.PhaseLiteral)
+
+	switch r.mode {
+	case PushMode:
+		if skipSync, err := client.ReceiveSkipSyncBoolWithInfo("Server is freezing local string and skipping string update."); err != nil {
+			return err
+		} else if skipSync {
+			return nil
+		}
+		return r.sendString(client, serverOnly)
+	case MergeMode:
+		return r.mergeClient(client, serverOnly, serverDigest)
+	}
+
+	if err = client.SendSkipSyncBoolWithInfo(r.FreezeLocal, "Client is freezing local string and skipping string update."); err != nil {
+		return err
+	}
+	if r.FreezeLocal {
+		return nil
+	}
+	remote, err := r.receiveString(client, serverOnly, serverDigest)
+	if err != nil {
+		return err
+	}
+	r.setString(remote)
 	return nil
 }
 
+// SyncServer reconciles the local string with a client in the mode the client requests. The local string is only
+// altered by push and merge syncs.
 func (r *rcdsSync) SyncServer(ip string, port int) error {
+	return r.SyncServerContext(context.Background(), ip, port)
+}
+
+// SyncServerContext runs SyncServer until the context is done.
+func (r *rcdsSync) SyncServerContext(ctx context.Context, ip string, port int) error {
+	server, err := genSync.NewTcpConnection(ip, port, r.connOptions...)
+	if err != nil {
+		return err
+	}
+	if err = server.ListenContext(ctx); err != nil {
+		return err
+	}
+	defer server.Close()
+	return genSync.RunContext(ctx, server, r.SyncServerConn)
+}
+
+// SyncServerConn runs the server side of SyncServer over an established connection, which the shingle set backend
+// shares.
+func (r *rcdsSync) SyncServerConn(server genSync.Connection) error {
 	r.additionals = set.New()
-	r.backend.SetFreezeLocal(r.FreezeLocal)
-	if err := r.backend.SyncServer(ip, port); err != nil {
+	r.conflicts = nil
+	r.replaced = false
+	meter := genSync.NewMeter(server)
+	defer func() {
+		r.stats = meter.Stop()
+		r.SentBytes, r.ReceivedBytes = r.stats.SentBytes, r.stats.ReceivedBytes
+	}()
+
+	meter.Start(genSync.PhaseHandshake)
+	handshake, err := genSync.NewHandshake(algorithm.RCDS, r.hasher, r.levels)
+	if err != nil {
+		return err
+	}
+	if err = genSync.HandshakeServer(server, handshake); err != nil {
+		return err
+	}
+	meter.Start(genSync.PhaseTable)
+	clientOnly, err := r.syncShingles(server, true)
+	if err != nil {
+		return err
+	}
+
+	meter.Start(genSync.PhaseDigest)
+	status, err := server.ReceiveSyncStatus()
+	if err != nil {
+		return err
+	}
+	mode := SyncMode(status)
+	if mode > MergeMode {
+		if err = server.SendSyncStatus(genSync.SYNC_FAIL); err != nil {
+			return err
+		}
+		return fmt.Errorf("client requests unknown sync mode %d", status)
+	}
+	if err = server.SendSyncStatus(genSync.SYNC_SUCCESS); err != nil {
+		return err
+	}
+
+	digest, err := r.digest()
+	if err != nil {
+		return err
+	}
+	if _, err = server.Send(util.Uint64ToBytes(digest)); err != nil {
+		return err
+	}
+	var clientDigest uint64
+	if mode == PushMode {
+		b, err := server.Receive()
+		if err != nil {
+			return err
+		}
+		clientDigest = util.BytesToUint64(b)
+	}
+	if skipSync, err := server.ReceiveSkipSyncBoolWithInfo("No sync operation necessary, local and remote digests are the same."); err != nil {
+		return err
+	} else if skipSync {
+		return nil
+	}
+
+	meter.Start(genSync.PhaseLiteral)
+	switch mode {
+	case PushMode:
+		if err = server.SendSkipSyncBoolWithInfo(r.FreezeLocal, "Server is freezing local string and skipping string update."); err != nil {
+			return err
+		}
+		if r.FreezeLocal {
+			return nil
+		}
+		remote, err := r.receiveString(server, clientOnly, clientDigest)
+		if err != nil {
+			return err
+		}
+		r.setString(remote)
+		return nil
+	case MergeMode:
+		return r.mergeServer(server, clientOnly)
+	}
+
+	if skipSync, err := server.ReceiveSkipSyncBoolWithInfo("Client is freezing local, skipping the rest of the sync..."); err != nil {
+		return err
+	} else if skipSync {
+		return nil
+	}
+	return r.sendString(server, clientOnly)
+}
+
+// mergeClient merges the server string into the local string against the merge base and sends the merged string to
+// the server. Both strings are left unchanged if the merge has conflicts.
+func (r *rcdsSync) mergeClient(conn genSync.Connection, serverOnly []hashShingleSet, serverDigest uint64) error {
+	if err := conn.SendSkipSyncBoolWithInfo(r.FreezeLocal, "Client is freezing local string and skipping the merge."); err != nil {
+		return err
+	}
+	if skipSync, err := conn.ReceiveSkipSyncBoolWithInfo("Server is freezing local string and skipping the merge."); err != nil {
+		return err
+	} else if skipSync || r.FreezeLocal {
+		return nil
+	}
+
+	remote, err := r.receiveString(conn, serverOnly, serverDigest)
+	if err != nil {
+		return err
+	}
+	// The merged string is held in memory and replaces the local string, so the received string is not kept.
+	defer remote.discard()
+	merged, conflicts, err := r.merge(remote.tree)
+	if err != nil {
 		return err
 	}
+	if err = conn.SendSkipSyncBoolWithInfo(len(conflicts) > 0, "Merge has %d conflicts, leaving both strings unchanged.", len(conflicts)); err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		r.conflicts = conflicts
+		return fmt.Errorf("%w, %d conflicting regions", ErrMergeConflict, len(conflicts))
+	}
+
+	tree, err := newPartitionTree(merged, r.levels, r.hasher)
+	if err != nil {
+		return err
+	}
+	// The client knows the exact shingles of the server, so it tells the server which shingles of the merged string it
+	// does not have instead of reconciling the shingle sets again.
+	if _, err = conn.Send(util.Uint64ToBytes(tree.rootHash())); err != nil {
+		return err
+	}
+	if _, err = conn.SendBytesSlice(encodeShingles(shingleDifference(tree.shingles, remote.shingles))); err != nil {
+		return err
+	}
+	r.setString(&receivedString{raw: merged, tree: tree, received: remote.received})
+	return r.sendString(conn, shingleDifference(remote.shingles, tree.shingles))
+}
+
+// mergeServer sends the local string to a merging client and replaces it with the merged string the client sends back.
+func (r *rcdsSync) mergeServer(conn genSync.Connection, clientOnly []hashShingleSet) error {
+	if skipSync, err := conn.ReceiveSkipSyncBoolWithInfo("Client is freezing local string and skipping the merge."); err != nil {
+		return err
+	} else if err = conn.SendSkipSyncBoolWithInfo(r.FreezeLocal, "Server is freezing local string and skipping the merge."); err != nil {
+		return err
+	} else if skipSync || r.FreezeLocal {
+		return nil
+	}
+
+	if err := r.sendString(conn, clientOnly); err != nil {
+		return err
+	}
+	if skipSync, err := conn.ReceiveSkipSyncBoolWithInfo("Client merge has conflicts, leaving the local string unchanged."); err != nil {
+		return err
+	} else if skipSync {
+		return nil
+	}
+	b, err := conn.Receive()
+	if err != nil {
+		return err
+	}
+	mergedDigest := util.BytesToUint64(b)
+	mergedOnlyBytes, err := conn.ReceiveBytesSlice()
+	if err != nil {
+		return err
+	}
+	mergedOnly, err := decodeShingles(mergedOnlyBytes, len(r.levels))
+	if err != nil {
+		return err
+	}
+	merged, err := r.receiveString(conn, mergedOnly, mergedDigest)
+	if err != nil {
+		return err
+	}
+	r.setString(merged)
+	return nil
+}
+
+// receivedString is a string reconstructed from a remote partition tree, which is held in memory unless it is spooled
+// to a temporary file.
+type receivedString struct {
+	raw      []byte
+	file     *tempFile
+	size     int
+	tree     *partitionTree
+	received *set.Set
+	// shingles are the shingles of the remote string.
+	shingles []hashShingleSet
+}
+
+// discard removes the temporary file of a string that does not replace the local string.
+func (s *receivedString) discard() {
+	if s.file == nil {
+		return
+	}
+	if err := s.file.Close(); err != nil {
+		logrus.Warnf("failed to remove the received string, %v", err)
+	}
+}
+
+// receiveString reconstructs the string of the remote peer, given the remote shingles the local tree does not have. The
+// string is spooled to a temporary file if the local string is read from a source, so that neither is loaded into
+// memory.
+func (r *rcdsSync) receiveString(conn genSync.Connection, remoteOnly []hashShingleSet, remoteDigest uint64) (*receivedString, error) {
+	// The remote reports the local shingles that it does not have, so the exact remote shingle set of every level is
+	// known.
+	localOnly, err := conn.ReceiveBytesSlice()
+	if err != nil {
+		return nil, err
+	}
+	remoteShingles, err := r.remoteShingles(localOnly, remoteOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	// Descend the partition tree of the remote one level per round, requesting the nodes missing from the local tree.
+	remoteNodes := make([]map[uint64]*remoteNode, len(r.levels))
+	rootBuf, err := conn.Receive()
+	if err != nil {
+		return nil, err
+	}
+	root, err := decodeNodeReply(rootBuf, remoteShingles, 0)
+	if err != nil {
+		return nil, err
+	}
+	pending := r.missingNodes(root.children, nil)
+	for level := 0; len(pending) > 0; level++ {
+		if level >= len(r.levels) {
+			return nil, fmt.Errorf("remote partition tree is deeper than %d levels", len(r.levels))
+		}
+		requests := make([][]byte, len(pending))
+		for i, h := range pending {
+			requests[i] = util.Uint64ToBytes(h)
+		}
+		if _, err = conn.SendBytesSlice(requests); err != nil {
+			return nil, err
+		}
+		replies, err := conn.ReceiveBytesSlice()
+		if err != nil {
+			return nil, err
+		}
+		if len(replies) != len(pending) {
+			return nil, fmt.Errorf("requested %d nodes from remote but received %d", len(pending), len(replies))
+		}
+
+		remoteNodes[level] = make(map[uint64]*remoteNode, len(pending))
+		var next []uint64
+		requested := make(map[uint64]bool)
+		for i, b := range replies {
+			node, err := decodeNodeReply(b, remoteShingles, level+1)
+			if err != nil {
+				return nil, err
+			}
+			if node.children == nil {
+				if d, err := algorithm.HashString(string(node.literal)).ToUint64With(r.hasher); err != nil {
+					return nil, err
+				} else if d != pending[i] {
+					return nil, fmt.Errorf("received chunk does not match the requested hash %d", pending[i])
+				}
+			}
+			remoteNodes[level][pending[i]] = node
+			next = append(next, r.missingNodes(node.children, requested)...)
+		}
+		pending = next
+	}
+	// An empty request ends the descent.
+	if _, err = conn.SendBytesSlice(nil); err != nil {
+		return nil, err
+	}
+
+	res := &receivedString{received: set.New(), shingles: remoteShingles}
+	if r.source == nil {
+		var buf bytes.Buffer
+		if err = r.assemble(&buf, root, 0, remoteNodes, res.received); err != nil {
+			return nil, err
+		}
+		res.raw, res.size = buf.Bytes(), buf.Len()
+		res.tree, err = newPartitionTree(res.raw, r.levels, r.hasher)
+	} else {
+		err = r.spool(res, root, remoteNodes)
+	}
+	if err != nil {
+		res.discard()
+		return nil, err
+	}
+	if res.tree.rootHash() != remoteDigest {
+		res.discard()
+		return nil, fmt.Errorf("reconstructed string does not match the remote digest")
+	}
+	return res, nil
+}
+
+// spool assembles the remote string into a temporary file and partitions it from there.
+func (r *rcdsSync) spool(s *receivedString, root *remoteNode, remoteNodes []map[uint64]*remoteNode) error {
+	f, err := newTempFile()
+	if err != nil {
+		return err
+	}
+	s.file = &f
+	w := bufio.NewWriter(f)
+	if err = r.assemble(w, root, 0, remoteNodes, s.received); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	s.size = int(size)
+	s.tree, err = newStreamingPartitionTree(f, s.size, r.levels, r.hasher)
+	return err
+}
+
+// sendString serves the local partition tree to a remote peer reconstructing the local string, given the remote
+// shingles that the local tree does not have.
+func (r *rcdsSync) sendString(conn genSync.Connection, remoteOnly []hashShingleSet) error {
+	if _, err := conn.SendBytesSlice(encodeShingles(remoteOnly)); err != nil {
+		return err
+	}
+
+	rootReply, err := r.nodeReply(partitionNode{level: rootLevel}, 0)
+	if err != nil {
+		return err
+	}
+	if _, err = conn.Send(rootReply); err != nil {
+		return err
+	}
+
+	// Answer the node requests of each level until the remote sends an empty request.
+	for level := 0; ; level++ {
+		requests, err := conn.ReceiveBytesSlice()
+		if err != nil {
+			return err
+		}
+		if len(requests) == 0 {
+			return nil
+		}
+		if level >= len(r.levels) {
+			return fmt.Errorf("remote requests nodes below the %d partition levels", len(r.levels))
+		}
+		replies := make([][]byte, len(requests))
+		for j, req := range requests {
+			node, isExist := r.tree.node(level, util.BytesToUint64(req))
+			if !isExist {
+				return fmt.Errorf("chunk %d is not at partition level %d", util.BytesToUint64(req), level)
+			}
+			if replies[j], err = r.nodeReply(node, level+1); err != nil {
+				return err
+			}
+		}
+		if _, err = conn.SendBytesSlice(replies); err != nil {
+			return err
+		}
+	}
+}
+
+// setString replaces the local string with a received string, whose temporary file becomes the source of the local
+// string.
+func (r *rcdsSync) setString(s *receivedString) {
+	if err := r.Close(); err != nil {
+		logrus.Warnf("failed to close the source of the local string, %v", err)
+	}
+	r.localRaw = s.raw
+	if s.file != nil {
+		r.source, r.sourceSize, r.sourceCloser = s.file, s.size, s.file
+	}
+	r.tree, r.shared = s.tree, false
+	r.additionals = s.received
+	r.replaced = true
+}
+
+// Snapshot shares the local string and its partition tree with a session of a genSync.Server, so taking a snapshot
+// neither copies nor partitions the string. Both are copied on the next edit of either sync instead, and a source is
+// closed once the sync and every session sharing it are closed.
+func (r *rcdsSync) Snapshot() (genSync.GenSync, error) {
+	r.shared = true
+	return &rcdsSync{
+		additionals:  set.New(),
+		FreezeLocal:  r.FreezeLocal,
+		levels:       r.levels,
+		hasher:       r.hasher,
+		localRaw:     r.localRaw,
+		tree:         r.tree,
+		shared:       true,
+		mode:         r.mode,
+		mergeBase:    r.mergeBase,
+		source:       r.source,
+		sourceSize:   r.sourceSize,
+		sourceCloser: r.shareSource(),
+		newBackend:   r.newBackend,
+		connOptions:  r.connOptions,
+	}, nil
+}
 
-	r.syncFromBackendState()
+// Apply replaces the local string with the string a push or merge session received, which the sync shares with the
+// session as it shares a snapshot. As every such session replaces the whole string, the session applied last wins and
+// edits made since its snapshot are lost.
+func (r *rcdsSync) Apply(session genSync.GenSync) error {
+	s, ok := session.(*rcdsSync)
+	if !ok {
+		return fmt.Errorf("cannot apply a %T session to an rcds sync", session)
+	}
+	if !s.replaced {
+		return nil
+	}
+	closer := s.shareSource()
+	if err := r.Close(); err != nil {
+		logrus.Warnf("failed to close the source of the local string, %v", err)
+	}
+	r.localRaw, r.source, r.sourceSize, r.sourceCloser = s.localRaw, s.source, s.sourceSize, closer
+	r.tree, r.additionals, r.replaced = s.tree, s.additionals, true
+	r.shared, s.shared = true, true
 	return nil
 }
 
+// shareSource returns a closer of the source of the local string for another sync that shares it, or nil if the source
+// is not closed by the sync.
+func (r *rcdsSync) shareSource() io.Closer {
+	if r.sourceCloser == nil {
+		return nil
+	}
+	c, ok := r.sourceCloser.(*sharedCloser)
+	if !ok {
+		c = &sharedCloser{closer: r.sourceCloser, refs: 1}
+		r.sourceCloser = c
+	}
+	return c.share()
+}
+
+// GetLocalSet returns the leaf chunks of the local string, which are read into memory.
 func (r *rcdsSync) GetLocalSet() *set.Set {
-	return r.Set
+	res := set.New()
+	for _, leaf := range r.tree.leaves() {
+		c, err := r.tree.content(leaf)
+		if err != nil {
+			logrus.Errorf("failed to read the local set, %v", err)
+			return res
+		}
+		res.InsertKey(c)
+	}
+	return res
+}
+
+// GetString returns the local string, which is read into memory if the sync reads it from a source.
+func (r *rcdsSync) GetString() string {
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		logrus.Errorf("failed to read the local string, %v", err)
+	}
+	return buf.String()
+}
+
+// WriteTo writes the local string to the writer, streaming it from the source of the sync if it has one.
+func (r *rcdsSync) WriteTo(w io.Writer) (int64, error) {
+	if r.source == nil {
+		n, err := w.Write(r.localRaw)
+		return int64(n), err
+	}
+	return io.Copy(w, io.NewSectionReader(r.source, 0, int64(r.sourceSize)))
 }
 
 func (r *rcdsSync) GetSetAdditions() *set.Set {
@@ -186,51 +1028,301 @@ func (r *rcdsSync) GetReceivedBytes() int {
 	return r.ReceivedBytes
 }
 
+// Stats returns the traffic of the last sync. The shingles are reconciled in the table phase.
+func (r *rcdsSync) Stats() genSync.Stats {
+	return r.stats
+}
+
 func (r *rcdsSync) GetTotalBytes() int {
 	return r.ReceivedBytes + r.SentBytes
 }
 
-func (r *rcdsSync) syncFromBackendState() {
-	r.SentBytes = r.backend.GetSentBytes()
-	r.ReceivedBytes = r.backend.GetReceivedBytes()
-	r.additionals = r.backend.GetSetAdditions()
-	r.Set = r.backend.GetLocalSet()
+// syncShingles reconciles the local hash shingles of every partition level with the remote using the set
+// reconciliation backend and returns the shingles of each level that only the remote has.
+func (r *rcdsSync) syncShingles(conn genSync.Connection, isServer bool) ([]hashShingleSet, error) {
+	shingleSync, err := r.newBackend()
+	if err != nil {
+		return nil, err
+	}
+	for level := range r.tree.shingles {
+		for _, sh := range r.tree.shingles[level].toShingles() {
+			if err = shingleSync.AddElement(sh.toBytes(level)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if isServer {
+		err = shingleSync.SyncServerConn(conn)
+	} else {
+		err = shingleSync.SyncClientConn(conn)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reconciling shingle sets, %v", err)
+	}
+
+	var additions [][]byte
+	for elem := range *shingleSync.GetSetAdditions() {
+		additions = append(additions, []byte(fmt.Sprint(elem)))
+	}
+	return decodeShingles(additions, len(r.levels))
+}
 
-	r.localRaw = r.localRaw[:0]
-	keys := make([]string, 0, len(*r.Set))
-	for elem := range *r.Set {
-		s, ok := elem.(string)
-		if ok {
-			keys = append(keys, s)
+// encodeShingles encodes the shingles of every level as set elements.
+func encodeShingles(shingles []hashShingleSet) [][]byte {
+	var res [][]byte
+	for level := range shingles {
+		for _, sh := range shingles[level].toShingles() {
+			res = append(res, sh.toBytes(level))
 		}
 	}
-	sort.Strings(keys)
-	for _, s := range keys {
-		r.localRaw = append(r.localRaw, []byte(s)...)
+	return res
+}
+
+// decodeShingles decodes the shingles encoded by encodeShingles into the shingle set of each level.
+func decodeShingles(b [][]byte, levels int) ([]hashShingleSet, error) {
+	res := make([]hashShingleSet, levels)
+	for level := range res {
+		res[level] = make(hashShingleSet)
+	}
+	for _, elem := range b {
+		level, sh, err := bytesToShingle(elem)
+		if err != nil {
+			return nil, err
+		}
+		if level >= len(res) {
+			return nil, fmt.Errorf("remote shingle is at partition level %d but only %d levels are used", level, len(res))
+		}
+		if err = res[level].AddShingle(sh.first, sh.second, sh.count); err != nil {
+			return nil, err
+		}
 	}
-	_ = r.rebuildMetadata()
+	return res, nil
 }
 
-func (r *rcdsSync) rebuildMetadata() error {
-	if len(r.localRaw) == 0 {
-		r.chunkList = nil
-		r.dictSize = 0
-		return nil
+// shingleDifference returns the shingles of each level in a that are not in b with the same count.
+func shingleDifference(a, b []hashShingleSet) []hashShingleSet {
+	res := make([]hashShingleSet, len(a))
+	for level := range a {
+		res[level] = make(hashShingleSet)
+		for _, sh := range a[level].toShingles() {
+			if count, err := b[level].getShingleCount(sh.first, sh.second); err != nil || count != sh.count {
+				res[level].AddShingle(sh.first, sh.second, sh.count)
+			}
+		}
 	}
+	return res
+}
 
-	input := string(r.localRaw)
-	chunks, err := contentDependentChunking(&input, r.h, r.r, r.hs)
-	if err != nil {
+// remoteShingles recovers the shingle set of each level of the server from the local shingles, the local shingles the
+// server does not have and the server shingles the client does not have.
+func (r *rcdsSync) remoteShingles(clientOnly [][]byte, serverOnly []hashShingleSet) ([]hashShingleSet, error) {
+	res := make([]hashShingleSet, len(r.levels))
+	for level := range res {
+		res[level] = r.tree.shingles[level].clone()
+	}
+	for _, b := range clientOnly {
+		level, sh, err := bytesToShingle(b)
+		if err != nil {
+			return nil, err
+		}
+		if level >= len(res) {
+			return nil, fmt.Errorf("shingle is at partition level %d but only %d levels are used", level, len(res))
+		}
+		if err = res[level].RemoveSpecShingle(sh.first, sh.second, uint16(sh.count)); err != nil {
+			return nil, err
+		}
+	}
+	for level := range res {
+		if err := res[level].addToHashShingleSet(&serverOnly[level]); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// missingNodes returns the hashes not found in the local partition tree, skipping the ones already requested.
+func (r *rcdsSync) missingNodes(hashes []uint64, requested map[uint64]bool) []uint64 {
+	if requested == nil {
+		requested = make(map[uint64]bool)
+	}
+	var res []uint64
+	for _, h := range hashes {
+		if _, isExist := r.tree.lookup(h); !isExist && !requested[h] {
+			requested[h] = true
+			res = append(res, h)
+		}
+	}
+	return res
+}
+
+// assemble writes the string of a server node, taking the chunks the client has from the local string and the rest
+// from the nodes received at each level. Received leaf chunks are added to the received set.
+func (r *rcdsSync) assemble(w io.Writer, node *remoteNode, level int, remoteNodes []map[uint64]*remoteNode, received *set.Set) error {
+	if node.children == nil {
+		received.InsertKey(string(node.literal))
+		_, err := w.Write(node.literal)
 		return err
 	}
+	for _, h := range node.children {
+		if local, isExist := r.tree.lookup(h); isExist {
+			c, err := r.tree.content(local)
+			if err != nil {
+				return err
+			}
+			if _, err = w.Write(c); err != nil {
+				return err
+			}
+			continue
+		}
+		if level >= len(remoteNodes) {
+			return fmt.Errorf("chunk %d is missing below partition level %d", h, level)
+		}
+		child, isExist := remoteNodes[level][h]
+		if !isExist {
+			return fmt.Errorf("chunk %d at partition level %d is not received", h, level)
+		}
+		if err := r.assemble(w, child, level+1, remoteNodes, received); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remoteNode is a node of the server partition tree, which is either a literal chunk or the hashes of its children.
+type remoteNode struct {
+	literal  []byte
+	children []uint64
+}
+
+const (
+	leafNode     byte = 0
+	internalNode byte = 1
+)
+
+// nodeReply encodes a node for the client. A leaf is sent as a literal chunk and an internal node as the cycle
+// information of its children on the shingles of the child level. A zero cycle number tells the client that the child
+// hashes follow explicitly because the chunks are too repetitive to backtrack.
+func (r *rcdsSync) nodeReply(node partitionNode, childLevel int) ([]byte, error) {
+	hashes := r.tree.childHashes(node)
+	if len(hashes) == 0 {
+		c, err := r.tree.content(node)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{leafNode}, c...), nil
+	}
+
+	info, err := r.tree.shingles[childLevel].BacktrackingWithString(hashes)
+	if errors.Is(err, ErrBacktrackingLimit) {
+		logrus.Infof("Sending %d chunk hashes instead of cycle information, %v", len(hashes), err)
+		info = &CycleInfo{start: hashes[0], stepNum: uint32(len(hashes))}
+	} else if err != nil {
+		return nil, err
+	}
+
+	res := append([]byte{internalNode}, info.toBytes()...)
+	if info.cycleNum == 0 {
+		res = append(res, hashesToBytes(hashes)...)
+	}
+	return res, nil
+}
+
+// decodeNodeReply decodes a node encoded by nodeReply, backtracking its children on the remote shingles of the child
+// level.
+func decodeNodeReply(b []byte, remoteShingles []hashShingleSet, childLevel int) (*remoteNode, error) {
+	if len(b) == 0 {
+		return nil, fmt.Errorf("node reply is empty")
+	}
+	switch b[0] {
+	case leafNode:
+		return &remoteNode{literal: b[1:]}, nil
+	case internalNode:
+		if len(b) < 25 {
+			return nil, fmt.Errorf("internal node reply should have at least 25 bytes but got %d", len(b))
+		}
+		if childLevel >= len(remoteShingles) {
+			return nil, fmt.Errorf("internal node has children below the %d partition levels", len(remoteShingles))
+		}
+		info, err := bytesToCycleInfo(b[1:25])
+		if err != nil {
+			return nil, err
+		}
+		if info.cycleNum == 0 {
+			hashes, err := bytesToHashes(b[25:])
+			if err != nil {
+				return nil, err
+			}
+			if len(hashes) != int(info.stepNum) {
+				return nil, fmt.Errorf("expecting %d chunk hashes but received %d", info.stepNum, len(hashes))
+			}
+			return &remoteNode{children: hashes}, nil
+		}
+		seq, err := remoteShingles[childLevel].BacktrackingWithCycle(*info)
+		if err != nil {
+			return nil, fmt.Errorf("error reconstructing server string, %v", err)
+		}
+		return &remoteNode{children: *seq}, nil
+	default:
+		return nil, fmt.Errorf("unknown node type %d", b[0])
+	}
+}
+
+// digest is the root hash of the local partition tree, which identifies the entire local string.
+func (r *rcdsSync) digest() (uint64, error) {
+	return r.tree.rootHash(), nil
+}
 
-	shingleSet := make(hashShingleSet)
-	dict, err := shingleSet.addChunksToShingleSet(&chunks)
+func (r *rcdsSync) rebuildMetadata() error {
+	var tree *partitionTree
+	var err error
+	if r.source != nil {
+		tree, err = newStreamingPartitionTree(r.source, r.sourceSize, r.levels, r.hasher)
+	} else {
+		tree, err = newPartitionTree(r.localRaw, r.levels, r.hasher)
+	}
 	if err != nil {
 		return err
 	}
-
-	r.chunkList = chunks
-	r.dictSize = len(*dict)
+	r.tree = tree
 	return nil
 }
+
+// toBytes encodes the cycle information as the start, step number and cycle number.
+func (c *CycleInfo) toBytes() []byte {
+	b := make([]byte, 0, 24)
+	b = append(b, util.Uint64ToBytes(c.start)...)
+	b = append(b, util.Uint64ToBytes(uint64(c.stepNum))...)
+	return append(b, util.Uint64ToBytes(uint64(c.cycleNum))...)
+}
+
+// hashesToBytes encodes an array of chunk hashes.
+func hashesToBytes(hashes []uint64) []byte {
+	b := make([]byte, 0, 8*len(hashes))
+	for _, h := range hashes {
+		b = append(b, util.Uint64ToBytes(h)...)
+	}
+	return b
+}
+
+func bytesToHashes(b []byte) ([]uint64, error) {
+	if len(b)%8 != 0 {
+		return nil, fmt.Errorf("encoded chunk hashes should be a multiple of 8 bytes but got %d", len(b))
+	}
+	hashes := make([]uint64, len(b)/8)
+	for i := range hashes {
+		hashes[i] = util.BytesToUint64(b[8*i : 8*i+8])
+	}
+	return hashes, nil
+}
+
+func bytesToCycleInfo(b []byte) (*CycleInfo, error) {
+	if len(b) != 24 {
+		return nil, fmt.Errorf("encoded cycle information should be 24 bytes but got %d", len(b))
+	}
+	return &CycleInfo{
+		start:    util.BytesToUint64(b[:8]),
+		stepNum:  uint32(util.BytesToUint64(b[8:16])),
+		cycleNum: uint32(util.BytesToUint64(b[16:])),
+	}, nil
+}
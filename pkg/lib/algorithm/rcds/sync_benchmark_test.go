@@ -2,10 +2,16 @@ package rcds
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
 	"sync"
 	"sync/atomic"
 	"testing"
+
+	"k8s.io/apimachinery/pkg/util/rand"
 )
 
 var benchmarkPort int64 = 9500
@@ -82,6 +88,38 @@ func BenchmarkRCDSSyncPayloads(b *testing.B) {
 	}
 }
 
+// BenchmarkRCDSSyncFromFile partitions a file and reports the heap the sync holds on to, which is its partition tree and
+// shingles rather than the file.
+func BenchmarkRCDSSyncFromFile(b *testing.B) {
+	const size = 16 << 20
+	path := filepath.Join(b.TempDir(), "local.txt")
+	if err := os.WriteFile(path, []byte(rand.String(size)), 0o600); err != nil {
+		b.Fatalf("write file: %v", err)
+	}
+	b.SetBytes(size)
+	var heap int64
+	var before, after runtime.MemStats
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		b.StartTimer()
+		s, err := NewRCDSSetSyncFromFile(path)
+		if err != nil {
+			b.Fatalf("new sync: %v", err)
+		}
+		b.StopTimer()
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		heap += int64(after.HeapAlloc) - int64(before.HeapAlloc)
+		if err = s.(io.Closer).Close(); err != nil {
+			b.Fatalf("close: %v", err)
+		}
+		b.StartTimer()
+	}
+	b.ReportMetric(float64(heap)/float64(b.N)/(1<<20), "heap-MiB/op")
+}
+
 func payloadForBenchmark(size, idx int, group string) []byte {
 	prefix := fmt.Sprintf("%s-%06d-", group, idx)
 	payload := make([]byte, size)
@@ -1,12 +1,22 @@
 package rcds
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"k8s.io/apimachinery/pkg/util/rand"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm/iblt"
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/genSync"
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/set"
 )
 
 func TestNewRCDSSetSync(t *testing.T) {
@@ -62,6 +72,8 @@ func TestRCDSSync_EndToEnd(t *testing.T) {
 	assert.NoError(t, server.SyncClient("", 8092))
 	wg.Wait()
 
+	assert.Equal(t, "bc", string(server.(*rcdsSync).localRaw))
+	assert.Equal(t, "bc", string(client.(*rcdsSync).localRaw))
 	assert.EqualValues(t, *server.GetLocalSet(), *client.GetLocalSet())
 	assert.Equal(t, server.GetTotalBytes(), client.GetTotalBytes())
 }
@@ -80,16 +92,20 @@ func TestRCDSSync_EndToEndLargePayload(t *testing.T) {
 		port         = 8093
 	)
 
+	var expected []byte
 	for i := 0; i < intersection; i++ {
 		payload := []byte(rand.String(sizePerItem))
 		require.NoError(t, server.AddElement(payload))
 		require.NoError(t, client.AddElement(payload))
+		expected = append(expected, payload...)
 	}
 	for i := 0; i < serverOnly; i++ {
 		require.NoError(t, server.AddElement([]byte(rand.String(sizePerItem))))
 	}
 	for i := 0; i < clientOnly; i++ {
-		require.NoError(t, client.AddElement([]byte(rand.String(sizePerItem))))
+		payload := []byte(rand.String(sizePerItem))
+		require.NoError(t, client.AddElement(payload))
+		expected = append(expected, payload...)
 	}
 
 	var wg sync.WaitGroup
@@ -101,8 +117,596 @@ func TestRCDSSync_EndToEndLargePayload(t *testing.T) {
 	assert.NoError(t, server.SyncClient("", port))
 	wg.Wait()
 
+	assert.Equal(t, expected, server.(*rcdsSync).localRaw)
 	assert.EqualValues(t, *server.GetLocalSet(), *client.GetLocalSet())
-	assert.Len(t, *server.GetSetAdditions(), clientOnly)
-	assert.Len(t, *client.GetSetAdditions(), serverOnly)
+	assert.NotEmpty(t, *server.GetSetAdditions())
+	assert.Empty(t, *client.GetSetAdditions())
 	assert.Equal(t, server.GetTotalBytes(), client.GetTotalBytes())
 }
+
+func TestRCDSSync_EditWithIBLTShingles(t *testing.T) {
+	newShingleSync := func() (genSync.GenSync, error) {
+		return iblt.NewIBLTSetSync(iblt.WithSymmetricSetDiff(32), iblt.WithDataLen(shingleElemSize), iblt.WithMaxSyncRetries(3))
+	}
+	options := []RCDSOption{WithChunkDistance(32), WithRollingWindow(8), WithShingleSetSync(newShingleSync)}
+	server, err := NewRCDSSetSync(options...)
+	require.NoError(t, err)
+	client, err := NewRCDSSetSync(options...)
+	require.NoError(t, err)
+
+	const port = 8094
+	doc := []byte(rand.String(64 * 1024))
+	edited := append([]byte{}, doc[:20000]...)
+	edited = append(edited, []byte("an edit in the middle of the document")...)
+	edited = append(edited, doc[20100:]...)
+
+	require.NoError(t, server.AddElement(edited))
+	require.NoError(t, client.AddElement(doc))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, server.SyncServer("", port))
+	}()
+	assert.NoError(t, client.SyncClient("", port))
+	wg.Wait()
+
+	assert.Equal(t, edited, client.(*rcdsSync).localRaw)
+	assert.Equal(t, edited, server.(*rcdsSync).localRaw)
+	assert.Less(t, client.GetTotalBytes(), len(edited)/4)
+	t.Logf("reconciled %d bytes with %d bytes of traffic", len(edited), client.GetTotalBytes())
+}
+
+func TestRCDSSync_DefaultBackendSendsDifferences(t *testing.T) {
+	server, err := NewRCDSSetSync()
+	require.NoError(t, err)
+	client, err := NewRCDSSetSync()
+	require.NoError(t, err)
+
+	const port = 8116
+	doc := []byte(rand.String(1 << 20))
+	edited := append([]byte{}, doc...)
+	edited[len(edited)/2] ^= 1
+
+	require.NoError(t, server.AddElement(edited))
+	require.NoError(t, client.AddElement(doc))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, server.SyncServer("", port))
+	}()
+	assert.NoError(t, client.SyncClient("", port))
+	wg.Wait()
+
+	assert.Equal(t, edited, client.(*rcdsSync).localRaw)
+	stats := client.Stats()
+	t.Logf("reconciled %d bytes with %d bytes of traffic", len(edited), stats.SentBytes+stats.ReceivedBytes)
+	assert.Less(t, stats.SentBytes+stats.ReceivedBytes, len(edited)/20)
+}
+
+func TestRCDSSync_TrafficFollowsEdits(t *testing.T) {
+	port := 8130
+	// traffic syncs a document with the edits flipping a byte at each of the offsets by the default levels.
+	traffic := func(size int, offsets ...int) int {
+		server, err := NewRCDSSetSync()
+		require.NoError(t, err)
+		client, err := NewRCDSSetSync()
+		require.NoError(t, err)
+
+		doc := []byte(rand.String(size))
+		edited := append([]byte{}, doc...)
+		for _, offset := range offsets {
+			edited[offset] ^= 1
+		}
+		require.NoError(t, server.AddElement(edited))
+		require.NoError(t, client.AddElement(doc))
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func(port int) {
+			defer wg.Done()
+			assert.NoError(t, server.SyncServer("", port))
+		}(port)
+		assert.NoError(t, client.SyncClient("", port))
+		wg.Wait()
+		port++
+
+		assert.Equal(t, edited, client.(*rcdsSync).localRaw)
+		stats := client.Stats()
+		t.Logf("%d edits of %d bytes cost %d bytes", len(offsets), size, stats.SentBytes+stats.ReceivedBytes)
+		return stats.SentBytes + stats.ReceivedBytes
+	}
+
+	// least takes the least traffic of a few documents, since a sync now and then retries a failed IBLT decode.
+	least := func(size int, offsets ...int) int {
+		res := traffic(size, offsets...)
+		for i := 1; i < 3; i++ {
+			res = min(res, traffic(size, offsets...))
+		}
+		return res
+	}
+
+	const small, large = 64 * 1024, 512 * 1024
+	edit := least(small, small/2)
+	// A larger document costs about the same for the same edit, since only the chunks along its path are sent.
+	assert.Less(t, least(large, large/2)-edit, (large-small)/32)
+	// More edits descend more paths of the partition tree.
+	assert.Greater(t, least(small, small/8, small/4, small/2, 3*small/4), edit)
+}
+
+func TestRCDSSync_SameStringSkipsSync(t *testing.T) {
+	server, err := NewRCDSSetSync(WithRollingWindow(2), WithHashSpace(16))
+	require.NoError(t, err)
+	client, err := NewRCDSSetSync(WithRollingWindow(2), WithHashSpace(16))
+	require.NoError(t, err)
+
+	const port = 8095
+	require.NoError(t, server.AddElement([]byte("the same string on both sides")))
+	require.NoError(t, client.AddElement([]byte("the same string on both sides")))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, server.SyncServer("", port))
+	}()
+	assert.NoError(t, client.SyncClient("", port))
+	wg.Wait()
+
+	assert.Empty(t, *client.GetSetAdditions())
+	assert.Equal(t, "the same string on both sides", string(client.(*rcdsSync).localRaw))
+}
+
+func TestRCDSSync_RepetitiveStringFallsBackToHashes(t *testing.T) {
+	defaultSteps := maxBacktrackingSteps
+	maxBacktrackingSteps = 16
+	defer func() { maxBacktrackingSteps = defaultSteps }()
+
+	server, err := NewRCDSSetSync(WithChunkDistance(1), WithRollingWindow(1), WithHashSpace(4))
+	require.NoError(t, err)
+	client, err := NewRCDSSetSync(WithChunkDistance(1), WithRollingWindow(1), WithHashSpace(4))
+	require.NoError(t, err)
+
+	const port = 8096
+	remote := []byte("abcabdabcabdacbadcbabcdabcabcadbcadbcadbcbadbcabdcabcbdbabcdadcbdabcbabd")
+	require.NoError(t, server.AddElement(remote))
+	require.NoError(t, client.AddElement([]byte("abcabdabcabd")))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, server.SyncServer("", port))
+	}()
+	assert.NoError(t, client.SyncClient("", port))
+	wg.Wait()
+
+	assert.Equal(t, remote, client.(*rcdsSync).localRaw)
+}
+
+func TestRCDSSync_MultiLevelEdit(t *testing.T) {
+	newShingleSync := func() (genSync.GenSync, error) {
+		return iblt.NewIBLTSetSync(iblt.WithSymmetricSetDiff(64), iblt.WithDataLen(shingleElemSize), iblt.WithMaxSyncRetries(3))
+	}
+	options := []RCDSOption{
+		WithPartitionLevels(
+			PartitionLevel{ChunkDistance: 512, RollingWindow: 16, HashSpace: 1024},
+			PartitionLevel{ChunkDistance: 64, RollingWindow: 8, HashSpace: 1024},
+			PartitionLevel{ChunkDistance: 8, RollingWindow: 4, HashSpace: 1024},
+		),
+		WithShingleSetSync(newShingleSync),
+	}
+	server, err := NewRCDSSetSync(options...)
+	require.NoError(t, err)
+	client, err := NewRCDSSetSync(options...)
+	require.NoError(t, err)
+
+	const port = 8097
+	doc := []byte(rand.String(256 * 1024))
+	edited := append([]byte{}, doc[:100000]...)
+	edited = append(edited, 'x')
+	edited = append(edited, doc[100001:]...)
+
+	require.NoError(t, server.AddElement(edited))
+	require.NoError(t, client.AddElement(doc))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, server.SyncServer("", port))
+	}()
+	assert.NoError(t, client.SyncClient("", port))
+	wg.Wait()
+
+	assert.Equal(t, edited, client.(*rcdsSync).localRaw)
+	assert.EqualValues(t, *server.GetLocalSet(), *client.GetLocalSet())
+	// Only the leaf chunks around the edit are sent literally.
+	for c := range *client.GetSetAdditions() {
+		assert.Less(t, len(fmt.Sprint(c)), 512)
+	}
+	assert.Less(t, client.GetTotalBytes(), len(edited)/16)
+	t.Logf("reconciled %d bytes with %d bytes of traffic", len(edited), client.GetTotalBytes())
+}
+
+func TestNewRCDSSetSync_Levels(t *testing.T) {
+	r, err := NewRCDSSetSync()
+	require.NoError(t, err)
+	assert.Equal(t, []PartitionLevel{
+		{ChunkDistance: 1024, RollingWindow: defaultRollingR, HashSpace: defaultHashSpace},
+		{ChunkDistance: 256, RollingWindow: defaultRollingR, HashSpace: defaultHashSpace},
+		{ChunkDistance: 64, RollingWindow: defaultRollingR, HashSpace: defaultHashSpace},
+	}, r.(*rcdsSync).levels)
+
+	r, err = NewRCDSSetSync(WithChunkDistance(64), WithLevelNum(3))
+	require.NoError(t, err)
+	assert.Equal(t, []PartitionLevel{
+		{ChunkDistance: 64, RollingWindow: defaultRollingR, HashSpace: defaultHashSpace},
+		{ChunkDistance: 16, RollingWindow: defaultRollingR, HashSpace: defaultHashSpace},
+		{ChunkDistance: 4, RollingWindow: defaultRollingR, HashSpace: defaultHashSpace},
+	}, r.(*rcdsSync).levels)
+
+	_, err = NewRCDSSetSync(WithLevelNum(2), WithPartitionLevels(PartitionLevel{ChunkDistance: 4, RollingWindow: 2, HashSpace: 16}))
+	assert.Error(t, err)
+	_, err = NewRCDSSetSync(WithPartitionLevels(PartitionLevel{ChunkDistance: 4, RollingWindow: 0, HashSpace: 16}))
+	assert.Error(t, err)
+}
+
+func TestRCDSSync_FromFile(t *testing.T) {
+	const port = 8098
+	block := rand.String(8192)
+	remote := []byte(block + rand.String(2048) + block)
+	path := filepath.Join(t.TempDir(), "remote.txt")
+	require.NoError(t, os.WriteFile(path, remote, 0o600))
+
+	server, err := NewRCDSSetSyncFromFile(path, WithLevelNum(2))
+	require.NoError(t, err)
+	defer server.(io.Closer).Close()
+	assert.Nil(t, server.(*rcdsSync).localRaw)
+
+	local := append([]byte(block), []byte("local edits")...)
+	client, err := NewRCDSSetSyncFromReader(bytesReaderAt(local), int64(len(local)), WithLevelNum(2))
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, server.SyncServer("", port))
+	}()
+	assert.NoError(t, client.SyncClient("", port))
+	wg.Wait()
+
+	// The client spools the received string to a temporary file instead of loading it.
+	assert.Nil(t, client.(*rcdsSync).localRaw)
+	spooled := client.(*rcdsSync).sourceCloser.(*tempFile).Name()
+	assert.FileExists(t, spooled)
+	assert.Equal(t, string(remote), client.(Document).GetString())
+	assert.EqualValues(t, *server.GetLocalSet(), *client.GetLocalSet())
+	require.NoError(t, client.(io.Closer).Close())
+	assert.NoFileExists(t, spooled)
+
+	// Editing a sync of a file keeps the edits on top of the file instead of loading it.
+	require.NoError(t, server.AddElement([]byte("!")))
+	require.NoError(t, server.DeleteElement(remote[100:200]))
+	require.NoError(t, server.(Editor).Replace(8000, 300, []byte("replaced")))
+	edited := append(append(append([]byte(nil), remote[:100]...), remote[200:]...), '!')
+	edited = append(append(append([]byte(nil), edited[:8000]...), "replaced"...), edited[8300:]...)
+	assert.Nil(t, server.(*rcdsSync).localRaw)
+	assert.Equal(t, string(edited), server.(Document).GetString())
+	fresh, err := newPartitionTree(edited, server.(*rcdsSync).levels, server.(*rcdsSync).hasher)
+	require.NoError(t, err)
+	assert.Equal(t, fresh.rootHash(), server.(*rcdsSync).tree.rootHash())
+	assert.Zero(t, server.(*rcdsSync).rebuilds)
+
+	_, err = NewRCDSSetSyncFromFile(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
+
+// bytesReaderAt is a reader of bytes that only implements io.ReaderAt.
+type bytesReaderAt []byte
+
+func (b bytesReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(b)) {
+		return 0, io.EOF
+	}
+	n := copy(p, b[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func TestRCDSSync_IncrementalEdit(t *testing.T) {
+	raw := []byte(rand.String(20000))
+	syncer, err := NewRCDSSetSync(WithLevelNum(2))
+	require.NoError(t, err)
+	require.NoError(t, syncer.AddElement(raw))
+
+	line := []byte(rand.String(80))
+	require.NoError(t, syncer.AddElement(line))
+	require.NoError(t, syncer.DeleteElement(raw[5000:5100]))
+	raw = append(append(append([]byte(nil), raw[:5000]...), raw[5100:]...), line...)
+
+	fresh, err := NewRCDSSetSync(WithLevelNum(2))
+	require.NoError(t, err)
+	require.NoError(t, fresh.AddElement(raw))
+
+	edited, rebuilt := syncer.(*rcdsSync), fresh.(*rcdsSync)
+	assert.Equal(t, rebuilt.tree.rootHash(), edited.tree.rootHash())
+	assert.Equal(t, rebuilt.tree.shingles, edited.tree.shingles)
+	assert.Equal(t, rebuilt.GetLocalSet(), edited.GetLocalSet())
+	assert.Zero(t, edited.rebuilds)
+}
+
+func TestRCDSSync_EditAt(t *testing.T) {
+	syncer, err := NewRCDSSetSync(WithLevelNum(2))
+	require.NoError(t, err)
+	editor, ok := syncer.(Editor)
+	require.True(t, ok)
+
+	raw := []byte(rand.String(10000))
+	require.NoError(t, editor.InsertAt(0, raw))
+	edits := []struct {
+		offset, length int
+		data           []byte
+	}{
+		{offset: 100, data: []byte("inserted")},
+		{offset: 5000, length: 200},
+		{offset: 7000, length: 10, data: []byte(rand.String(300))},
+		{offset: 20, length: 5, data: []byte("12345")},
+		{offset: 2000, length: 50, data: []byte("short")},
+		{offset: 0, length: 10},
+	}
+	for _, e := range edits {
+		require.NoError(t, editor.Replace(e.offset, e.length, e.data))
+		raw = append(append(append([]byte(nil), raw[:e.offset]...), e.data...), raw[e.offset+e.length:]...)
+	}
+	require.NoError(t, editor.InsertAt(len(raw), []byte("tail")))
+	// Deleting the bytes before the appended tail.
+	require.NoError(t, editor.DeleteRange(len(raw)-50, 50))
+	raw = append(raw[:len(raw)-50], []byte("tail")...)
+
+	r := syncer.(*rcdsSync)
+	assert.Equal(t, string(raw), string(r.localRaw))
+	fresh, err := newPartitionTree(raw, r.levels, r.hasher)
+	require.NoError(t, err)
+	assert.Equal(t, fresh.rootHash(), r.tree.rootHash())
+
+	assert.ErrorIs(t, editor.InsertAt(len(raw)+1, []byte("a")), ErrEditOutOfRange)
+	assert.ErrorIs(t, editor.DeleteRange(-1, 1), ErrEditOutOfRange)
+	assert.ErrorIs(t, editor.Replace(len(raw)-1, 2, nil), ErrEditOutOfRange)
+	assert.Equal(t, string(raw), string(r.localRaw))
+	assert.Zero(t, r.rebuilds)
+
+	// A tree that cannot be patched, since the shingles it removes are gone, is rebuilt.
+	r.tree.shingles[0] = make(hashShingleSet)
+	require.NoError(t, editor.InsertAt(5000, []byte("rebuilt")))
+	raw = append(append(append([]byte(nil), raw[:5000]...), "rebuilt"...), raw[5000:]...)
+	assert.Equal(t, 1, r.rebuilds)
+	fresh, err = newPartitionTree(raw, r.levels, r.hasher)
+	require.NoError(t, err)
+	assert.Equal(t, fresh.rootHash(), r.tree.rootHash())
+	assert.Equal(t, fresh.shingles, r.tree.shingles)
+}
+
+func TestRCDSSync_GetString(t *testing.T) {
+	const port = 8099
+	// Lines in reverse order, so that a sorted concatenation of chunks cannot pass as the document.
+	var lines []string
+	for i := 300; i > 0; i-- {
+		lines = append(lines, fmt.Sprintf("line %03d of the remote document\n", i))
+	}
+	remote := []byte(strings.Join(lines, ""))
+	server, err := NewRCDSSetSyncFromReader(bytesReaderAt(remote), int64(len(remote)), WithLevelNum(2))
+	require.NoError(t, err)
+	local := append([]byte("a line only the client has\n"), remote[2000:]...)
+	client, err := NewRCDSSetSync(WithLevelNum(2))
+	require.NoError(t, err)
+	require.NoError(t, client.AddElement(local))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, server.SyncServer("", port))
+	}()
+	assert.NoError(t, client.SyncClient("", port))
+	wg.Wait()
+
+	for _, s := range []genSync.GenSync{client, server} {
+		doc, ok := s.(Document)
+		require.True(t, ok)
+		assert.Equal(t, string(remote), doc.GetString())
+		var buf bytes.Buffer
+		n, err := doc.WriteTo(&buf)
+		require.NoError(t, err)
+		assert.EqualValues(t, len(remote), n)
+		assert.Equal(t, remote, buf.Bytes())
+	}
+}
+
+func TestRCDSSync_Push(t *testing.T) {
+	const port = 8110
+	doc := []byte(rand.String(32 * 1024))
+	edited := append(append([]byte{}, doc[:10000]...), doc[10200:]...)
+
+	server, err := NewRCDSSetSync(WithLevelNum(2))
+	require.NoError(t, err)
+	require.NoError(t, server.AddElement(doc))
+	client, err := NewRCDSSetSync(WithLevelNum(2), WithSyncMode(PushMode))
+	require.NoError(t, err)
+	require.NoError(t, client.AddElement(edited))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, server.SyncServer("", port))
+	}()
+	assert.NoError(t, client.SyncClient("", port))
+	wg.Wait()
+
+	assert.Equal(t, string(edited), server.(Document).GetString())
+	assert.Equal(t, string(edited), client.(Document).GetString())
+
+	// A frozen server keeps its string.
+	require.NoError(t, client.AddElement([]byte("more")))
+	server.SetFreezeLocal(true)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, server.SyncServer("", port))
+	}()
+	assert.NoError(t, client.SyncClient("", port))
+	wg.Wait()
+	assert.Equal(t, string(edited), server.(Document).GetString())
+}
+
+func TestRCDSSync_Merge(t *testing.T) {
+	const port = 8111
+	base := []byte(rand.String(32 * 1024))
+	splice := func(s []byte, offset, deleted int, data string) []byte {
+		return append(append(append([]byte(nil), s[:offset]...), data...), s[offset+deleted:]...)
+	}
+	syncPair := func(local, remote []byte) (client, server genSync.GenSync, err error) {
+		client, err = NewRCDSSetSync(WithLevelNum(2), WithSyncMode(MergeMode), WithMergeBase(base))
+		require.NoError(t, err)
+		require.NoError(t, client.AddElement(local))
+		server, err = NewRCDSSetSync(WithLevelNum(2))
+		require.NoError(t, err)
+		require.NoError(t, server.AddElement(remote))
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, server.SyncServer("", port))
+		}()
+		err = client.SyncClient("", port)
+		wg.Wait()
+		return client, server, err
+	}
+
+	local := splice(base, 2000, 100, "a local edit")
+	remote := splice(base, 20000, 0, "a remote insertion")
+	client, server, err := syncPair(local, remote)
+	require.NoError(t, err)
+	expected := splice(remote, 2000, 100, "a local edit")
+	assert.Equal(t, string(expected), client.(Document).GetString())
+	assert.Equal(t, string(expected), server.(Document).GetString())
+	assert.Empty(t, client.(ConflictReporter).Conflicts())
+
+	// Conflicting edits leave both strings unchanged and are reported to the client.
+	local = splice(base, 9000, 10, "a local edit")
+	remote = splice(base, 9002, 4, "a remote edit")
+	client, server, err = syncPair(local, remote)
+	assert.ErrorIs(t, err, ErrMergeConflict)
+	assert.Equal(t, string(local), client.(Document).GetString())
+	assert.Equal(t, string(remote), server.(Document).GetString())
+	conflicts := client.(ConflictReporter).Conflicts()
+	require.Len(t, conflicts, 1)
+	assert.Contains(t, string(conflicts[0].Local), "a local edit")
+	assert.Contains(t, string(conflicts[0].Remote), "a remote edit")
+}
+
+func TestRCDSSync_Server(t *testing.T) {
+	const port = 8112
+	doc := []byte(rand.String(32 * 1024))
+	edited := append(append([]byte{}, doc[:10000]...), doc[10200:]...)
+
+	hub, err := NewRCDSSetSync(WithLevelNum(2))
+	require.NoError(t, err)
+	require.NoError(t, hub.AddElement(doc))
+	server, err := genSync.NewServer(hub, "", port, genSync.WithMaxSessions(3))
+	require.NoError(t, err)
+	served := make(chan error)
+	go func() {
+		served <- server.Serve()
+	}()
+
+	// Edges pulling concurrently each receive the string of the hub.
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		edge, err := NewRCDSSetSync(WithLevelNum(2))
+		require.NoError(t, err)
+		require.NoError(t, edge.AddElement(edited))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, edge.SyncClient("", port))
+			assert.Equal(t, string(doc), edge.(Document).GetString())
+		}()
+	}
+	wg.Wait()
+
+	// A pushing edge replaces the string of the hub once its session ends.
+	pusher, err := NewRCDSSetSync(WithLevelNum(2), WithSyncMode(PushMode))
+	require.NoError(t, err)
+	require.NoError(t, pusher.AddElement(edited))
+	assert.NoError(t, pusher.SyncClient("", port))
+	assert.NoError(t, <-served)
+	assert.Equal(t, string(edited), hub.(Document).GetString())
+}
+
+// closeCounter counts how many times it is closed.
+type closeCounter int
+
+func (c *closeCounter) Close() error {
+	*c++
+	return nil
+}
+
+func TestRCDSSync_SnapshotSharesString(t *testing.T) {
+	doc := []byte(rand.String(32 * 1024))
+	hub, err := newRCDSSync([]RCDSOption{WithLevelNum(2)})
+	require.NoError(t, err)
+	var closed closeCounter
+	require.NoError(t, hub.setSource(bytes.NewReader(doc), int64(len(doc)), &closed))
+
+	// Snapshots share the partition tree of the hub until it is edited.
+	first, err := hub.Snapshot()
+	require.NoError(t, err)
+	second, err := hub.Snapshot()
+	require.NoError(t, err)
+	assert.Same(t, hub.tree, first.(*rcdsSync).tree)
+	assert.Same(t, hub.tree, second.(*rcdsSync).tree)
+
+	require.NoError(t, hub.AddElement([]byte("appended")))
+	assert.NotSame(t, hub.tree, first.(*rcdsSync).tree)
+	assert.Equal(t, string(doc)+"appended", hub.GetString())
+	assert.Equal(t, string(doc), first.(Document).GetString())
+	fresh, err := newPartitionTree(doc, hub.levels, hub.hasher)
+	require.NoError(t, err)
+	assert.Equal(t, fresh.rootHash(), first.(*rcdsSync).tree.rootHash())
+
+	// A session edits its own copy as well.
+	require.NoError(t, second.(Editor).DeleteRange(0, 100))
+	assert.Equal(t, string(doc), first.(Document).GetString())
+	assert.Equal(t, string(doc[100:]), second.(Document).GetString())
+
+	// The source is closed once the hub and every session sharing it are closed.
+	assert.NoError(t, hub.Close())
+	assert.NoError(t, first.(io.Closer).Close())
+	assert.Zero(t, closed)
+	assert.NoError(t, second.(io.Closer).Close())
+	assert.Equal(t, closeCounter(1), closed)
+
+	// The hub shares the string a session received, which it copies before its next edit.
+	hub, err = newRCDSSync([]RCDSOption{WithLevelNum(2)})
+	require.NoError(t, err)
+	require.NoError(t, hub.rebuildMetadata())
+	session, err := hub.Snapshot()
+	require.NoError(t, err)
+	s := session.(*rcdsSync)
+	s.setString(&receivedString{raw: doc, tree: fresh, received: set.New()})
+	require.NoError(t, hub.Apply(session))
+	assert.Same(t, s.tree, hub.tree)
+	require.NoError(t, hub.InsertAt(0, []byte("head")))
+	assert.Equal(t, "head"+string(doc), hub.GetString())
+	assert.Equal(t, string(doc), session.(Document).GetString())
+	assert.Equal(t, fresh.rootHash(), s.tree.rootHash())
+}
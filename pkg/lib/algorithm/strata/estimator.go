@@ -0,0 +1,204 @@
+package strata
+
+import (
+	"fmt"
+	"math/bits"
+
+	iblt "github.com/SheldonZhong/go-IBLT"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm"
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/util"
+)
+
+const (
+	defaultStrataNum = 32
+	defaultCellNum   = 80
+	// hashNum is the number of hash functions of each stratum IBLT.
+	hashNum = 3
+	// checksumLen is the length of the checksum each IBLT cell keeps to tell pure cells.
+	checksumLen = 4
+	// elemLen is the length of the element hash stored in the IBLT cells.
+	elemLen = 8
+)
+
+// Estimator estimates the size of the symmetric difference of two sets. Each element is hashed and assigned to the
+// stratum given by the number of trailing zeros of its hash, so that stratum i samples 1/2^(i+1) of the set. Every
+// stratum is a small IBLT and the difference is estimated by decoding the strata of two estimators from the sparsest
+// one until a stratum fails to decode.
+type Estimator struct {
+	strata []*iblt.Table
+	hasher algorithm.Hasher
+}
+
+type estimatorOptions struct {
+	strataNum int
+	cellNum   int
+	hasher    algorithm.Hasher
+}
+
+type EstimatorOption func(option *estimatorOptions)
+
+// WithStrataNum sets the number of strata, which bounds the estimate at about 2^strataNum.
+func WithStrataNum(strataNum int) EstimatorOption {
+	return func(option *estimatorOptions) {
+		option.strataNum = strataNum
+	}
+}
+
+// WithCellNum sets the number of cells of each stratum IBLT. More cells improve the accuracy of the estimate.
+func WithCellNum(cellNum int) EstimatorOption {
+	return func(option *estimatorOptions) {
+		option.cellNum = cellNum
+	}
+}
+
+// WithHasher sets the hash function assigning elements to strata. Estimators are only comparable if both peers use the
+// same hasher.
+func WithHasher(hasher algorithm.Hasher) EstimatorOption {
+	return func(option *estimatorOptions) {
+		option.hasher = hasher
+	}
+}
+
+func NewEstimator(option ...EstimatorOption) (*Estimator, error) {
+	opts := estimatorOptions{strataNum: defaultStrataNum, cellNum: defaultCellNum, hasher: algorithm.DefaultHasher}
+	for _, o := range option {
+		o(&opts)
+	}
+	if opts.strataNum < 1 || opts.strataNum > 64 {
+		return nil, fmt.Errorf("number of strata should be between 1 and 64 but got %d", opts.strataNum)
+	}
+	if opts.cellNum < hashNum {
+		return nil, fmt.Errorf("number of cells should be at least %d but got %d", hashNum, opts.cellNum)
+	}
+
+	e := &Estimator{strata: make([]*iblt.Table, opts.strataNum), hasher: opts.hasher}
+	for i := range e.strata {
+		e.strata[i] = iblt.NewTable(uint(opts.cellNum), elemLen, checksumLen, hashNum)
+	}
+	return e, nil
+}
+
+// Insert adds an element to the estimator.
+func (e *Estimator) Insert(elem []byte) error {
+	level, key, err := e.stratum(elem)
+	if err != nil {
+		return err
+	}
+	return e.strata[level].Insert(key)
+}
+
+// Delete removes an element from the estimator.
+func (e *Estimator) Delete(elem []byte) error {
+	level, key, err := e.stratum(elem)
+	if err != nil {
+		return err
+	}
+	return e.strata[level].Delete(key)
+}
+
+func (e *Estimator) stratum(elem []byte) (int, []byte, error) {
+	h, err := algorithm.HashString(string(elem)).ToUint64With(e.hasher)
+	if err != nil {
+		return 0, nil, err
+	}
+	level := bits.TrailingZeros64(h)
+	if level >= len(e.strata) {
+		level = len(e.strata) - 1
+	}
+	return level, util.Uint64ToBytes(h), nil
+}
+
+// Estimate returns the estimated size of the symmetric difference between the local and the remote set. Neither
+// estimator is modified.
+func (e *Estimator) Estimate(remote *Estimator) (int, error) {
+	if len(remote.strata) != len(e.strata) {
+		return 0, fmt.Errorf("estimators have %d and %d strata", len(e.strata), len(remote.strata))
+	}
+	count := 0
+	for i := len(e.strata) - 1; i >= 0; i-- {
+		t, err := copyTable(e.strata[i])
+		if err != nil {
+			return 0, err
+		}
+		r, err := copyTable(remote.strata[i])
+		if err != nil {
+			return 0, err
+		}
+		if err = t.Subtract(r); err != nil {
+			return 0, err
+		}
+		diff, err := t.Decode()
+		if err != nil {
+			// Strata 0 to i sample the rest of the difference, which is about 2^(i+1) times of the decoded count.
+			return count << uint(i+1), nil
+		}
+		count += diff.AlphaLen() + diff.BetaLen()
+	}
+	return count, nil
+}
+
+// copyTable returns a deep copy of the table. Table.Copy and Table.Subtract share the bucket checksums of the copied
+// table, which the self-destructive Decode then overwrites.
+func copyTable(t *iblt.Table) (*iblt.Table, error) {
+	b, err := t.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	return iblt.Deserialize(b)
+}
+
+// Serialize encodes the estimator to be sent to a remote peer in one message.
+func (e *Estimator) Serialize() ([]byte, error) {
+	b := util.IntToBytes(len(e.strata))
+	for _, s := range e.strata {
+		data, err := s.Serialize()
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, util.IntToBytes(len(data))...)
+		b = append(b, data...)
+	}
+	return b, nil
+}
+
+// Deserialize decodes an estimator encoded by Serialize. The decoded estimator is only meant to be passed to Estimate.
+func Deserialize(b []byte) (*Estimator, error) {
+	intLen := len(util.IntToBytes(0))
+	next := func(n int) ([]byte, error) {
+		if n < 0 || len(b) < n {
+			return nil, fmt.Errorf("encoded estimator is truncated")
+		}
+		res := b[:n]
+		b = b[n:]
+		return res, nil
+	}
+
+	buf, err := next(intLen)
+	if err != nil {
+		return nil, err
+	}
+	strataNum := util.BytesToInt(buf)
+	if strataNum < 1 || strataNum > 64 {
+		return nil, fmt.Errorf("encoded estimator has %d strata", strataNum)
+	}
+	e := &Estimator{strata: make([]*iblt.Table, strataNum)}
+	for i := range e.strata {
+		if buf, err = next(intLen); err != nil {
+			return nil, err
+		}
+		if buf, err = next(util.BytesToInt(buf)); err != nil {
+			return nil, err
+		}
+		if len(buf) < 8 {
+			return nil, fmt.Errorf("encoded stratum %d is truncated", i)
+		}
+		if e.strata[i], err = iblt.Deserialize(buf); err != nil {
+			return nil, err
+		}
+	}
+	if len(b) != 0 {
+		return nil, fmt.Errorf("encoded estimator has %d trailing bytes", len(b))
+	}
+	return e, nil
+}
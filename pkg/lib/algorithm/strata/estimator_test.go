@@ -0,0 +1,84 @@
+package strata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/rand"
+)
+
+func TestEstimator_Estimate(t *testing.T) {
+	rand.Seed(3)
+	for _, diff := range []int{0, 10, 100, 1000, 10000} {
+		local, err := NewEstimator()
+		require.NoError(t, err)
+		remote, err := NewEstimator()
+		require.NoError(t, err)
+
+		for i := 0; i < 2000; i++ {
+			e := []byte(rand.String(16))
+			require.NoError(t, local.Insert(e))
+			require.NoError(t, remote.Insert(e))
+		}
+		for i := 0; i < diff; i++ {
+			e := []byte(rand.String(16))
+			if i%2 == 0 {
+				require.NoError(t, local.Insert(e))
+			} else {
+				require.NoError(t, remote.Insert(e))
+			}
+		}
+
+		// The remote is sent in one message.
+		buf, err := remote.Serialize()
+		require.NoError(t, err)
+		received, err := Deserialize(buf)
+		require.NoError(t, err)
+
+		estimate, err := local.Estimate(received)
+		require.NoError(t, err)
+		t.Logf("estimated %d for a difference of %d", estimate, diff)
+		assert.GreaterOrEqual(t, estimate, diff/2)
+		assert.LessOrEqual(t, estimate, diff*2)
+
+		// Neither estimator is modified, so estimating again gives the same estimate.
+		again, err := local.Estimate(received)
+		require.NoError(t, err)
+		assert.Equal(t, estimate, again)
+	}
+}
+
+func TestEstimator_Delete(t *testing.T) {
+	local, err := NewEstimator(WithStrataNum(8), WithCellNum(16))
+	require.NoError(t, err)
+	remote, err := NewEstimator(WithStrataNum(8), WithCellNum(16))
+	require.NoError(t, err)
+
+	require.NoError(t, local.Insert([]byte("a")))
+	require.NoError(t, local.Insert([]byte("b")))
+	require.NoError(t, local.Delete([]byte("a")))
+	require.NoError(t, remote.Insert([]byte("b")))
+	estimate, err := local.Estimate(remote)
+	require.NoError(t, err)
+	assert.Equal(t, 0, estimate)
+
+	other, err := NewEstimator(WithStrataNum(4))
+	require.NoError(t, err)
+	_, err = local.Estimate(other)
+	assert.Error(t, err)
+}
+
+func TestDeserialize_Malformed(t *testing.T) {
+	e, err := NewEstimator(WithStrataNum(2))
+	require.NoError(t, err)
+	buf, err := e.Serialize()
+	require.NoError(t, err)
+
+	_, err = Deserialize(buf[:len(buf)-1])
+	assert.Error(t, err)
+	_, err = Deserialize(append(buf, 0))
+	assert.Error(t, err)
+	_, err = NewEstimator(WithStrataNum(0))
+	assert.Error(t, err)
+}
@@ -0,0 +1,118 @@
+package genSync
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// Compression is a stream compression of connections, offered in the handshake of a sync.
+type Compression string
+
+const (
+	CompressionFlate Compression = "flate"
+	CompressionGzip  Compression = "gzip"
+)
+
+// WithCompression offers the compressions in the handshake of every sync over the connection, in order of preference.
+// The server picks the first compression the client offers that it offers as well, and both peers compress every
+// payload after the handshake with it. Without a common compression the payloads are sent as they are.
+func WithCompression(compression ...Compression) ConnectionOption {
+	return func(option *connectionOptions) {
+		option.compressions = compression
+	}
+}
+
+func (c Compression) validate() error {
+	switch c {
+	case CompressionFlate, CompressionGzip:
+		return nil
+	}
+	return fmt.Errorf("unknown compression '%s'", c)
+}
+
+// compressor is implemented by connections that compress payloads once the handshake picks a compression.
+type compressor interface {
+	offeredCompressions() []Compression
+	startCompression(compression Compression) error
+}
+
+// pickCompression returns the first compression of the client the server offers as well, if any.
+func pickCompression(client, server []Compression) (Compression, bool) {
+	for _, c := range client {
+		for _, s := range server {
+			if c == s {
+				return c, true
+			}
+		}
+	}
+	return "", false
+}
+
+// flushWriter compresses a stream that is flushed after every frame, so the remote can decompress it right away.
+type flushWriter interface {
+	io.Writer
+	Flush() error
+}
+
+func newCompressWriter(compression Compression, w io.Writer) (flushWriter, error) {
+	switch compression {
+	case CompressionFlate:
+		return flate.NewWriter(w, flate.DefaultCompression)
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	}
+	return nil, fmt.Errorf("unknown compression '%s'", compression)
+}
+
+// decompressReader opens the decompressor on the first read, since a gzip reader reads the header of the stream as
+// soon as it is opened.
+type decompressReader struct {
+	compression Compression
+	wire        io.Reader
+	r           io.Reader
+}
+
+func (d *decompressReader) Read(p []byte) (int, error) {
+	if d.r == nil {
+		switch d.compression {
+		case CompressionFlate:
+			d.r = flate.NewReader(d.wire)
+		case CompressionGzip:
+			r, err := gzip.NewReader(d.wire)
+			if err != nil {
+				return 0, err
+			}
+			d.r = r
+		default:
+			return 0, fmt.Errorf("unknown compression '%s'", d.compression)
+		}
+	}
+	return d.r.Read(p)
+}
+
+// countingWriter counts the bytes actually written, including those of a failed write.
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// countingReader counts the bytes actually read, including those of a failed read.
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
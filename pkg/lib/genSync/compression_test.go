@@ -0,0 +1,94 @@
+package genSync
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm"
+)
+
+func TestCompression(t *testing.T) {
+	tests := []struct {
+		name       string
+		client     []Compression
+		server     []Compression
+		compressed bool
+	}{
+		{
+			name:       "flate",
+			client:     []Compression{CompressionFlate},
+			server:     []Compression{CompressionGzip, CompressionFlate},
+			compressed: true,
+		},
+		{
+			name:       "gzip",
+			client:     []Compression{CompressionGzip, CompressionFlate},
+			server:     []Compression{CompressionFlate, CompressionGzip},
+			compressed: true,
+		},
+		{
+			name:   "no common compression",
+			client: []Compression{CompressionGzip},
+			server: []Compression{CompressionFlate},
+		},
+		{
+			name:   "server does not compress",
+			client: []Compression{CompressionGzip},
+		},
+	}
+	handshake, err := NewHandshake(algorithm.FullSync, algorithm.DefaultHasher, nil)
+	require.NoError(t, err)
+	payload := bytes.Repeat([]byte("compressible text "), 1000)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientPipe, serverPipe := net.Pipe()
+			client, err := NewConnection(clientPipe, WithCompression(tt.client...))
+			require.NoError(t, err)
+			server, err := NewConnection(serverPipe, WithCompression(tt.server...))
+			require.NoError(t, err)
+			defer client.Close()
+			defer server.Close()
+
+			served := make(chan error)
+			go func() {
+				if err := HandshakeServer(server, handshake); err != nil {
+					served <- err
+					return
+				}
+				received, err := server.Receive()
+				if err == nil {
+					_, err = server.Send(received)
+				}
+				served <- err
+			}()
+			require.NoError(t, HandshakeClient(client, handshake))
+			sent, received := client.GetSentBytes(), client.GetReceivedBytes()
+			_, err = client.Send(payload)
+			require.NoError(t, err)
+			echo, err := client.Receive()
+			require.NoError(t, err)
+			require.NoError(t, <-served)
+			assert.Equal(t, payload, echo)
+
+			// The logical bytes are the frames either way, while the wire only carries fewer bytes if compressed.
+			logical := len(payload) + frameHeaderSize
+			assert.Equal(t, client.GetLogicalSentBytes()-client.GetLogicalReceivedBytes(), server.GetLogicalReceivedBytes()-server.GetLogicalSentBytes())
+			if tt.compressed {
+				assert.Less(t, client.GetSentBytes()-sent, logical/10)
+				assert.Less(t, client.GetReceivedBytes()-received, logical/10)
+				assert.Equal(t, client.GetSentBytes(), server.GetReceivedBytes())
+			} else {
+				assert.Equal(t, logical, client.GetSentBytes()-sent)
+				assert.Equal(t, logical, client.GetReceivedBytes()-received)
+			}
+		})
+	}
+
+	_, err = NewTcpConnection("", 8080, WithCompression("lz4"))
+	assert.Error(t, err)
+}
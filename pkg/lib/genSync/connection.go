@@ -1,21 +1,34 @@
 package genSync
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/util"
 	"github.com/sirupsen/logrus"
 	"io"
 	"k8s.io/client-go/util/retry"
 	"net"
+	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 type Connection interface {
 	Listen() error
+	ListenContext(ctx context.Context) error
 	Connect() error
+	ConnectContext(ctx context.Context) error
 	Send(data []byte) (int, error)
+	SendContext(ctx context.Context, data []byte) (int, error)
 	Receive() ([]byte, error)
+	ReceiveContext(ctx context.Context) ([]byte, error)
+	// WatchContext bounds every operation on the connection by the deadline of the context and closes the connection
+	// once the context is done, until the returned function is called.
+	WatchContext(ctx context.Context) (stop func())
 	SendBytesSlice(dataSlice [][]byte) (int, error)
 	ReceiveBytesSlice() ([][]byte, error)
 	SendSkipSyncBoolWithInfo(skipSync bool, format string, args ...interface{}) error
@@ -25,23 +38,47 @@ type Connection interface {
 	Close() error
 	GetIp() string
 	GetPort() string
+	// GetSentBytes and GetReceivedBytes count the bytes on the wire, which are fewer than the logical bytes of the
+	// frames once a compression is picked.
 	GetSentBytes() int
 	GetReceivedBytes() int
 	GetTotalBytes() int
+	GetLogicalSentBytes() int
+	GetLogicalReceivedBytes() int
 }
 
 type socketConnection struct {
-	tcpAddress    *net.TCPAddr
-	listener      *net.TCPListener
-	connection    *net.TCPConn
-	sentBytes     int
-	receivedBytes int
+	host       string
+	tcpAddress *net.TCPAddr
+	listener   *net.TCPListener
+	connection net.Conn
+	options    connectionOptions
+	// sentBytes and receivedBytes count the bytes actually written to and read from the connection, and
+	// logicalSentBytes and logicalReceivedBytes the frames before compression. They can be read while a sync runs.
+	sentBytes            atomic.Int64
+	receivedBytes        atomic.Int64
+	logicalSentBytes     atomic.Int64
+	logicalReceivedBytes atomic.Int64
+	// compression is picked by the handshake, after which frames are written to compressor and read from
+	// decompressor.
+	compression  Compression
+	compressor   flushWriter
+	decompressor io.Reader
+	// established is set for connections created from an established one, which cannot connect or listen.
+	established bool
 }
 
 // Original TCP buffer size for slower networks.
 const bufferSize int = 65535
 
-func NewTcpConnection(ipAddr string, port int) (Connection, error) {
+// NewTcpConnection creates a connection to the address, which receives payloads and slices up to the limits set by the
+// options and is encrypted if WithTLS is given.
+func NewTcpConnection(ipAddr string, port int, option ...ConnectionOption) (Connection, error) {
+	opt := connectionOptions{}
+	opt.apply(option)
+	if err := opt.complete(); err != nil {
+		return nil, err
+	}
 	if ipAddr == "" {
 		ipAddr = "localhost"
 	}
@@ -50,36 +87,190 @@ func NewTcpConnection(ipAddr string, port int) (Connection, error) {
 		return nil, err
 	}
 	return &socketConnection{
+		host:       ipAddr,
 		tcpAddress: addr,
+		options:    opt,
 	}, nil
 }
 
+// NewConnection frames payloads over an established connection, such as a Unix socket, an in-memory pipe or a TLS
+// connection, which is closed by Close. Connect and Listen fail as the connection is already established, and WithTLS
+// is refused since the side of the handshake is unknown.
+func NewConnection(conn net.Conn, option ...ConnectionOption) (Connection, error) {
+	opt := connectionOptions{}
+	opt.apply(option)
+	if err := opt.complete(); err != nil {
+		return nil, err
+	}
+	if opt.tlsConfig != nil {
+		return nil, fmt.Errorf("wrap the connection with tls.Client or tls.Server instead of passing WithTLS")
+	}
+	addr, _ := conn.RemoteAddr().(*net.TCPAddr)
+	return &socketConnection{tcpAddress: addr, connection: conn, options: opt, established: true}, nil
+}
+
+// NewReadWriterConnection frames payloads over a stream, such as a stream of an existing RPC, like NewConnection does.
+// The stream is closed by Close if it is an io.Closer, which is also how a done context interrupts a sync over it, as
+// streams have no deadlines.
+func NewReadWriterConnection(rw io.ReadWriter, option ...ConnectionOption) (Connection, error) {
+	return NewConnection(&streamConn{ReadWriter: rw}, option...)
+}
+
+// streamConn adapts a stream to net.Conn.
+type streamConn struct {
+	io.ReadWriter
+}
+
+func (c *streamConn) Close() error {
+	if closer, ok := c.ReadWriter.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (c *streamConn) LocalAddr() net.Addr                { return streamAddr{} }
+func (c *streamConn) RemoteAddr() net.Addr               { return streamAddr{} }
+func (c *streamConn) SetDeadline(t time.Time) error      { return os.ErrNoDeadline }
+func (c *streamConn) SetReadDeadline(t time.Time) error  { return os.ErrNoDeadline }
+func (c *streamConn) SetWriteDeadline(t time.Time) error { return os.ErrNoDeadline }
+
+type streamAddr struct{}
+
+func (streamAddr) Network() string { return "stream" }
+func (streamAddr) String() string  { return "stream" }
+
+// errEstablished is returned by Connect and Listen of a connection created from an established one.
+var errEstablished = errors.New("connection is already established")
+
 // Connect tires to connect with server and fails upon several retries.
 func (s *socketConnection) Connect() error {
-	var err error
+	return s.ConnectContext(context.Background())
+}
+
+// ConnectContext tries to connect with server and fails upon several retries or once the context is done.
+func (s *socketConnection) ConnectContext(ctx context.Context) error {
+	if s.established {
+		return errEstablished
+	}
 	logrus.Infof("connecting to: %v", s.tcpAddress)
-	return retry.OnError(retry.DefaultBackoff, func(err error) bool {
-		return err != nil
-	}, func() error {
-		s.connection, err = net.DialTCP("tcp", nil, s.tcpAddress)
+	var dialer net.Dialer
+	backoff := retry.DefaultBackoff
+	for attempt := 1; ; attempt++ {
+		conn, err := dialer.DialContext(ctx, "tcp", s.tcpAddress.String())
+		if err == nil {
+			if err = s.setConnection(conn.(*net.TCPConn), false); err != nil {
+				return err
+			}
+			return s.handshake(ctx)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if attempt >= retry.DefaultBackoff.Steps {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff.Step()):
+		}
+	}
+}
+
+// setConnection sets up the socket of an established connection, which is wrapped in TLS if the connection is
+// configured for it.
+func (s *socketConnection) setConnection(conn *net.TCPConn, isServer bool) error {
+	s.connection = conn
+	if err := conn.SetReadBuffer(bufferSize); err != nil {
 		return err
-	})
+	}
+	if err := conn.SetWriteBuffer(bufferSize); err != nil {
+		return err
+	}
+	if s.options.tlsConfig == nil {
+		return nil
+	}
+	if isServer {
+		s.connection = tls.Server(conn, s.options.tlsConfig)
+		return nil
+	}
+	config := s.options.tlsConfig
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName = s.host
+	}
+	s.connection = tls.Client(conn, config)
+	return nil
 }
 
-func (s *socketConnection) Send(data []byte) (int, error) {
-	if err := s.connection.SetWriteBuffer(bufferSize); err != nil {
-		return 0, err
+// handshake runs the TLS handshake of the connection right away, so that certificate errors surface before the sync
+// starts. The connection is closed if the handshake fails.
+func (s *socketConnection) handshake(ctx context.Context) error {
+	conn, ok := s.connection.(*tls.Conn)
+	if !ok {
+		return nil
 	}
-	dataSize := util.Int64ToBytes(int64(len(data)))
-	_, err := s.connection.Write(dataSize)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return contextError(ctx, fmt.Errorf("TLS handshake failed: %w", err))
+	}
+	return nil
+}
+
+func (s *socketConnection) Send(data []byte) (int, error) {
+	n, err := s.writeFrame(data)
 	if err != nil {
+		return n, err
+	}
+	return n, s.flush()
+}
+
+// writeFrame writes a frame, which is only buffered by the compressor if there is one, so the frames of a slice are
+// compressed together.
+func (s *socketConnection) writeFrame(data []byte) (int, error) {
+	w := s.frameWriter()
+	if _, err := w.Write(util.Int64ToBytes(int64(len(data)))); err != nil {
 		return 0, err
 	}
-	s.sentBytes += len(data) + 8
-	return s.connection.Write(data)
+	return w.Write(data)
+}
+
+// flush sends the frames buffered by the compressor.
+func (s *socketConnection) flush() error {
+	if s.compressor == nil {
+		return nil
+	}
+	return s.compressor.Flush()
 }
 
+// frameWriter counts the logical bytes of frames above the compressor, if any, and the wire bytes below it.
+func (s *socketConnection) frameWriter() io.Writer {
+	var w io.Writer = &countingWriter{w: s.connection, n: &s.sentBytes}
+	if s.compressor != nil {
+		w = s.compressor
+	}
+	return &countingWriter{w: w, n: &s.logicalSentBytes}
+}
+
+// frameReader counts the logical bytes of frames above the decompressor, if any, and the wire bytes below it.
+func (s *socketConnection) frameReader() io.Reader {
+	var r io.Reader = &countingReader{r: s.connection, n: &s.receivedBytes}
+	if s.decompressor != nil {
+		r = s.decompressor
+	}
+	return &countingReader{r: r, n: &s.logicalReceivedBytes}
+}
+
+// Listen waits for a client on the address and accepts exactly one connection.
 func (s *socketConnection) Listen() error {
+	return s.ListenContext(context.Background())
+}
+
+// ListenContext waits for a client on the address and accepts exactly one connection, unless the context is done first.
+func (s *socketConnection) ListenContext(ctx context.Context) error {
+	if s.established {
+		return errEstablished
+	}
 	var err error
 	s.listener, err = net.ListenTCP("tcp", s.tcpAddress)
 	logrus.Infof("listening on: %v", s.tcpAddress)
@@ -87,65 +278,199 @@ func (s *socketConnection) Listen() error {
 		return fmt.Errorf("failed to listen: %v", err)
 	}
 
-	s.connection, err = s.listener.AcceptTCP()
+	// Closing the listener unblocks the accept.
+	stop := context.AfterFunc(ctx, func() {
+		s.listener.Close()
+	})
+	conn, err := s.listener.AcceptTCP()
+	stop()
+	// Only one connection is served, so stop accepting right away rather than letting a later dial to the same port
+	// queue up on this listener.
+	if closeErr := s.listener.Close(); closeErr != nil {
+		logrus.Debugf("failed to close listener, %v", closeErr)
+	}
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	if err = s.setConnection(conn, true); err != nil {
+		return err
+	}
+	return s.handshake(ctx)
+}
+
+// SendContext sends the data unless the context is done first, in which case the connection is closed.
+func (s *socketConnection) SendContext(ctx context.Context, data []byte) (int, error) {
+	defer s.WatchContext(ctx)()
+	n, err := s.Send(data)
+	return n, contextError(ctx, err)
+}
+
+// ReceiveContext receives the next payload unless the context is done first, in which case the connection is closed.
+func (s *socketConnection) ReceiveContext(ctx context.Context) ([]byte, error) {
+	defer s.WatchContext(ctx)()
+	data, err := s.Receive()
+	return data, contextError(ctx, err)
+}
+
+func (s *socketConnection) WatchContext(ctx context.Context) (stop func()) {
+	closeConnection := func() {
+		if err := s.connection.Close(); err != nil {
+			logrus.Debugf("failed to close connection, %v", err)
+		}
+	}
+	deadline, hasDeadline := ctx.Deadline()
+	if hasDeadline {
+		if err := s.connection.SetDeadline(deadline); err != nil {
+			logrus.Debugf("failed to set connection deadline, %v", err)
+		}
+	}
+	stopClose := context.AfterFunc(ctx, closeConnection)
+	return func() {
+		if !stopClose() {
+			return
+		}
+		// The socket deadline can expire just before the context notices its own deadline, and a frame might have
+		// been cut short either way.
+		if hasDeadline && !time.Now().Before(deadline) {
+			closeConnection()
+			return
+		}
+		if err := s.connection.SetDeadline(time.Time{}); err != nil {
+			logrus.Debugf("failed to clear connection deadline, %v", err)
+		}
+	}
+}
+
+// RunContext runs the sync over the connection, which is closed if the context is done before the sync returns. The
+// error of the context is returned if it interrupted the sync.
+func RunContext(ctx context.Context, conn Connection, sync func(conn Connection) error) error {
+	stop := conn.WatchContext(ctx)
+	err := sync(conn)
+	stop()
+	return contextError(ctx, err)
+}
+
+// contextError returns the error of the context instead of the error of an operation that the context interrupted.
+// The socket deadline can expire just before the context notices its own deadline.
+func contextError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if _, ok := ctx.Deadline(); ok && errors.Is(err, os.ErrDeadlineExceeded) {
+		return context.DeadlineExceeded
+	}
 	return err
 }
 
-func (s *socketConnection) Receive() ([]byte, error) {
-	if err := s.connection.SetReadBuffer(bufferSize); err != nil {
+// Listener accepts connections on an address until it is closed.
+type Listener interface {
+	Accept() (Connection, error)
+	Close() error
+	Addr() net.Addr
+}
+
+type tcpListener struct {
+	listener *net.TCPListener
+	options  connectionOptions
+}
+
+// NewTcpListener listens on the address for any number of clients, whose connections are created with the options.
+func NewTcpListener(ipAddr string, port int, option ...ConnectionOption) (Listener, error) {
+	opt := connectionOptions{}
+	opt.apply(option)
+	if err := opt.complete(); err != nil {
 		return nil, err
 	}
-	size := make([]byte, 8)
-	_, err := io.ReadFull(s.connection, size)
+	if ipAddr == "" {
+		ipAddr = "localhost"
+	}
+	addr, err := net.ResolveTCPAddr("tcp", strings.Join([]string{ipAddr, strconv.Itoa(port)}, ":"))
 	if err != nil {
 		return nil, err
 	}
-	s.receivedBytes += 8
+	listener, err := net.ListenTCP("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %v", err)
+	}
+	logrus.Infof("listening on: %v", addr)
+	return &tcpListener{listener: listener, options: opt}, nil
+}
 
-	sizeInt := int(util.BytesToInt64(size))
-	if sizeInt < 0 {
-		return nil, fmt.Errorf("received invalid negative payload size: %d", sizeInt)
+// Accept waits for the next client and returns its connection.
+func (l *tcpListener) Accept() (Connection, error) {
+	conn, err := l.listener.AcceptTCP()
+	if err != nil {
+		return nil, err
+	}
+	addr, _ := conn.RemoteAddr().(*net.TCPAddr)
+	// The TLS handshake of the client runs on its first read or write, so that a slow client does not hold up the
+	// others.
+	s := &socketConnection{tcpAddress: addr, options: l.options}
+	if err = s.setConnection(conn, true); err != nil {
+		conn.Close()
+		return nil, err
 	}
-	res := make([]byte, sizeInt)
+	return s, nil
+}
 
-	if sizeInt > 0 {
-		if _, err := io.ReadFull(s.connection, res); err != nil {
-			return nil, err
+func (l *tcpListener) Close() error {
+	return l.listener.Close()
+}
+
+func (l *tcpListener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// Receive receives the next payload, failing with a FrameLimitError if the remote announces one larger than the limit.
+func (s *socketConnection) Receive() ([]byte, error) {
+	return readFrame(s.frameReader(), s.options.maxFrameSize)
+}
+
+func (s *socketConnection) offeredCompressions() []Compression {
+	return s.options.compressions
+}
+
+// startCompression compresses every frame after the handshake. Handshakes of nested syncs over the connection pick
+// the same compression again.
+func (s *socketConnection) startCompression(compression Compression) error {
+	if s.compression != "" {
+		if compression != s.compression {
+			return fmt.Errorf("connection is already compressed with %s", s.compression)
 		}
+		return nil
 	}
-	s.receivedBytes += len(res)
-
-	return res, err
+	compressor, err := newCompressWriter(compression, &countingWriter{w: s.connection, n: &s.sentBytes})
+	if err != nil {
+		return err
+	}
+	s.compression = compression
+	s.compressor = compressor
+	s.decompressor = &decompressReader{compression: compression, wire: &countingReader{r: s.connection, n: &s.receivedBytes}}
+	return nil
 }
 
 func (s *socketConnection) SendBytesSlice(dataSlice [][]byte) (int, error) {
-	if _, err := s.Send(util.IntToBytes(len(dataSlice))); err != nil {
+	if _, err := s.writeFrame(util.IntToBytes(len(dataSlice))); err != nil {
 		return 0, err
 	}
 	for _, d := range dataSlice {
-		if _, err := s.Send(d); err != nil {
+		if _, err := s.writeFrame(d); err != nil {
 			return 0, err
 		}
 	}
+	if err := s.flush(); err != nil {
+		return 0, err
+	}
 	return len(dataSlice), nil
 }
 
+// ReceiveBytesSlice receives a slice of payloads, failing with a FrameLimitError if the remote announces more payloads
+// than the limit.
 func (s *socketConnection) ReceiveBytesSlice() ([][]byte, error) {
-	setSize, err := s.Receive()
-	if err != nil {
-		return nil, err
-	}
-	ss := util.BytesToInt(setSize)
-	res := make([][]byte, ss)
-
-	for j := 0; j < ss; j++ {
-		d, err := s.Receive()
-		if err != nil {
-			return nil, err
-		}
-		res[j] = d
-	}
-	return res, nil
+	return receiveBytesSlice(s.Receive, s.options.maxSliceLen)
 }
 
 // SendSkipSyncWithInfo sends skip or continue sync. If true, signals skip sync else continue.
@@ -197,28 +522,47 @@ func (s *socketConnection) ReceiveSyncStatus() (uint8, error) {
 }
 
 func (s *socketConnection) Close() error {
+	if s.established {
+		return s.connection.Close()
+	}
 	if err := s.listener.Close(); err != nil {
 		logrus.Debugf("failed to close listener, %v", err)
 	}
 	return s.connection.Close()
 }
 
+// GetIp returns the IP of the address, which is empty for connections other than TCP.
 func (s *socketConnection) GetIp() string {
+	if s.tcpAddress == nil {
+		return ""
+	}
 	return s.tcpAddress.IP.String()
 }
 
+// GetPort returns the port of the address, which is empty for connections other than TCP.
 func (s *socketConnection) GetPort() string {
+	if s.tcpAddress == nil {
+		return ""
+	}
 	return strconv.Itoa(s.tcpAddress.Port)
 }
 
 func (s *socketConnection) GetSentBytes() int {
-	return s.sentBytes
+	return int(s.sentBytes.Load())
 }
 
 func (s *socketConnection) GetReceivedBytes() int {
-	return s.receivedBytes
+	return int(s.receivedBytes.Load())
+}
+
+func (s *socketConnection) GetLogicalSentBytes() int {
+	return int(s.logicalSentBytes.Load())
+}
+
+func (s *socketConnection) GetLogicalReceivedBytes() int {
+	return int(s.logicalReceivedBytes.Load())
 }
 
 func (s *socketConnection) GetTotalBytes() int {
-	return s.receivedBytes + s.sentBytes
+	return s.GetReceivedBytes() + s.GetSentBytes()
 }
@@ -1,6 +1,10 @@
 package genSync
 
 import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
 	"sync"
 	"testing"
 	"time"
@@ -82,3 +86,70 @@ func TestNewTcpConnection(t *testing.T) {
 	t.Log("Communicating for the Second time")
 	ClientServertest([]byte(rand.String(512)))
 }
+
+func TestConnectionContext(t *testing.T) {
+	testPort := 9000 + rand.IntnRange(1000, 9000)
+
+	// Listening gives up once the context is canceled.
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	testServer, err := NewTcpConnection("", testPort)
+	require.NoError(t, err)
+	assert.ErrorIs(t, testServer.ListenContext(ctx), context.Canceled)
+
+	// A peer that never sends cannot block a receive beyond the deadline.
+	testClient, err := NewTcpConnection("", testPort)
+	require.NoError(t, err)
+	listened := make(chan error)
+	go func() {
+		listened <- testServer.Listen()
+	}()
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, testClient.ConnectContext(context.Background()))
+	require.NoError(t, <-listened)
+	defer testServer.Close()
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = testClient.ReceiveContext(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	// The connection is closed once the context is done.
+	_, err = testClient.Send([]byte("closed"))
+	assert.Error(t, err)
+}
+
+func TestNewConnection(t *testing.T) {
+	clientPipe, serverPipe := net.Pipe()
+	client, err := NewConnection(clientPipe)
+	require.NoError(t, err)
+	// A stream is framed the same way, whether or not it is a net.Conn.
+	server, err := NewReadWriterConnection(struct{ io.ReadWriteCloser }{serverPipe})
+	require.NoError(t, err)
+
+	assert.Error(t, client.Connect())
+	assert.Error(t, server.Listen())
+	assert.Empty(t, client.GetIp())
+
+	data := []byte(rand.String(2000))
+	go func() {
+		_, err := client.Send(data)
+		assert.NoError(t, err)
+	}()
+	received, err := server.Receive()
+	require.NoError(t, err)
+	assert.Equal(t, data, received)
+
+	// A done context interrupts a stream without deadlines by closing it.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = server.ReceiveContext(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = client.Send(data)
+	assert.Error(t, err)
+
+	_, err = NewConnection(clientPipe, WithTLS(&tls.Config{}))
+	assert.Error(t, err)
+}
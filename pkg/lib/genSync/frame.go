@@ -0,0 +1,148 @@
+package genSync
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/util"
+)
+
+const (
+	// DefaultMaxFrameSize is the largest payload a connection receives unless set by WithMaxFrameSize.
+	DefaultMaxFrameSize = 1 << 30
+	// DefaultMaxSliceLen is the largest number of payloads a connection receives as a slice unless set by
+	// WithMaxSliceLen.
+	DefaultMaxSliceLen = 1 << 24
+
+	// frameHeaderSize is the size of the length prefix of every frame.
+	frameHeaderSize = 8
+	// preallocatedFrameSize is the largest payload allocated in full before it arrives. Larger payloads grow as they
+	// are read, so a peer announcing a large frame has to send it before the memory is allocated.
+	preallocatedFrameSize = 1 << 20
+)
+
+// FrameLimitError is returned when the remote announces a payload or a slice larger than the limits of the connection.
+// The connection cannot be used after it.
+type FrameLimitError struct {
+	// Slice is set if the number of payloads of a slice exceeds the limit rather than the size of a payload.
+	Slice bool
+	Size  int64
+	Limit int
+}
+
+func (e *FrameLimitError) Error() string {
+	if e.Slice {
+		return fmt.Sprintf("received slice of %d payloads exceeds the limit of %d", e.Size, e.Limit)
+	}
+	return fmt.Sprintf("received payload of %d bytes exceeds the limit of %d bytes", e.Size, e.Limit)
+}
+
+type connectionOptions struct {
+	maxFrameSize int         // largest payload received. (default at DefaultMaxFrameSize)
+	maxSliceLen  int         // largest number of payloads received as a slice. (default at DefaultMaxSliceLen)
+	tlsConfig    *tls.Config // encrypts the connection if set. (default at plaintext)
+	// compressions are offered in the handshake of a sync in order of preference. (default at none)
+	compressions []Compression
+}
+
+func (c *connectionOptions) apply(options []ConnectionOption) {
+	for _, option := range options {
+		option(c)
+	}
+}
+
+func (c *connectionOptions) complete() error {
+	if c.maxFrameSize == 0 {
+		c.maxFrameSize = DefaultMaxFrameSize
+	}
+	if c.maxSliceLen == 0 {
+		c.maxSliceLen = DefaultMaxSliceLen
+	}
+	if c.maxFrameSize < 0 || c.maxSliceLen < 0 {
+		return fmt.Errorf("frame limits should not be negative")
+	}
+	for _, compression := range c.compressions {
+		if err := compression.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type ConnectionOption func(option *connectionOptions)
+
+// WithMaxFrameSize sets the largest payload in bytes the connection receives.
+func WithMaxFrameSize(n int) ConnectionOption {
+	return func(option *connectionOptions) {
+		option.maxFrameSize = n
+	}
+}
+
+// WithMaxSliceLen sets the largest number of payloads the connection receives as a slice.
+func WithMaxSliceLen(n int) ConnectionOption {
+	return func(option *connectionOptions) {
+		option.maxSliceLen = n
+	}
+}
+
+// readFrame reads a length prefixed payload of at most maxSize bytes.
+func readFrame(r io.Reader, maxSize int) ([]byte, error) {
+	header := make([]byte, frameHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	size := util.BytesToInt64(header)
+	if size < 0 {
+		return nil, fmt.Errorf("received invalid negative payload size: %d", size)
+	}
+	if size > int64(maxSize) {
+		return nil, &FrameLimitError{Size: size, Limit: maxSize}
+	}
+
+	if size <= preallocatedFrameSize {
+		res := make([]byte, size)
+		if _, err := io.ReadFull(r, res); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, size); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// receiveBytesSlice receives the number of payloads of a slice, at most maxLen, followed by the payloads.
+func receiveBytesSlice(receive func() ([]byte, error), maxLen int) ([][]byte, error) {
+	setSize, err := receive()
+	if err != nil {
+		return nil, err
+	}
+	if len(setSize) != len(util.IntToBytes(0)) {
+		return nil, fmt.Errorf("received invalid slice length of %d bytes", len(setSize))
+	}
+	ss := util.BytesToInt(setSize)
+	if ss < 0 {
+		return nil, fmt.Errorf("received invalid negative slice length: %d", ss)
+	}
+	if ss > maxLen {
+		return nil, &FrameLimitError{Slice: true, Size: int64(ss), Limit: maxLen}
+	}
+
+	// Grow the slice as payloads arrive rather than trusting the announced length.
+	res := make([][]byte, 0, min(ss, 1024))
+	for j := 0; j < ss; j++ {
+		d, err := receive()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, d)
+	}
+	return res, nil
+}
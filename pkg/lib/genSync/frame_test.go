@@ -0,0 +1,96 @@
+package genSync
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/rand"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/util"
+)
+
+func frame(data []byte) []byte {
+	return append(util.Int64ToBytes(int64(len(data))), data...)
+}
+
+func TestFrameLimits(t *testing.T) {
+	testPort := 9000 + rand.IntnRange(1000, 9000)
+	testServer, err := NewTcpConnection("", testPort, WithMaxFrameSize(16), WithMaxSliceLen(2))
+	require.NoError(t, err)
+	testClient, err := NewTcpConnection("", testPort)
+	require.NoError(t, err)
+
+	_, err = NewTcpConnection("", testPort, WithMaxFrameSize(-1))
+	assert.Error(t, err)
+
+	listened := make(chan error)
+	go func() {
+		listened <- testServer.Listen()
+	}()
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, testClient.Connect())
+	require.NoError(t, <-listened)
+	defer testServer.Close()
+	defer testClient.Close()
+
+	_, err = testClient.SendBytesSlice([][]byte{[]byte("a"), []byte("b"), []byte("c")})
+	require.NoError(t, err)
+	_, err = testServer.ReceiveBytesSlice()
+	var limitErr *FrameLimitError
+	require.True(t, errors.As(err, &limitErr))
+	assert.True(t, limitErr.Slice)
+	assert.EqualValues(t, 3, limitErr.Size)
+
+	// The slice above is left unread, so receive from a fresh frame reader instead.
+	_, err = readFrame(bytes.NewReader(frame(make([]byte, 17))), 16)
+	require.True(t, errors.As(err, &limitErr))
+	assert.False(t, limitErr.Slice)
+	assert.EqualValues(t, 17, limitErr.Size)
+	assert.Equal(t, 16, limitErr.Limit)
+
+	// A peer announcing a huge frame is refused before anything is allocated.
+	_, err = readFrame(bytes.NewReader(util.Int64ToBytes(1<<60)), DefaultMaxFrameSize)
+	assert.True(t, errors.As(err, &limitErr))
+}
+
+func FuzzReadFrame(f *testing.F) {
+	f.Add(frame([]byte("payload")))
+	f.Add(frame(nil))
+	f.Add(util.Int64ToBytes(-1))
+	f.Add(util.Int64ToBytes(1 << 40))
+	f.Add(append(util.Int64ToBytes(preallocatedFrameSize+1), 'x'))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		const maxSize = 2 * preallocatedFrameSize
+		data, err := readFrame(bytes.NewReader(b), maxSize)
+		if err != nil {
+			return
+		}
+		assert.LessOrEqual(t, len(data), maxSize)
+		assert.Equal(t, b[frameHeaderSize:frameHeaderSize+len(data)], data)
+	})
+}
+
+func FuzzReceiveBytesSlice(f *testing.F) {
+	slice := frame(util.IntToBytes(2))
+	slice = append(slice, frame([]byte("a"))...)
+	slice = append(slice, frame([]byte("bc"))...)
+	f.Add(slice)
+	f.Add(frame(util.IntToBytes(1 << 40)))
+	f.Add(frame(util.IntToBytes(-3)))
+	f.Add(frame([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9}))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		const maxLen = 64
+		r := bytes.NewReader(b)
+		res, err := receiveBytesSlice(func() ([]byte, error) {
+			return readFrame(r, 1024)
+		}, maxLen)
+		if err != nil {
+			return
+		}
+		assert.LessOrEqual(t, len(res), maxLen)
+	})
+}
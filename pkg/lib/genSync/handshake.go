@@ -0,0 +1,146 @@
+package genSync
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm"
+)
+
+// ProtocolVersion is the version of the wire protocol, exchanged in the handshake that opens every sync.
+const ProtocolVersion = 1
+
+var (
+	// ErrHandshakeMismatch is returned on both peers when they speak different protocol versions, run different
+	// algorithms or run an algorithm with different parameters.
+	ErrHandshakeMismatch = errors.New("peers do not agree on the sync")
+	// ErrHasherMismatch is returned on both peers when they hash with different functions or keys, in which case their
+	// digests and hashed elements cannot be compared.
+	ErrHasherMismatch = errors.New("peers use different hash functions")
+)
+
+// Handshake describes the sync a peer runs. Both peers exchange it before anything else and refuse to sync unless
+// they agree on every field but the compression.
+type Handshake struct {
+	Version    int
+	SyncType   algorithm.SyncType
+	Hasher     string
+	Parameters json.RawMessage `json:",omitempty"`
+	// Compression lists the compressions the client offers, and the one the server picks from them. It is filled in
+	// from the options of the connection.
+	Compression []Compression `json:",omitempty"`
+}
+
+// NewHandshake describes a sync of the current protocol version, whose parameters are encoded as JSON. Parameters are
+// nil for algorithms without any.
+func NewHandshake(syncType algorithm.SyncType, hasher algorithm.Hasher, parameters interface{}) (Handshake, error) {
+	h := Handshake{Version: ProtocolVersion, SyncType: syncType, Hasher: hasher.Name()}
+	if parameters != nil {
+		b, err := json.Marshal(parameters)
+		if err != nil {
+			return Handshake{}, fmt.Errorf("failed to encode %s parameters, %v", syncType, err)
+		}
+		h.Parameters = b
+	}
+	return h, nil
+}
+
+// HandshakeClient sends the local handshake to the server and fails if the handshake of the server differs. The
+// connection is compressed afterwards if the server picks a compression.
+func HandshakeClient(conn Connection, local Handshake) error {
+	local.Compression = nil
+	if c, ok := conn.(compressor); ok {
+		local.Compression = c.offeredCompressions()
+	}
+	b, err := json.Marshal(local)
+	if err != nil {
+		return err
+	}
+	if _, err = conn.Send(b); err != nil {
+		return err
+	}
+	b, err = conn.Receive()
+	if err != nil {
+		return err
+	}
+	remote, err := decodeHandshake(b)
+	if err != nil {
+		return err
+	}
+	if err = local.compare(remote, false); err != nil {
+		return err
+	}
+	if len(remote.Compression) == 0 {
+		return nil
+	}
+	_, offered := pickCompression(remote.Compression, local.Compression)
+	if len(remote.Compression) != 1 || !offered {
+		return fmt.Errorf("%w, server picks compression %v which the client does not offer", ErrHandshakeMismatch, remote.Compression)
+	}
+	// The client only offers compressions if the connection is a compressor.
+	return conn.(compressor).startCompression(remote.Compression[0])
+}
+
+// HandshakeServer answers the handshake of the client with the local one and fails if they differ. The local
+// handshake is sent even if the one of the client cannot be read, so the client reports the mismatch as well. The
+// connection is compressed afterwards with the first compression of the client the server offers as well.
+func HandshakeServer(conn Connection, local Handshake) error {
+	b, err := conn.Receive()
+	if err != nil {
+		return err
+	}
+	remote, decodeErr := decodeHandshake(b)
+
+	local.Compression = nil
+	c, isCompressor := conn.(compressor)
+	if decodeErr == nil && isCompressor {
+		if compression, ok := pickCompression(remote.Compression, c.offeredCompressions()); ok {
+			local.Compression = []Compression{compression}
+		}
+	}
+	if b, err = json.Marshal(local); err != nil {
+		return err
+	}
+	if _, err = conn.Send(b); err != nil {
+		return err
+	}
+	if decodeErr != nil {
+		return decodeErr
+	}
+	if err = local.compare(remote, true); err != nil {
+		return err
+	}
+	if len(local.Compression) == 0 {
+		return nil
+	}
+	return c.startCompression(local.Compression[0])
+}
+
+func decodeHandshake(b []byte) (Handshake, error) {
+	var h Handshake
+	if err := json.Unmarshal(b, &h); err != nil {
+		return Handshake{}, fmt.Errorf("%w, received invalid handshake, %v", ErrHandshakeMismatch, err)
+	}
+	return h, nil
+}
+
+// compare returns the first field the handshake of the remote disagrees on.
+func (h Handshake) compare(remote Handshake, isServer bool) error {
+	client, server := h, remote
+	if isServer {
+		client, server = remote, h
+	}
+	switch {
+	case client.Version != server.Version:
+		return fmt.Errorf("%w, client speaks protocol version %d and server speaks version %d", ErrHandshakeMismatch, client.Version, server.Version)
+	case client.SyncType != server.SyncType:
+		return fmt.Errorf("%w, client runs %s and server runs %s", ErrHandshakeMismatch, client.SyncType, server.SyncType)
+	case client.Hasher != server.Hasher:
+		return fmt.Errorf("%w, client uses '%s' and server uses '%s'", ErrHasherMismatch, client.Hasher, server.Hasher)
+	case !bytes.Equal(client.Parameters, server.Parameters):
+		return fmt.Errorf("%w, client runs %s with %s and server with %s", ErrHandshakeMismatch, client.SyncType, client.Parameters, server.Parameters)
+	}
+	return nil
+}
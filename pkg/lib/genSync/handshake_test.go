@@ -0,0 +1,80 @@
+package genSync
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/lib/algorithm"
+)
+
+func TestHandshake(t *testing.T) {
+	newHandshake := func(syncType algorithm.SyncType, hasher algorithm.Hasher, parameters interface{}) Handshake {
+		h, err := NewHandshake(syncType, hasher, parameters)
+		require.NoError(t, err)
+		return h
+	}
+	local := newHandshake(algorithm.IBLT, algorithm.DefaultHasher, map[string]int{"DataLen": 32})
+	newerVersion := local
+	newerVersion.Version++
+
+	tests := []struct {
+		name   string
+		remote Handshake
+		err    error
+	}{
+		{
+			name:   "same sync",
+			remote: newHandshake(algorithm.IBLT, algorithm.DefaultHasher, map[string]int{"DataLen": 32}),
+		},
+		{
+			name:   "different protocol version",
+			remote: newerVersion,
+			err:    ErrHandshakeMismatch,
+		},
+		{
+			name:   "different algorithm",
+			remote: newHandshake(algorithm.FullSync, algorithm.DefaultHasher, nil),
+			err:    ErrHandshakeMismatch,
+		},
+		{
+			name:   "different hasher",
+			remote: newHandshake(algorithm.IBLT, algorithm.NewSHA256Hasher(), map[string]int{"DataLen": 32}),
+			err:    ErrHasherMismatch,
+		},
+		{
+			name:   "different parameters",
+			remote: newHandshake(algorithm.IBLT, algorithm.DefaultHasher, map[string]int{"DataLen": 8}),
+			err:    ErrHandshakeMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientPipe, serverPipe := net.Pipe()
+			client, err := NewConnection(clientPipe)
+			require.NoError(t, err)
+			server, err := NewConnection(serverPipe)
+			require.NoError(t, err)
+			defer client.Close()
+			defer server.Close()
+
+			// Both peers report the mismatch.
+			served := make(chan error)
+			go func() {
+				served <- HandshakeServer(server, tt.remote)
+			}()
+			clientErr := HandshakeClient(client, local)
+			serverErr := <-served
+			if tt.err == nil {
+				assert.NoError(t, clientErr)
+				assert.NoError(t, serverErr)
+				return
+			}
+			assert.ErrorIs(t, clientErr, tt.err)
+			assert.ErrorIs(t, serverErr, tt.err)
+			assert.Equal(t, clientErr.Error(), serverErr.Error())
+		})
+	}
+}
@@ -1,6 +1,10 @@
 package genSync
 
-import "github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/set"
+import (
+	"context"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/set"
+)
 
 type GenSync interface {
 	SetFreezeLocal(freezeLocal bool)
@@ -10,10 +14,64 @@ type GenSync interface {
 
 	SyncClient(ip string, port int) error
 	SyncServer(ip string, port int) error
+	// SyncClientContext and SyncServerContext give up connecting, listening and reconciling once the context is done
+	// and return its error.
+	SyncClientContext(ctx context.Context, ip string, port int) error
+	SyncServerContext(ctx context.Context, ip string, port int) error
+	// ConnSync reconciles over a connection from NewConnection or NewReadWriterConnection instead of TCP. RunContext
+	// bounds it by a context.
+	ConnSync
 
 	GetLocalSet() *set.Set
 	GetSetAdditions() *set.Set // Set the set that is added to the local set.
 	GetSentBytes() int
 	GetReceivedBytes() int
 	GetTotalBytes() int
+	// Stats returns the traffic of the last sync broken down by phase.
+	Stats() Stats
+}
+
+// RoundBytes is the number of bytes sent and received in one round of a sync.
+type RoundBytes struct {
+	Sent     int
+	Received int
+}
+
+// ConnSync reconciles over an established connection, which is left open afterwards. SyncClient and SyncServer open a
+// TCP connection for it.
+type ConnSync interface {
+	SyncClientConn(conn Connection) error
+	SyncServerConn(conn Connection) error
+}
+
+// Snapshotter is implemented by syncs that a Server serves to several clients at once. Each session reconciles an
+// independent snapshot of the local state, whose changes are applied back one session at a time.
+type Snapshotter interface {
+	// Snapshot returns a copy of the sync that does not share mutable state with it. A Server closes the copy after
+	// its session if it implements io.Closer.
+	Snapshot() (GenSync, error)
+	// Apply applies the changes a session made to a snapshot of the sync.
+	Apply(session GenSync) error
+}
+
+// Changes are the elements a sync adds to and deletes from the local set.
+type Changes struct {
+	Additions *set.Set
+	Deletions *set.Set
+}
+
+// NewChanges returns empty changes.
+func NewChanges() Changes {
+	return Changes{Additions: set.New(), Deletions: set.New()}
+}
+
+// Transactional is implemented by syncs that stage the changes of a sync and commit them to the local set in one step
+// once they are validated, so that a failed sync leaves the local set unchanged.
+type Transactional interface {
+	// SetDryRun if set to true stages the changes of the following syncs without committing them.
+	SetDryRun(dryRun bool)
+	// GetStagedChanges returns the changes the last sync staged, which are the would-be changes in a dry run.
+	GetStagedChanges() Changes
+	// Rollback reverts the changes the last sync committed to the local set.
+	Rollback() error
 }
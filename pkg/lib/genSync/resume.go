@@ -0,0 +1,241 @@
+package genSync
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/String-Reconciliation-Ditributed-System/RCDS_GO/pkg/util"
+)
+
+const (
+	// maxCheckpoints is the number of failed sessions a server keeps for reconnecting clients.
+	maxCheckpoints = 64
+
+	// literalBatchSize is the number of elements of a literal transfer a receiver checkpoints at once.
+	literalBatchSize = 256
+)
+
+// SessionID identifies a session across reconnects of the client.
+type SessionID [16]byte
+
+// NewSessionID returns a random session ID.
+func NewSessionID() (SessionID, error) {
+	var id SessionID
+	if _, err := rand.Read(id[:]); err != nil {
+		return id, fmt.Errorf("failed to generate session ID, %v", err)
+	}
+	return id, nil
+}
+
+func (id SessionID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// Checkpoint is the progress of the literal transfers of a session. A peer keeps it when the connection drops, so that
+// the client resumes the session from the last element received on reconnecting instead of starting over. Received
+// elements are only handed to the sync once their transfer completes.
+type Checkpoint struct {
+	ID SessionID
+	// Digest is the digest of the local set the session started from. A session cannot be resumed once it changes.
+	Digest    uint64
+	transfers map[string]*literalTransfer
+}
+
+// literalTransfer is a transfer of elements in one direction. The sender keeps the elements in the order they are
+// sent, and the receiver the elements received so far.
+type literalTransfer struct {
+	outgoing [][]byte
+	sending  bool
+	received [][]byte
+}
+
+func newCheckpoint(id SessionID, digest uint64) *Checkpoint {
+	return &Checkpoint{ID: id, Digest: digest, transfers: make(map[string]*literalTransfer)}
+}
+
+func (c *Checkpoint) transfer(name string) *literalTransfer {
+	t, ok := c.transfers[name]
+	if !ok {
+		t = &literalTransfer{}
+		c.transfers[name] = t
+	}
+	return t
+}
+
+// SendLiteral sends the elements of the named transfer, starting from the first one the remote has not received. The
+// elements are only computed on the first attempt, so that a resumed session sends them in the same order.
+func (c *Checkpoint) SendLiteral(conn Connection, name string, elements func() [][]byte) error {
+	t := c.transfer(name)
+	if !t.sending {
+		t.outgoing = elements()
+		t.sending = true
+	}
+	b, err := conn.Receive()
+	if err != nil {
+		return err
+	}
+	offset := util.BytesToInt(b)
+	if offset < 0 || offset > len(t.outgoing) {
+		return fmt.Errorf("remote resumes %s transfer from element %d of %d", name, offset, len(t.outgoing))
+	}
+	remaining := t.outgoing[offset:]
+	if _, err = conn.Send(util.IntToBytes(len(remaining))); err != nil {
+		return err
+	}
+	for len(remaining) > 0 {
+		n := min(len(remaining), literalBatchSize)
+		if _, err = conn.SendBytesSlice(remaining[:n]); err != nil {
+			return err
+		}
+		remaining = remaining[n:]
+	}
+	return nil
+}
+
+// ReceiveLiteral receives the elements of the named transfer, resuming after the elements received before the
+// connection dropped, and returns all of them once the transfer completes.
+func (c *Checkpoint) ReceiveLiteral(conn Connection, name string) ([][]byte, error) {
+	t := c.transfer(name)
+	if _, err := conn.Send(util.IntToBytes(len(t.received))); err != nil {
+		return nil, err
+	}
+	b, err := conn.Receive()
+	if err != nil {
+		return nil, err
+	}
+	remaining := util.BytesToInt(b)
+	if remaining < 0 {
+		return nil, fmt.Errorf("received invalid negative number of %s elements: %d", name, remaining)
+	}
+	for remaining > 0 {
+		batch, err := conn.ReceiveBytesSlice()
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) == 0 || len(batch) > remaining {
+			return nil, fmt.Errorf("received %d %s elements with %d remaining", len(batch), name, remaining)
+		}
+		t.received = append(t.received, batch...)
+		remaining -= len(batch)
+	}
+	return t.received, nil
+}
+
+// ResumeClient asks the server to resume the session of the checkpoint, unless there is none or the local set has
+// changed since, and returns the checkpoint of the session that runs. It is a new one unless the server resumes.
+func ResumeClient(conn Connection, checkpoint *Checkpoint, digest uint64) (*Checkpoint, error) {
+	resume := checkpoint != nil && checkpoint.Digest == digest
+	if !resume {
+		id, err := NewSessionID()
+		if err != nil {
+			return nil, err
+		}
+		checkpoint = newCheckpoint(id, digest)
+	}
+	if _, err := conn.Send(checkpoint.ID[:]); err != nil {
+		return nil, err
+	}
+	if err := conn.SendSyncStatus(resumeStatus(resume)); err != nil {
+		return nil, err
+	}
+	status, err := conn.ReceiveSyncStatus()
+	if err != nil {
+		return nil, err
+	}
+	if status == SYNC_RETRY {
+		logrus.Infof("Resuming sync session %s.", checkpoint.ID)
+	} else if resume {
+		logrus.Infof("Server cannot resume sync session %s, starting over.", checkpoint.ID)
+		checkpoint = newCheckpoint(checkpoint.ID, digest)
+	}
+	return checkpoint, nil
+}
+
+// resumeStatus is SYNC_RETRY for a session that is resumed and SYNC_CONTINUE for one that starts over.
+func resumeStatus(resume bool) uint8 {
+	if resume {
+		return SYNC_RETRY
+	}
+	return SYNC_CONTINUE
+}
+
+// Checkpoints keeps the checkpoints of the sessions of a server that failed, up to a limit, for clients that reconnect.
+// A nil Checkpoints keeps none.
+type Checkpoints struct {
+	mu       sync.Mutex
+	sessions map[SessionID]*Checkpoint
+	order    []SessionID
+}
+
+// Resume receives the session the client runs and returns its checkpoint, which is the kept one if the client resumes
+// it and the local set has not changed since. The checkpoint is released until it is kept again.
+func (c *Checkpoints) Resume(conn Connection, digest uint64) (*Checkpoint, error) {
+	b, err := conn.Receive()
+	if err != nil {
+		return nil, err
+	}
+	var id SessionID
+	if len(b) != len(id) {
+		return nil, fmt.Errorf("received invalid session ID of %d bytes", len(b))
+	}
+	copy(id[:], b)
+	status, err := conn.ReceiveSyncStatus()
+	if err != nil {
+		return nil, err
+	}
+	checkpoint := c.take(id)
+	resume := status == SYNC_RETRY && checkpoint != nil && checkpoint.Digest == digest
+	if err = conn.SendSyncStatus(resumeStatus(resume)); err != nil {
+		return nil, err
+	}
+	if !resume {
+		return newCheckpoint(id, digest), nil
+	}
+	logrus.Infof("Resuming sync session %s.", id)
+	return checkpoint, nil
+}
+
+// take removes the checkpoint of the session from the kept ones and returns it, if it is kept.
+func (c *Checkpoints) take(id SessionID) *Checkpoint {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	checkpoint, ok := c.sessions[id]
+	if !ok {
+		return nil
+	}
+	delete(c.sessions, id)
+	for j, kept := range c.order {
+		if kept == id {
+			c.order = append(c.order[:j], c.order[j+1:]...)
+			break
+		}
+	}
+	return checkpoint
+}
+
+// Keep keeps the checkpoint of a failed session, dropping the oldest one beyond the limit.
+func (c *Checkpoints) Keep(checkpoint *Checkpoint) {
+	if c == nil || checkpoint == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sessions == nil {
+		c.sessions = make(map[SessionID]*Checkpoint)
+	}
+	if _, ok := c.sessions[checkpoint.ID]; !ok {
+		c.order = append(c.order, checkpoint.ID)
+	}
+	c.sessions[checkpoint.ID] = checkpoint
+	for len(c.order) > maxCheckpoints {
+		delete(c.sessions, c.order[0])
+		c.order = c.order[1:]
+	}
+}
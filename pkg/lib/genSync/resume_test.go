@@ -0,0 +1,88 @@
+package genSync
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dropConnection drops the connection after receiving a number of element batches and counts the elements received.
+type dropConnection struct {
+	Connection
+	batches  int
+	elements int
+}
+
+func (d *dropConnection) ReceiveBytesSlice() ([][]byte, error) {
+	if d.batches == 0 {
+		d.Close()
+		return nil, errors.New("connection dropped")
+	}
+	d.batches--
+	batch, err := d.Connection.ReceiveBytesSlice()
+	d.elements += len(batch)
+	return batch, err
+}
+
+func TestResume(t *testing.T) {
+	elements := make([][]byte, 3*literalBatchSize+10)
+	for j := range elements {
+		elements[j] = []byte(fmt.Sprint(j))
+	}
+	checkpoints := &Checkpoints{}
+	var clientCheckpoint *Checkpoint
+
+	// session runs a transfer from the server to the client, which drops the connection after a number of batches.
+	session := func(serverDigest uint64, batches int) (*dropConnection, [][]byte, error) {
+		clientPipe, serverPipe := net.Pipe()
+		server, err := NewConnection(serverPipe)
+		require.NoError(t, err)
+		conn, err := NewConnection(clientPipe)
+		require.NoError(t, err)
+		client := &dropConnection{Connection: conn, batches: batches}
+		defer client.Close()
+
+		done := make(chan error)
+		go func() {
+			checkpoint, err := checkpoints.Resume(server, serverDigest)
+			if err == nil {
+				err = checkpoint.SendLiteral(server, "set", func() [][]byte { return elements })
+			}
+			if err != nil {
+				checkpoints.Keep(checkpoint)
+			}
+			server.Close()
+			done <- err
+		}()
+
+		checkpoint, err := ResumeClient(client, clientCheckpoint, 1)
+		require.NoError(t, err)
+		clientCheckpoint = checkpoint
+		received, err := checkpoint.ReceiveLiteral(client, "set")
+		assert.Equal(t, err == nil, <-done == nil)
+		return client, received, err
+	}
+
+	client, _, err := session(1, 2)
+	require.Error(t, err)
+	assert.Equal(t, 2*literalBatchSize, client.elements)
+
+	// The session resumes from the last element received.
+	client, received, err := session(1, -1)
+	require.NoError(t, err)
+	assert.Equal(t, literalBatchSize+10, client.elements)
+	assert.Equal(t, elements, received)
+
+	// A session cannot be resumed once the set of the server changes.
+	clientCheckpoint = nil
+	_, _, err = session(1, 1)
+	require.Error(t, err)
+	client, received, err = session(2, -1)
+	require.NoError(t, err)
+	assert.Equal(t, len(elements), client.elements)
+	assert.Equal(t, elements, received)
+}
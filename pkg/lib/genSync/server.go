@@ -0,0 +1,160 @@
+package genSync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Server serves a sync to many clients at once. It keeps listening after each session and reconciles every client in
+// its own goroutine against a snapshot of the local state taken when the client connects. The changes of each
+// session are applied to the local state one session at a time, so a hub can serve a fleet of edge nodes.
+type Server struct {
+	sync        GenSync
+	listener    Listener
+	maxSessions int
+	onSession   func(session GenSync, err error)
+	connOptions []ConnectionOption
+
+	// mu serializes snapshots, the application of session changes and updates of the local state.
+	mu        sync.Mutex
+	sessions  sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
+}
+
+type ServerOption func(server *Server)
+
+// WithMaxSessions stops accepting clients after the number of sessions. Zero, the default, accepts clients until the
+// server is closed.
+func WithMaxSessions(n int) ServerOption {
+	return func(server *Server) {
+		server.maxSessions = n
+	}
+}
+
+// WithSessionHandler sets the function called after each session with the snapshot the session reconciled and the
+// error of the session, if any. Failed sessions are logged by default. A snapshot that implements io.Closer is closed
+// once the handler returns.
+func WithSessionHandler(handler func(session GenSync, err error)) ServerOption {
+	return func(server *Server) {
+		server.onSession = handler
+	}
+}
+
+// WithConnectionOptions sets the options of the connection of every client, such as its frame limits.
+func WithConnectionOptions(option ...ConnectionOption) ServerOption {
+	return func(server *Server) {
+		server.connOptions = option
+	}
+}
+
+// NewServer listens on the address to serve the sync, which must implement Snapshotter.
+func NewServer(sync GenSync, ip string, port int, option ...ServerOption) (*Server, error) {
+	if _, ok := sync.(Snapshotter); !ok {
+		return nil, fmt.Errorf("%T does not support snapshots for concurrent sessions", sync)
+	}
+	s := &Server{sync: sync}
+	for _, opt := range option {
+		opt(s)
+	}
+	if s.maxSessions < 0 {
+		return nil, fmt.Errorf("maximum number of sessions should not be negative")
+	}
+
+	listener, err := NewTcpListener(ip, port, s.connOptions...)
+	if err != nil {
+		return nil, err
+	}
+	s.listener = listener
+	return s, nil
+}
+
+// Serve accepts clients until the server is closed or the maximum number of sessions is reached, and returns after
+// every session has ended.
+func (s *Server) Serve() error {
+	return s.ServeContext(context.Background())
+}
+
+// ServeContext runs Serve until the context is done, which closes the server, interrupts the running sessions and is
+// returned as the error.
+func (s *Server) ServeContext(ctx context.Context) error {
+	defer s.sessions.Wait()
+	stop := context.AfterFunc(ctx, func() {
+		s.Close()
+	})
+	defer stop()
+	for n := 0; s.maxSessions == 0 || n < s.maxSessions; n++ {
+		conn, err := s.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return ctx.Err()
+		} else if err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		session, err := s.sync.(Snapshotter).Snapshot()
+		s.mu.Unlock()
+		if err != nil {
+			conn.Close()
+			s.report(nil, fmt.Errorf("failed to snapshot the local state, %v", err))
+			continue
+		}
+		s.sessions.Add(1)
+		go s.serve(ctx, conn, session)
+	}
+	return s.Close()
+}
+
+func (s *Server) serve(ctx context.Context, conn Connection, session GenSync) {
+	defer s.sessions.Done()
+	err := RunContext(ctx, conn, session.SyncServerConn)
+	if closeErr := conn.Close(); closeErr != nil {
+		logrus.Debugf("failed to close connection, %v", closeErr)
+	}
+	if err == nil {
+		err = s.Update(func(sync GenSync) error {
+			return sync.(Snapshotter).Apply(session)
+		})
+	}
+	s.report(session, err)
+	if closer, ok := session.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			logrus.Debugf("failed to close session, %v", err)
+		}
+	}
+}
+
+func (s *Server) report(session GenSync, err error) {
+	if s.onSession != nil {
+		s.onSession(session, err)
+	} else if err != nil {
+		logrus.Errorf("sync session failed, %v", err)
+	}
+}
+
+// Update calls the function with the local sync while no session changes are applied, which is how the local state is
+// edited while the server runs. Sessions already running keep reconciling their snapshots.
+func (s *Server) Update(f func(sync GenSync) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return f(s.sync)
+}
+
+// Close stops accepting clients. Serve returns once the running sessions end.
+func (s *Server) Close() error {
+	s.closeOnce.Do(func() {
+		s.closeErr = s.listener.Close()
+	})
+	return s.closeErr
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
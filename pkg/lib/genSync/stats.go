@@ -0,0 +1,132 @@
+package genSync
+
+// Phase is a part of a sync whose bytes are accounted separately.
+type Phase string
+
+const (
+	// PhaseHandshake agrees on the protocol, the algorithm and its parameters.
+	PhaseHandshake Phase = "handshake"
+	// PhaseDigest compares the digests of the local and the remote state and exchanges the sync flags.
+	PhaseDigest Phase = "digest"
+	// PhaseTable exchanges the structure the difference is computed from, such as an IBLT table, a strata estimator,
+	// CPI evaluations or the shingles of RCDS.
+	PhaseTable Phase = "table"
+	// PhaseLiteral transfers the elements or the string content that are missing.
+	PhaseLiteral Phase = "literal"
+)
+
+// PhaseBytes is the number of bytes on the wire in one phase of a sync.
+type PhaseBytes struct {
+	Phase Phase
+	RoundBytes
+}
+
+// Stats is the traffic of a sync.
+type Stats struct {
+	// SentBytes and ReceivedBytes count the bytes on the wire.
+	SentBytes     int
+	ReceivedBytes int
+	// LogicalSentBytes and LogicalReceivedBytes count the frames before compression.
+	LogicalSentBytes     int
+	LogicalReceivedBytes int
+	// Phases breaks the wire bytes down by phase in the order the phases ran. A phase that runs again after another
+	// one, such as the table of an IBLT resync, appears again.
+	Phases []PhaseBytes
+	// Rounds breaks the wire bytes down by round trip, for syncs that count their rounds such as CPI. The first round
+	// starts with the sync and the last one ends with it.
+	Rounds []RoundBytes
+}
+
+// Phase returns the bytes of all runs of the phase.
+func (s Stats) Phase(phase Phase) RoundBytes {
+	var b RoundBytes
+	for _, p := range s.Phases {
+		if p.Phase == phase {
+			b.Sent += p.Sent
+			b.Received += p.Received
+		}
+	}
+	return b
+}
+
+// counters is a reading of the byte counters of a connection.
+type counters struct {
+	sent, received, logicalSent, logicalReceived int
+}
+
+func readCounters(conn Connection) counters {
+	return counters{
+		sent:            conn.GetSentBytes(),
+		received:        conn.GetReceivedBytes(),
+		logicalSent:     conn.GetLogicalSentBytes(),
+		logicalReceived: conn.GetLogicalReceivedBytes(),
+	}
+}
+
+// Meter accounts the bytes of a sync over a connection by phase, from the counters of the connection.
+type Meter struct {
+	conn       Connection
+	start      counters
+	phase      Phase
+	phaseStart counters
+	phases     []PhaseBytes
+	roundStart counters
+	rounds     []RoundBytes
+}
+
+// NewMeter starts accounting a sync over the connection, whose bytes so far are left out.
+func NewMeter(conn Connection) *Meter {
+	c := readCounters(conn)
+	return &Meter{conn: conn, start: c, phaseStart: c, roundStart: c}
+}
+
+// Start ends the current phase and accounts the following bytes to the phase.
+func (m *Meter) Start(phase Phase) {
+	m.end()
+	m.phase = phase
+}
+
+// end accounts the bytes since the current phase started to it. Phases without any bytes are left out.
+func (m *Meter) end() {
+	c := readCounters(m.conn)
+	b := RoundBytes{Sent: c.sent - m.phaseStart.sent, Received: c.received - m.phaseStart.received}
+	m.phaseStart = c
+	if m.phase == "" || b == (RoundBytes{}) {
+		return
+	}
+	if n := len(m.phases); n > 0 && m.phases[n-1].Phase == m.phase {
+		m.phases[n-1].Sent += b.Sent
+		m.phases[n-1].Received += b.Received
+		return
+	}
+	m.phases = append(m.phases, PhaseBytes{Phase: m.phase, RoundBytes: b})
+}
+
+// EndRound ends the current round trip of the sync and accounts its bytes to Stats.Rounds. Rounds without any bytes
+// are left out.
+func (m *Meter) EndRound() {
+	c := readCounters(m.conn)
+	b := RoundBytes{Sent: c.sent - m.roundStart.sent, Received: c.received - m.roundStart.received}
+	m.roundStart = c
+	if b != (RoundBytes{}) {
+		m.rounds = append(m.rounds, b)
+	}
+}
+
+// Stop ends the current phase, and the current round if the sync counts rounds, and returns the stats of the sync.
+func (m *Meter) Stop() Stats {
+	m.end()
+	m.phase = ""
+	if m.rounds != nil {
+		m.EndRound()
+	}
+	c := readCounters(m.conn)
+	return Stats{
+		SentBytes:            c.sent - m.start.sent,
+		ReceivedBytes:        c.received - m.start.received,
+		LogicalSentBytes:     c.logicalSent - m.start.logicalSent,
+		LogicalReceivedBytes: c.logicalReceived - m.start.logicalReceived,
+		Phases:               m.phases,
+		Rounds:               m.rounds,
+	}
+}
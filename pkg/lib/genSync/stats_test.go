@@ -0,0 +1,82 @@
+package genSync
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeter(t *testing.T) {
+	clientPipe, serverPipe := net.Pipe()
+	client, err := NewConnection(clientPipe)
+	require.NoError(t, err)
+	server, err := NewConnection(serverPipe)
+	require.NoError(t, err)
+	defer server.Close()
+
+	// Echo every payload until the client closes.
+	go func() {
+		for {
+			b, err := server.Receive()
+			if err != nil {
+				return
+			}
+			if _, err = server.Send(b); err != nil {
+				return
+			}
+		}
+	}()
+	echo := func(n int) {
+		_, err := client.Send(make([]byte, n))
+		require.NoError(t, err)
+		_, err = client.Receive()
+		require.NoError(t, err)
+	}
+
+	echo(1)
+	meter := NewMeter(client)
+	meter.Start(PhaseHandshake)
+	echo(10)
+	meter.Start(PhaseDigest)
+	meter.Start(PhaseTable)
+	echo(100)
+	meter.EndRound()
+	meter.Start(PhaseTable)
+	echo(100)
+	meter.EndRound()
+	meter.EndRound()
+	meter.Start(PhaseLiteral)
+	echo(1000)
+	stats := meter.Stop()
+
+	// Bytes before the meter started are left out, empty phases are dropped and repeated phases are merged.
+	frame := func(n int) RoundBytes {
+		return RoundBytes{Sent: n + frameHeaderSize, Received: n + frameHeaderSize}
+	}
+	assert.Equal(t, []PhaseBytes{
+		{Phase: PhaseHandshake, RoundBytes: frame(10)},
+		{Phase: PhaseTable, RoundBytes: RoundBytes{Sent: 2 * (100 + frameHeaderSize), Received: 2 * (100 + frameHeaderSize)}},
+		{Phase: PhaseLiteral, RoundBytes: frame(1000)},
+	}, stats.Phases)
+	assert.Equal(t, 1210+4*frameHeaderSize, stats.SentBytes)
+	assert.Equal(t, stats.SentBytes, stats.ReceivedBytes)
+	assert.Equal(t, stats.SentBytes, stats.LogicalSentBytes)
+	assert.Equal(t, frame(1000), stats.Phase(PhaseLiteral))
+	assert.Zero(t, stats.Phase(PhaseDigest))
+
+	// Rounds split the same bytes at the round trips the sync ends, leaving out empty rounds.
+	assert.Equal(t, []RoundBytes{
+		{Sent: 110 + 2*frameHeaderSize, Received: 110 + 2*frameHeaderSize},
+		frame(100),
+		frame(1000),
+	}, stats.Rounds)
+
+	// Only the bytes actually written are counted.
+	require.NoError(t, client.Close())
+	sent := client.GetSentBytes()
+	_, err = client.Send(make([]byte, 10))
+	assert.Error(t, err)
+	assert.Equal(t, sent, client.GetSentBytes())
+}
@@ -0,0 +1,70 @@
+package genSync
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// WithTLS encrypts the connection with TLS. Servers need a certificate in the config, which NewServerTLSConfig and
+// NewClientTLSConfig build from files. The server name of a client defaults to the host it connects to.
+func WithTLS(config *tls.Config) ConnectionOption {
+	return func(option *connectionOptions) {
+		option.tlsConfig = config
+	}
+}
+
+// NewServerTLSConfig loads the certificate and key of a server. If a CA file is given, clients must present a
+// certificate issued by one of its CAs.
+func NewServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the server certificate, %v", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCAFile != "" {
+		if config.ClientCAs, err = loadCAPool(clientCAFile); err != nil {
+			return nil, err
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// NewClientTLSConfig pins the CAs of the CA file, or trusts the system roots if it is empty, to verify the server. The
+// certificate and key are presented to servers verifying their clients and may be empty otherwise.
+func NewClientTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pool, err := loadCAPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client certificate, %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// loadCAPool reads the PEM encoded CA certificates of the file.
+func loadCAPool(caFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file, %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no CA certificates found in %s", caFile)
+	}
+	return pool, nil
+}
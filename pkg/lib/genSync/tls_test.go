@@ -0,0 +1,120 @@
+package genSync
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+)
+
+// testCert issues a certificate signed by the parent, or a self-signed CA if the parent is nil, and writes the
+// certificate and its key to PEM files in the directory.
+func testCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return cert, key, certFile, keyFile
+}
+
+func TestTLSConnection(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey, caFile, _ := testCert(t, dir, "ca", nil, nil)
+	_, _, serverCert, serverKey := testCert(t, dir, "server", ca, caKey)
+	_, _, clientCert, clientKey := testCert(t, dir, "client", ca, caKey)
+	_, _, otherCAFile, _ := testCert(t, dir, "other-ca", nil, nil)
+
+	// exchange sends a payload from the client to the server and returns the errors of both sides.
+	exchange := func(serverConfig, clientConfig *tls.Config) (error, error) {
+		testPort := 9000 + utilrand.IntnRange(1000, 9000)
+		testServer, err := NewTcpConnection("", testPort, WithTLS(serverConfig))
+		require.NoError(t, err)
+		testClient, err := NewTcpConnection("", testPort, WithTLS(clientConfig))
+		require.NoError(t, err)
+
+		served := make(chan error)
+		go func() {
+			err := testServer.Listen()
+			if err == nil {
+				defer testServer.Close()
+				var received []byte
+				if received, err = testServer.Receive(); err == nil {
+					assert.Equal(t, "encrypted", string(received))
+				}
+			}
+			served <- err
+		}()
+		time.Sleep(100 * time.Millisecond)
+		err = testClient.Connect()
+		if err == nil {
+			defer testClient.Close()
+			_, err = testClient.Send([]byte("encrypted"))
+		}
+		return <-served, err
+	}
+
+	serverConfig, err := NewServerTLSConfig(serverCert, serverKey, "")
+	require.NoError(t, err)
+	pinned, err := NewClientTLSConfig(caFile, "", "")
+	require.NoError(t, err)
+	serverErr, clientErr := exchange(serverConfig, pinned)
+	assert.NoError(t, serverErr)
+	assert.NoError(t, clientErr)
+
+	// A server whose certificate is not issued by the pinned CA is refused.
+	wrongPin, err := NewClientTLSConfig(otherCAFile, "", "")
+	require.NoError(t, err)
+	serverErr, clientErr = exchange(serverConfig, wrongPin)
+	assert.Error(t, serverErr)
+	assert.Error(t, clientErr)
+
+	// A server verifying clients refuses clients without a certificate.
+	mutualConfig, err := NewServerTLSConfig(serverCert, serverKey, caFile)
+	require.NoError(t, err)
+	serverErr, _ = exchange(mutualConfig, pinned)
+	assert.Error(t, serverErr)
+	withCert, err := NewClientTLSConfig(caFile, clientCert, clientKey)
+	require.NoError(t, err)
+	serverErr, clientErr = exchange(mutualConfig, withCert)
+	assert.NoError(t, serverErr)
+	assert.NoError(t, clientErr)
+
+	_, err = NewServerTLSConfig(serverCert, serverKey, filepath.Join(dir, "missing.crt"))
+	assert.Error(t, err)
+}
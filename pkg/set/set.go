@@ -115,11 +115,11 @@ func (s *Set) Union(set *Set) *Set {
 	return &n
 }
 
-// Digest is the xor sum of the entire set's hash.
-func (s *Set) GetDigest() (uint64, error) {
+// Digest is the xor sum of the entire set's hash with the hasher.
+func (s *Set) GetDigest(hasher algorithm.Hasher) (uint64, error) {
 	var sum uint64
 	for k, v := range *s {
-		e, err := algorithm.HashString(fmt.Sprint(k) + fmt.Sprint(v)).ToUint64()
+		e, err := algorithm.HashString(fmt.Sprint(k) + fmt.Sprint(v)).ToUint64With(hasher)
 		if err != nil {
 			return 0, err
 		}
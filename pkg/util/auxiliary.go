@@ -14,9 +14,10 @@ func IntToBytes(num int) []byte {
 	return arr
 }
 
+// BytesToInt decodes the bytes of IntToBytes. Bytes beyond the width of an int are ignored.
 func BytesToInt(arr []byte) int {
 	var val int
-	size := len(arr)
+	size := min(len(arr), int(unsafe.Sizeof(val)))
 	for i := 0; i < size; i++ {
 		*(*uint8)(unsafe.Pointer(uintptr(unsafe.Pointer(&val)) + uintptr(i))) = arr[i]
 	}
@@ -34,7 +35,7 @@ func Int64ToBytes(num int64) []byte {
 
 func BytesToInt64(arr []byte) int64 {
 	var val int64
-	size := len(arr)
+	size := min(len(arr), int(unsafe.Sizeof(val)))
 	for i := 0; i < size; i++ {
 		*(*uint8)(unsafe.Pointer(uintptr(unsafe.Pointer(&val)) + uintptr(i))) = arr[i]
 	}
@@ -52,7 +53,7 @@ func Uint64ToBytes(num uint64) []byte {
 
 func BytesToUint64(arr []byte) uint64 {
 	var val uint64
-	size := len(arr)
+	size := min(len(arr), int(unsafe.Sizeof(val)))
 	for i := 0; i < size; i++ {
 		*(*uint8)(unsafe.Pointer(uintptr(unsafe.Pointer(&val)) + uintptr(i))) = arr[i]
 	}
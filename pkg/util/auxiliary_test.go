@@ -26,3 +26,10 @@ func TestBytesAndUint64Conversion(t *testing.T) {
 		assert.Equal(t, i, BytesToUint64(Uint64ToBytes(i)))
 	}
 }
+
+func TestBytesToIntIgnoresExtraBytes(t *testing.T) {
+	long := append(IntToBytes(3000), 1, 2, 3, 4, 5, 6, 7, 8)
+	assert.Equal(t, 3000, BytesToInt(long))
+	assert.Equal(t, int64(3000), BytesToInt64(long))
+	assert.Equal(t, uint64(3000), BytesToUint64(long))
+}
@@ -5,8 +5,11 @@ package e2e
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -34,15 +37,11 @@ func TestLocalDeployment(t *testing.T) {
 
 // TestServerStartStop tests starting and stopping the server
 func TestServerStartStop(t *testing.T) {
-	// Skip this test as the binary doesn't have server/client commands yet
-	t.Skip("Skipping - requires server/client implementation in main binary")
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// Start server
-	cmd := exec.CommandContext(ctx, "../../bin/rcds")
-	cmd.Env = append(os.Environ(), "RCDS_PORT=8080")
+	cmd := exec.CommandContext(ctx, "../../bin/rcds", "server", "--port", "8080")
 
 	err := cmd.Start()
 	require.NoError(t, err, "Failed to start server")
@@ -53,6 +52,7 @@ func TestServerStartStop(t *testing.T) {
 	// Stop server
 	err = cmd.Process.Kill()
 	assert.NoError(t, err, "Failed to stop server")
+	_ = cmd.Wait()
 }
 
 // TestHealthCheck tests the basic health of the deployed service
@@ -87,13 +87,69 @@ func TestConcurrentConnections(t *testing.T) {
 
 // TestDataSynchronization tests end-to-end data sync
 func TestDataSynchronization(t *testing.T) {
-	t.Skip("Skipping - requires actual server/client implementation")
+	for _, algo := range []string{"full", "iblt"} {
+		t.Run(algo, func(t *testing.T) {
+			dir := t.TempDir()
+			serverInput := filepath.Join(dir, "server.txt")
+			clientInput := filepath.Join(dir, "client.txt")
+			output := filepath.Join(dir, "output.txt")
+			require.NoError(t, os.WriteFile(serverInput, []byte("alpha\nbeta\ngamma\n"), 0644))
+			require.NoError(t, os.WriteFile(clientInput, []byte("beta\ndelta\n"), 0644))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			// Start server with initial dataset
+			server := exec.CommandContext(ctx, "../../bin/rcds", "server", "--port", "8081", "--algorithm", algo,
+				"--input", serverInput, "--sessions", "1")
+			require.NoError(t, server.Start(), "Failed to start server")
+			time.Sleep(time.Second)
+
+			// Start client with different dataset
+			client := exec.CommandContext(ctx, "../../bin/rcds", "client", "--port", "8081", "--algorithm", algo,
+				"--input", clientInput, "--output", output)
+			out, err := client.CombinedOutput()
+			require.NoError(t, err, "Client failed: %s", string(out))
+			assert.NoError(t, server.Wait(), "Server failed")
+
+			// Verify the client has the reconciled data
+			synced, err := os.ReadFile(output)
+			require.NoError(t, err)
+			assert.Equal(t, "alpha\nbeta\ndelta\ngamma\n", string(synced))
+		})
+	}
+}
 
-	// This test would:
-	// 1. Start server with initial dataset
-	// 2. Start client with different dataset
-	// 3. Perform synchronization
-	// 4. Verify both sides have reconciled data
+// TestDocumentSynchronization tests that rcds reproduces the server file in order
+func TestDocumentSynchronization(t *testing.T) {
+	dir := t.TempDir()
+	serverInput := filepath.Join(dir, "server.txt")
+	clientInput := filepath.Join(dir, "client.txt")
+	output := filepath.Join(dir, "output.txt")
+	var doc strings.Builder
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&doc, "line %d of the server document\n", 500-i)
+	}
+	require.NoError(t, os.WriteFile(serverInput, []byte(doc.String()), 0644))
+	require.NoError(t, os.WriteFile(clientInput, []byte(doc.String()[1000:]+"a local line\n"), 0644))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	server := exec.CommandContext(ctx, "../../bin/rcds", "server", "--port", "8081", "--algorithm", "rcds",
+		"--input", serverInput, "--sessions", "1")
+	require.NoError(t, server.Start(), "Failed to start server")
+	time.Sleep(time.Second)
+
+	client := exec.CommandContext(ctx, "../../bin/rcds", "client", "--port", "8081", "--algorithm", "rcds",
+		"--input", clientInput, "--output", output)
+	out, err := client.CombinedOutput()
+	require.NoError(t, err, "Client failed: %s", string(out))
+	assert.NoError(t, server.Wait(), "Server failed")
+
+	synced, err := os.ReadFile(output)
+	require.NoError(t, err)
+	assert.Equal(t, doc.String(), string(synced))
 }
 
 // TestLargeDataset tests with a large dataset